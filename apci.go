@@ -1,9 +1,5 @@
 package iec104
 
-import (
-	"errors"
-)
-
 const startByte = 0x68
 
 /*
@@ -47,7 +43,7 @@ func (apci *APCI) Parse(data []byte) (Frame, error) {
 	case apci.Cf1&0x3 == FrameTypeU:
 		return apci.parseUFrame(), nil
 	default:
-		return nil, errors.New("unknown frame type")
+		return nil, &FramingError{Reason: "unknown frame type", Data: data}
 	}
 }
 
@@ -55,8 +51,8 @@ func (apci *APCI) Parse(data []byte) (Frame, error) {
 parseIFrame is responsible for parsing IFrame from the control fields.
 */
 func (apci *APCI) parseIFrame() *IFrame {
-	send := uint16(apci.Cf1>>1 | apci.Cf2<<7)
-	recv := uint16(apci.Cf3>>1 | apci.Cf4<<7)
+	send := uint16(apci.Cf1>>1) | uint16(apci.Cf2)<<7
+	recv := uint16(apci.Cf3>>1) | uint16(apci.Cf4)<<7
 	return &IFrame{
 		SendSN: send,
 		RecvSN: recv,
@@ -67,7 +63,7 @@ func (apci *APCI) parseIFrame() *IFrame {
 parseSFrame is responsible for parsing SFrame from the control fields.
 */
 func (apci *APCI) parseSFrame() *SFrame {
-	recv := uint16(apci.Cf3>>1 | apci.Cf4<<7)
+	recv := uint16(apci.Cf3>>1) | uint16(apci.Cf4)<<7
 	return &SFrame{
 		RecvSN: recv,
 	}
@@ -1,12 +1,9 @@
 package iec104
 
-import (
-	"fmt"
-)
-
 const (
-	ApduHeaderLen = 4 // non-include startByte and apduLen
+	ApduHeaderLen = 4   // non-include startByte and apduLen
 	AsduHeaderLen = 6
+	MaxAsduLen    = 249 // the maximum length 253 of an APDU without its 4-byte APCI
 )
 
 /*
@@ -46,7 +43,7 @@ type APDU struct {
 
 func (apdu *APDU) Parse(data []byte) error {
 	if len(data) < ApduHeaderLen {
-		return fmt.Errorf("invalid apdu body: % X", data)
+		return &FramingError{Reason: "invalid apdu body", Data: data}
 	}
 
 	// Parse APCI.
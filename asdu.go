@@ -3,6 +3,8 @@ package iec104
 import (
 	"encoding/binary"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 /*
@@ -49,17 +51,38 @@ type ASDU struct {
 
 	toBeHandled bool
 	sendSFrame  bool
-	cmdRsp      *cmdRsp
+	raw         []byte // the received ASDU
 
 	ios     []*InformationObject
 	Signals []*InformationElement
 }
 
+// NewASDU creates an ASDU of the given type carrying the information objects. The structure qualifier is always SQ=0.
+func NewASDU(typeID TypeID, cot COT, coa COA, ios ...*InformationObject) *ASDU {
+	return &ASDU{
+		typeID: typeID,
+		sq:     false,
+		nObjs:  NOO(len(ios)),
+		cot:    cot,
+		coa:    coa,
+		ios:    ios,
+	}
+}
+
+func (asdu *ASDU) TypeID() TypeID { return asdu.typeID }
+func (asdu *ASDU) COT() COT       { return asdu.cot }
+func (asdu *ASDU) ORG() ORG       { return asdu.org }
+func (asdu *ASDU) COA() COA       { return asdu.coa }
+
+// Negative reports whether the P/N bit is set, that is, the command is confirmed negatively.
+func (asdu *ASDU) Negative() bool { return bool(asdu.pn) }
+
 func (asdu *ASDU) Parse(data []byte) error {
 	// I-format frame have ASDU.
 	if len(data) < AsduHeaderLen {
-		return fmt.Errorf("invalid asdu header: % X", data)
+		return &FramingError{Reason: "invalid asdu header", Data: data}
 	}
+	asdu.raw = data
 
 	// the 1st byte
 	asdu.parseTypeID(data[0])
@@ -75,8 +98,7 @@ func (asdu *ASDU) Parse(data []byte) error {
 	// the 5th and 6th bytes
 	asdu.parseCOA(data[4:AsduHeaderLen])
 
-	asdu.parseInformationObjects(data[AsduHeaderLen:])
-	return nil
+	return asdu.parseInformationObjects(data[AsduHeaderLen:])
 }
 
 func (asdu *ASDU) Data() []byte {
@@ -86,7 +108,7 @@ func (asdu *ASDU) Data() []byte {
 	// the 2nd byte
 	data = append(data, func() byte {
 		if asdu.sq {
-			return (0b1 << 7) & asdu.nObjs
+			return (0b1 << 7) | asdu.nObjs
 		} else {
 			return asdu.nObjs
 		}
@@ -94,11 +116,11 @@ func (asdu *ASDU) Data() []byte {
 	// the 3rd byte
 	data = append(data, func() byte {
 		if bool(asdu.t) && bool(asdu.pn) {
-			return (0b11 << 6) & byte(asdu.cot)
+			return (0b11 << 6) | byte(asdu.cot)
 		} else if asdu.t {
-			return (0b1 << 7) & byte(asdu.cot)
+			return (0b1 << 7) | byte(asdu.cot)
 		} else if asdu.pn {
-			return (0b1 << 6) & byte(asdu.cot)
+			return (0b1 << 6) | byte(asdu.cot)
 		} else {
 			return byte(asdu.cot)
 		}
@@ -123,6 +145,15 @@ func (asdu *ASDU) Data() []byte {
 	return data
 }
 
+// Mirror returns the ASDU mirrored in monitor direction with the cause of transmission, and it's a negative
+// confirmation if negative is true.
+func (asdu *ASDU) Mirror(cot COT, negative bool) *ASDU {
+	m := *asdu
+	m.cot = cot
+	m.pn = PN(negative)
+	return &m
+}
+
 /*
 TypeID (Type Identification, 1 byte):
 - value range:
@@ -134,7 +165,7 @@ TypeID (Type Identification, 1 byte):
     | 70      | System information in monitor direction  |
     | 100-106 | System information in control direction  |
     | 110-113 | Parameter in control direction           |
-    | 120-126 | File transfer                            |
+    | 120-127 | File transfer                            |
   - 128-135 is reserved for message routing;
   - 136-255 for special use.
 */
@@ -273,6 +304,13 @@ const (
 	// InformationElementType: IEEE754STD + QOS + CP56Time2a
 	CSeTc1 TypeID = 0x3f // 63
 
+	// System information in monitor direction.
+
+	// MEiNa1 indicates end of initialization.
+	// InformationElementType: COI
+	// COT: CotInit
+	MEiNa1 TypeID = 0x46 // 70
+
 	// System information in control direction.
 
 	// CIcNa1 indicates general interrogation command. [召唤全数据]
@@ -301,13 +339,106 @@ const (
 	CRpNc1 TypeID = 0x69 // 105
 	// CCdNa1 indicates delay acquisition command.
 	// InformationElementType: CP16Time2a
-	// COT: CotAct, CotActCon, 44, 45, 46, 47
+	// COT: CotSpont, CotAct, CotActCon, 44, 45, 46, 47
 	CCdNa1 TypeID = 0x6a // 106
-	// CTsTa1 indicates command with time tag CP56Time2a.
-	// InformationElementType:
+	// CTsTa1 indicates test command with time tag CP56Time2a.
+	// InformationElementType: TSC + CP56Time2a
+	// COT: 6, 7, 44, 45, 46, 47
 	CTsTa1 TypeID = 0x6b // 107
+
+	// Parameter in control direction.
+
+	// PMeNa1 indicates parameter of measured value, normalized value.
+	// InformationElementType: NVA + QPM
+	// COT: 5, 6, 7, 20, 44, 45, 46, 47
+	PMeNa1 TypeID = 0x6e // 110
+	// PMeNb1 indicates parameter of measured value, scaled value.
+	// InformationElementType: SVA + QPM
+	// COT: 5, 6, 7, 20, 44, 45, 46, 47
+	PMeNb1 TypeID = 0x6f // 111
+	// PMeNc1 indicates parameter of measured value, short floating point value.
+	// InformationElementType: IEEE754STD + QPM
+	// COT: 5, 6, 7, 20, 44, 45, 46, 47
+	PMeNc1 TypeID = 0x70 // 112
+	// PAcNa1 indicates parameter activation.
+	// InformationElementType: QPA
+	// COT: 6, 7, 8, 9, 44, 45, 46, 47
+	PAcNa1 TypeID = 0x71 // 113
+
+	// File transfer.
+
+	// FFrNa1 indicates file ready.
+	// InformationElementType: NOF + LOF + FRQ
+	// COT: 13
+	FFrNa1 TypeID = 0x78 // 120
+	// FSrNa1 indicates section ready.
+	// InformationElementType: NOF + NOS + LOF + SRQ
+	// COT: 13
+	FSrNa1 TypeID = 0x79 // 121
+	// FScNa1 indicates call directory, select file, call file, call section.
+	// InformationElementType: NOF + NOS + SCQ
+	// COT: 5, 13
+	FScNa1 TypeID = 0x7a // 122
+	// FLsNa1 indicates last section, last segment.
+	// InformationElementType: NOF + NOS + LSQ + CHS
+	// COT: 13
+	FLsNa1 TypeID = 0x7b // 123
+	// FAfNa1 indicates acknowledge file, acknowledge section.
+	// InformationElementType: NOF + NOS + AFQ
+	// COT: 13
+	FAfNa1 TypeID = 0x7c // 124
+	// FSgNa1 indicates segment.
+	// InformationElementType: NOF + NOS + LOS + segment
+	// COT: 13
+	FSgNa1 TypeID = 0x7d // 125
+	// FDrTa1 indicates directory, with SQ=1 for the entries of the directory.
+	// InformationElementType: NOF + LOF + SOF + CP56Time2a
+	// COT: 3, 5
+	FDrTa1 TypeID = 0x7e // 126
+	// FScNb1 indicates query log, request archive file.
+	// InformationElementType: NOF + CP56Time2a + CP56Time2a
+	// COT: 13
+	FScNb1 TypeID = 0x7f // 127
 )
 
+// typeNames are the names of the types defined by the standard.
+var typeNames = map[TypeID]string{
+	MSpNa1: "M_SP_NA_1", MSpTa1: "M_SP_TA_1", MDpNa1: "M_DP_NA_1", MDpTa1: "M_DP_TA_1", MMeNa1: "M_ME_NA_1",
+	MMeTa1: "M_ME_TA_1", MMeNb1: "M_ME_NB_1", MMeTb1: "M_ME_TB_1", MMeNc1: "M_ME_NC_1", MMeTc1: "M_ME_TC_1",
+	MItNa1: "M_IT_NA_1", MItTa1: "M_IT_TA_1", MMeNd1: "M_ME_ND_1", MSpTb1: "M_SP_TB_1", MDpTb1: "M_DP_TB_1",
+	MMeTd1: "M_ME_TD_1", MMeTe1: "M_ME_TE_1", MMeTf1: "M_ME_TF_1", MItTb1: "M_IT_TB_1", CScNa1: "C_SC_NA_1",
+	CDcNa1: "C_DC_NA_1", CRcNa1: "C_RC_NA_1", CSeNa1: "C_SE_NA_1", CSeNb1: "C_SE_NB_1", CSeNc1: "C_SE_NC_1",
+	CScTa1: "C_SC_TA_1", CDcTa1: "C_DC_TA_1", CSeTa1: "C_SE_TA_1", CSeTb1: "C_SE_TB_1", CSeTc1: "C_SE_TC_1",
+	MEiNa1: "M_EI_NA_1", CIcNa1: "C_IC_NA_1", CCiNa1: "C_CI_NA_1", CRdNa1: "C_RD_NA_1", CCsNa1: "C_CS_NA_1",
+	CTsNb1: "C_TS_NB_1", CRpNc1: "C_RP_NC_1", CCdNa1: "C_CD_NA_1", CTsTa1: "C_TS_TA_1", PMeNa1: "P_ME_NA_1",
+	PMeNb1: "P_ME_NB_1", PMeNc1: "P_ME_NC_1", PAcNa1: "P_AC_NA_1", FFrNa1: "F_FR_NA_1", FSrNa1: "F_SR_NA_1",
+	FScNa1: "F_SC_NA_1", FLsNa1: "F_LS_NA_1", FAfNa1: "F_AF_NA_1", FSgNa1: "F_SG_NA_1", FDrTa1: "F_DR_TA_1",
+	FScNb1: "F_SC_NB_1",
+}
+
+// Name returns the name of the type defined by the standard, for example, M_ME_NC_1 for MMeNc1, or its number if the
+// type isn't defined.
+func (t TypeID) Name() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// ParseTypeID returns the type of the name defined by the standard, such as M_ME_NC_1 or m_me_nc_1, or of its number.
+func ParseTypeID(s string) (TypeID, error) {
+	for t, name := range typeNames {
+		if strings.EqualFold(name, s) {
+			return t, nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("unknown type %q", s)
+	}
+	return TypeID(n), nil
+}
+
 func (asdu *ASDU) parseTypeID(data byte) TypeID {
 	asdu.typeID = TypeID(data)
 	return asdu.typeID
@@ -482,7 +613,9 @@ ORG (Originator Address, 1 byte) provides a method for a controlling station to
   - If there is more than one single source in a system defined, the ASDUs in monitor direction have to be directed to
     all relevant sources of the system. In this case the specific affected source has to select its specific ASDUs.
 
-TODO What's the differences between ORG and TCP endpoint (IP + PORT)? Can we identify the source by TCP endpoint?
+The TCP endpoint identifies the connection, but not the controlling station behind a gateway or after a reconnection,
+so Server records both the connection and the ORG of each command to route its confirmations, and a Client configured
+with ClientOption.SetOriginatorAddress ignores the confirmations of other originators.
 */
 type ORG uint8
 
@@ -507,6 +640,9 @@ COA (Common Address of ASDU, 2 bytes) is normally interpreted as a station addre
 */
 type COA = uint16
 
+// GlobalCOA is the global (broadcast) common address.
+const GlobalCOA COA = 0xffff
+
 func (asdu *ASDU) parseCOA(data []byte) COA {
 	asdu.coa = binary.LittleEndian.Uint16([]byte{data[0], data[1]})
 	return asdu.coa
@@ -13,11 +13,12 @@ type InformationElement struct {
 	TypeID  TypeID            `json:"type_id"`
 	Address IOA               `json:"address"`
 	Value   float64           `json:"value"`
+	Typed   TypedValue        `json:"typed,omitempty"` // the value decoded by its type, Value is converted from it
 	Raw     []byte            `json:"raw"`
 	Quality QualityDescriptor `json:"quality"` // if the value's quality is not zero, it means the value is not valid!
 	Ts      time.Time         `json:"ts"`
 
-	Format InformationElementFormat
+	Format InformationElementFormat `json:"format,omitempty"`
 
 	data   []byte
 	offset int
@@ -33,6 +34,7 @@ func (ie *InformationElement) getSIQ() {
 	ie.Format = append(ie.Format, SIQ)
 	ie.Quality = QualityDescriptor(ie.data[ie.offset] & 0xf0)
 	ie.Value = float64(parseLittleEndianUint16([]byte{ie.data[ie.offset] & 0b1, 0x00})) // 0b1 represents open; 0b0 represents close.
+	ie.Typed = SinglePoint(ie.data[ie.offset]&0b1 != 0)
 
 	ie.offset++
 }
@@ -43,6 +45,7 @@ func (ie *InformationElement) getDIQ() {
 	ie.Format = append(ie.Format, DIQ)
 	ie.Quality = QualityDescriptor(ie.data[ie.offset] & 0xf0)
 	ie.Value = float64(parseLittleEndianUint16([]byte{ie.data[ie.offset] & 0b11, 0x00})) // 0b01 represents close; 0b10 represents open.
+	ie.Typed = DoublePoint(ie.data[ie.offset] & 0b11)
 
 	ie.offset++
 }
@@ -51,7 +54,8 @@ func (ie *InformationElement) getDIQ() {
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L2637
 func (ie *InformationElement) getNVA() {
 	ie.Format = append(ie.Format, NVA)
-	ie.Value = float64(parseLittleEndianInt16(ie.data[ie.offset:ie.offset+2])) / 32768
+	normalized := Normalized(parseLittleEndianInt16(ie.data[ie.offset : ie.offset+2]))
+	ie.Value, ie.Typed = normalized.Float64(), normalized
 
 	ie.offset += 2
 }
@@ -60,7 +64,8 @@ func (ie *InformationElement) getNVA() {
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L2641
 func (ie *InformationElement) getSVA() {
 	ie.Format = append(ie.Format, SVA)
-	ie.Value = float64(parseLittleEndianInt16(ie.data[ie.offset : ie.offset+2]))
+	scaled := Scaled(parseLittleEndianInt16(ie.data[ie.offset : ie.offset+2]))
+	ie.Value, ie.Typed = scaled.Float64(), scaled
 
 	ie.offset += 2
 }
@@ -69,7 +74,8 @@ func (ie *InformationElement) getSVA() {
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L2633
 func (ie *InformationElement) getIEEESTD754() {
 	ie.Format = append(ie.Format, IEEE754STD)
-	ie.Value = float64(math.Float32frombits(parseLittleEndianUint32(ie.data[ie.offset : ie.offset+4])))
+	float := Float(math.Float32frombits(parseLittleEndianUint32(ie.data[ie.offset : ie.offset+4])))
+	ie.Value, ie.Typed = float.Float64(), float
 	ie.offset += 4
 }
 
@@ -86,6 +92,7 @@ func (ie *InformationElement) getQOS() {
 func (ie *InformationElement) getSCO() {
 	ie.Format = append(ie.Format, SCO)
 	ie.Value = float64(parseLittleEndianUint16([]byte{ie.data[ie.offset], 0x00}))
+	ie.Typed = parseCommand(ie.data[ie.offset], ie.data[ie.offset]&0b1 == 1)
 
 	ie.offset += 1
 }
@@ -95,6 +102,7 @@ func (ie *InformationElement) getSCO() {
 func (ie *InformationElement) getDCO() {
 	ie.Format = append(ie.Format, DCO)
 	ie.Value = float64(parseLittleEndianUint16([]byte{ie.data[ie.offset], 0x00}))
+	ie.Typed = parseCommand(ie.data[ie.offset], DoublePoint(ie.data[ie.offset]&0b11) == DoublePointOn)
 
 	ie.offset += 1
 }
@@ -104,10 +112,58 @@ func (ie *InformationElement) getDCO() {
 func (ie *InformationElement) getRCO() {
 	ie.Format = append(ie.Format, RCO)
 	ie.Value = float64(parseLittleEndianUint16([]byte{ie.data[ie.offset], 0x00}))
+	ie.Typed = parseCommand(ie.data[ie.offset], ie.data[ie.offset]&0b11 == 0b10) // next step higher
 
 	ie.offset += 1
 }
 
+// getQPM gets the qualifier of parameter of measured values, which follows the value of the parameter.
+func (ie *InformationElement) getQPM() {
+	ie.Format = append(ie.Format, QPM)
+
+	ie.offset++
+}
+
+// getQPA gets the qualifier of parameter activation.
+func (ie *InformationElement) getQPA() {
+	ie.Format = append(ie.Format, QPA)
+	ie.Value = float64(ie.data[ie.offset])
+
+	ie.offset++
+}
+
+// getFBP gets the fixed test bit pattern.
+func (ie *InformationElement) getFBP() {
+	ie.Format = append(ie.Format, FBP)
+	ie.Value = float64(parseLittleEndianUint16(ie.data[ie.offset : ie.offset+2]))
+
+	ie.offset += 2
+}
+
+// getTSC gets the test sequence counter.
+func (ie *InformationElement) getTSC() {
+	ie.Format = append(ie.Format, TSC)
+	ie.Value = float64(parseLittleEndianUint16(ie.data[ie.offset : ie.offset+2]))
+
+	ie.offset += 2
+}
+
+// getQRP gets the qualifier of reset process command.
+func (ie *InformationElement) getQRP() {
+	ie.Format = append(ie.Format, QRP)
+	ie.Value = float64(ie.data[ie.offset])
+
+	ie.offset++
+}
+
+// getCOI gets the cause of initialization.
+func (ie *InformationElement) getCOI() {
+	ie.Format = append(ie.Format, COI)
+	ie.Value = float64(ie.data[ie.offset])
+
+	ie.offset++
+}
+
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L1318
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L2461
 func (ie *InformationElement) getQDS() {
@@ -121,7 +177,8 @@ func (ie *InformationElement) getQDS() {
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L2605
 func (ie *InformationElement) getBCR() {
 	ie.Format = append(ie.Format, BCR)
-	ie.Value = float64(parseLittleEndianUint32(ie.data[ie.offset:ie.offset+4])) * 0.01 // data[4] is the description information.
+	ie.Value = float64(parseLittleEndianInt32(ie.data[ie.offset:ie.offset+4])) * 0.01 // data[4] is the description information.
+	ie.Typed = parseBinaryCounter(ie.data[ie.offset : ie.offset+5])
 
 	ie.offset += 5
 }
@@ -139,26 +196,85 @@ func (ie *InformationElement) getCP24Time2a() {
 	ie.offset += 3
 }
 
+// getFileTransfer sets the format of the information element of file transfer, which is decoded by the file transfer
+// procedures, and the time of creation of a directory entry.
+func (ie *InformationElement) getFileTransfer(typeID TypeID) {
+	switch typeID {
+	case FFrNa1:
+		ie.Format = append(ie.Format, NOF, LOF, FRQ)
+	case FSrNa1:
+		ie.Format = append(ie.Format, NOF, NOS, LOF, SRQ)
+	case FScNa1:
+		ie.Format = append(ie.Format, NOF, NOS, SCQ)
+	case FLsNa1:
+		ie.Format = append(ie.Format, NOF, NOS, LSQ, CHS)
+	case FAfNa1:
+		ie.Format = append(ie.Format, NOF, NOS, AFQ)
+	case FSgNa1:
+		ie.Format = append(ie.Format, NOF, NOS, LOS)
+	case FDrTa1:
+		ie.Format = append(ie.Format, NOF, LOF, SOF, CP56Time2a)
+		if len(ie.data) >= ie.offset+13 {
+			ie.Ts = parseCP56Time2a(ie.data[ie.offset+6 : ie.offset+13])
+		}
+	case FScNb1:
+		ie.Format = append(ie.Format, NOF, CP56Time2a, CP56Time2a)
+	}
+	ie.offset = len(ie.data)
+}
+
 // https://github.com/wireshark/wireshark/blob/master/epan/dissectors/packet-iec104.c#L1161
 func (ie *InformationElement) getCP56Time2a() {
-	millisecond := parseLittleEndianUint16(ie.data[ie.offset : ie.offset+2])
+	ie.Ts = parseCP56Time2a(ie.data[ie.offset : ie.offset+7])
+	ie.offset += 7
+}
+
+// getCP16Time2a gets the 2-byte binary time in milliseconds.
+func (ie *InformationElement) getCP16Time2a() {
+	ie.Format = append(ie.Format, CP16Time2a)
+	ie.Value = float64(parseLittleEndianUint16(ie.data[ie.offset : ie.offset+2]))
+
+	ie.offset += 2
+}
+
+// parseCP56Time2a parses the 7-byte binary time.
+func parseCP56Time2a(data []byte) time.Time {
+	millisecond := parseLittleEndianUint16(data[0:2])
 	nanosecond := (int(millisecond) % 1000) * int(time.Millisecond)
 	second := int(millisecond / 1000)
-	minute := int(ie.data[ie.offset+2] & 0x3f)
-	hour := int(ie.data[ie.offset+3] & 0x1f)
-	day := int(ie.data[ie.offset+4] & 0x1f)
-	month := int(ie.data[ie.offset+5] & 0x0f)
-	year := int(ie.data[ie.offset+6]&0x7f) + 2000
+	minute := int(data[2] & 0x3f)
+	hour := int(data[3] & 0x1f)
+	day := int(data[4] & 0x1f)
+	month := int(data[5] & 0x0f)
+	year := int(data[6]&0x7f) + 2000
 	if year < 70 {
 		year += 100
 	}
 
-	ie.Ts = time.Date(year, time.Month(month), day, hour, minute, second, nanosecond, time.Local)
-	ie.offset += 7
+	return time.Date(year, time.Month(month), day, hour, minute, second, nanosecond, time.Local)
+}
+
+// serializeCP56Time2a serializes the time in the local time zone to the 7-byte binary time, the inverse of
+// parseCP56Time2a.
+func serializeCP56Time2a(t time.Time) []byte {
+	t = t.In(time.Local)
+	data := make([]byte, 7)
+	copy(data, serializeLittleEndianUint16(uint16(t.Second()*1000+t.Nanosecond()/int(time.Millisecond))))
+	data[2] = byte(t.Minute())
+	data[3] = byte(t.Hour())
+	weekday := int(t.Weekday()) // 1-7 is Monday-Sunday
+	if weekday == 0 {
+		weekday = 7
+	}
+	data[4] = byte(weekday<<5 | t.Day())
+	data[5] = byte(t.Month())
+	data[6] = byte(t.Year() % 100)
+	return data
 }
 
 func (asdu *ASDU) parseInformationElement(data []byte, ie *InformationElement) {
 	ie.data = data
+	ie.Raw = data
 
 	switch asdu.typeID {
 	case MSpNa1:
@@ -424,22 +540,22 @@ func (asdu *ASDU) parseInformationElement(data []byte, ie *InformationElement) {
 		}
 		asdu.toBeHandled = true
 		asdu.sendSFrame = true
+	case MEiNa1:
+		ie.getCOI()
+		_lg.Debugf("receive i frame: end of initialization with COI[%d] [初始化结束]", uint8(ie.Value))
+		asdu.toBeHandled = true
 	case CScNa1:
 		ie.getSCO()
 		switch asdu.cot {
 		case CotActCon:
 			if ie.Value == 0x80 {
 				_lg.Debugf("receive i frame: select confirmation of single command - open [单点命令遥控选择确认 - 分闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else if ie.Value == 0x81 {
 				_lg.Debugf("receive i frame: select confirmation of single command - close [单点命令遥控选择确认 - 合闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else if ie.Value == 0x00 {
 				_lg.Debugf("receive i frame: execute confirmation of single command - open [单点命令遥控执行确认 - 分闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else if ie.Value == 0x01 {
 				_lg.Debugf("receive i frame: execute confirmation of single command - close [单点命令遥控执行确认 - 合闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else {
 				_lg.Debugf("receive i frame: confirmation of single command [单点命令确认]")
 			}
@@ -453,9 +569,6 @@ func (asdu *ASDU) parseInformationElement(data []byte, ie *InformationElement) {
 			}
 		case CotActTerm:
 			_lg.Debugf("receive i frame: termination of single command [单点命令激活终止]")
-			asdu.cmdRsp = &cmdRsp{
-				err: errSingleCmdTerm{},
-			}
 		}
 	case CDcNa1:
 		ie.getDCO()
@@ -463,16 +576,12 @@ func (asdu *ASDU) parseInformationElement(data []byte, ie *InformationElement) {
 		case CotActCon:
 			if ie.Value == 0x81 {
 				_lg.Debugf("receive i frame: select confirmation of double command - open [双点命令遥控选择确认 - 分闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else if ie.Value == 0x82 {
 				_lg.Debugf("receive i frame: select confirmation of double command - close [双点命令遥控选择确认 - 合闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else if ie.Value == 0x01 {
 				_lg.Debugf("receive i frame: execute confirmation of double command - open [双点命令遥控执行确认 - 分闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else if ie.Value == 0x02 {
 				_lg.Debugf("receive i frame: execute confirmation of double command - close [双点命令遥控执行确认 - 合闸]")
-				asdu.cmdRsp = &cmdRsp{}
 			} else {
 				_lg.Debugf("receive i frame: confirmation of double command [双点命令激活确认]")
 			}
@@ -486,10 +595,44 @@ func (asdu *ASDU) parseInformationElement(data []byte, ie *InformationElement) {
 			}
 		case CotActTerm:
 			_lg.Debugf("receive i frame: termination of double command [双点命令激活终止]")
-			asdu.cmdRsp = &cmdRsp{
-				err: errSingleCmdTerm{},
-			}
 		}
+	case CRcNa1:
+		ie.getRCO()
+		_lg.Debugf("receive i frame: regulating step command at %d with COT[%d] [调节步命令]", ie.Address, asdu.cot)
+	case CSeNa1, CSeTa1:
+		ie.getNVA()
+		ie.getQOS()
+		if asdu.typeID >= CSeTa1 {
+			ie.getCP56Time2a()
+		}
+		_lg.Debugf("receive i frame: set-point command, normalized value at %d is %f with COT[%d] [归一化值设定命令]",
+			ie.Address, ie.Value, asdu.cot)
+	case CSeNb1, CSeTb1:
+		ie.getSVA()
+		ie.getQOS()
+		if asdu.typeID >= CSeTa1 {
+			ie.getCP56Time2a()
+		}
+		_lg.Debugf("receive i frame: set-point command, scaled value at %d is %f with COT[%d] [标度化值设定命令]",
+			ie.Address, ie.Value, asdu.cot)
+	case CSeNc1, CSeTc1:
+		ie.getIEEESTD754()
+		ie.getQOS()
+		if asdu.typeID >= CSeTa1 {
+			ie.getCP56Time2a()
+		}
+		_lg.Debugf("receive i frame: set-point command, short floating point value at %d is %f with COT[%d] "+
+			"[短浮点数设定命令]", ie.Address, ie.Value, asdu.cot)
+	case CScTa1:
+		ie.getSCO()
+		ie.getCP56Time2a()
+		_lg.Debugf("receive i frame: single command with time tag at %d with COT[%d] [带时标的单点命令]", ie.Address,
+			asdu.cot)
+	case CDcTa1:
+		ie.getDCO()
+		ie.getCP56Time2a()
+		_lg.Debugf("receive i frame: double command with time tag at %d with COT[%d] [带时标的双点命令]", ie.Address,
+			asdu.cot)
 	case CIcNa1:
 		switch asdu.cot {
 		case CotActCon:
@@ -506,8 +649,51 @@ func (asdu *ASDU) parseInformationElement(data []byte, ie *InformationElement) {
 			_lg.Debugf("receive i frame: termination of counter interrogation [总电度结束]")
 			asdu.sendSFrame = true
 		}
+	case CTsNb1:
+		ie.getFBP()
+		_lg.Debugf("receive i frame: test command with FBP[%04X] and COT[%d] [测试命令]", uint16(ie.Value), asdu.cot)
+	case CRpNc1:
+		ie.getQRP()
+		_lg.Debugf("receive i frame: reset process command with QRP[%d] and COT[%d] [复位进程命令]", uint8(ie.Value),
+			asdu.cot)
+	case CCdNa1:
+		ie.getCP16Time2a()
+		_lg.Debugf("receive i frame: delay acquisition command with %d ms and COT[%d] [延时获得命令]",
+			uint16(ie.Value), asdu.cot)
+	case CTsTa1:
+		ie.getTSC()
+		ie.getCP56Time2a()
+		_lg.Debugf("receive i frame: test command with TSC[%d] and time tag [%s] and COT[%d] [带时标的测试命令]",
+			uint16(ie.Value), ie.Ts, asdu.cot)
+	case PMeNa1:
+		ie.getNVA()
+		ie.getQPM()
+		_lg.Debugf("receive i frame: parameter of measured value, normalized value at %d is %f with COT[%d] "+
+			"[归一化值参数]", ie.Address, ie.Value, asdu.cot)
+		asdu.toBeHandled = true
+	case PMeNb1:
+		ie.getSVA()
+		ie.getQPM()
+		_lg.Debugf("receive i frame: parameter of measured value, scaled value at %d is %f with COT[%d] "+
+			"[标度化值参数]", ie.Address, ie.Value, asdu.cot)
+		asdu.toBeHandled = true
+	case PMeNc1:
+		ie.getIEEESTD754()
+		ie.getQPM()
+		_lg.Debugf("receive i frame: parameter of measured value, short floating point value at %d is %f "+
+			"with COT[%d] [短浮点数参数]", ie.Address, ie.Value, asdu.cot)
+		asdu.toBeHandled = true
+	case PAcNa1:
+		ie.getQPA()
+		_lg.Debugf("receive i frame: parameter activation at %d with COT[%d] [参数激活]", ie.Address, asdu.cot)
+		asdu.toBeHandled = true
+	case FFrNa1, FSrNa1, FScNa1, FLsNa1, FAfNa1, FSgNa1, FDrTa1, FScNb1:
+		ie.getFileTransfer(asdu.typeID)
+		_lg.Debugf("receive i frame: file transfer TypeID[%X] with COT[%d] at %d [文件传输]", asdu.typeID, asdu.cot,
+			ie.Address)
+		asdu.toBeHandled = true
 	default:
-		_lg.Warnf("unsupported type: TypeID[%X], COT[%X]", asdu.typeID, asdu.cot)
+		_lg.Debugf("unsupported type: TypeID[%X], COT[%X]", asdu.typeID, asdu.cot)
 	}
 }
 
@@ -676,9 +862,9 @@ const (
 	// Length: 3 bytes
 	// TypeID:
 	CP24Time2a
-	// CP16Time2a indicates 2-byte binary time/
+	// CP16Time2a indicates 2-byte binary time, the milliseconds 0-59999.
 	// Length: 2 bytes
-	// TypeID:
+	// TypeID: 106
 	CP16Time2a
 
 	// Qualifiers
@@ -693,11 +879,11 @@ const (
 	QCC
 	// QPM indicates qualifier of parameter of measured values.
 	// Length: 1 byte
-	// TypeID: 110,112
+	// TypeID: 110,111,112
 	QPM
 	// QPA indicates qualifier of parameter activation.
 	// Length: 1 byte
-	// TypeID: 111,113
+	// TypeID: 113
 	QPA
 	// QRP indicates qualifier of reset process command.
 	// Length: 1 byte
@@ -739,7 +925,7 @@ const (
 	// TypeID: 120,121,122,123,124,125,126
 	NOF
 	// NOS indicates name of section.
-	// Length: 2 bytes
+	// Length: 1 byte
 	// TypeID: 121,122,123,124,125
 	NOS
 	// LOF indicates length of file or section.
@@ -769,6 +955,10 @@ const (
 	// Length: 2 bytes
 	// TypeID: 104
 	FBP
+	// TSC indicates test sequence counter.
+	// Length: 2 bytes
+	// TypeID: 107
+	TSC
 )
 
 type QualityDescriptor byte
@@ -1,6 +1,9 @@
 package iec104
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 /*
 InformationObject . Each information object is addressed by Information Object
@@ -54,6 +57,15 @@ type InformationObject struct {
 	ies []*InformationElement
 }
 
+// NewInformationObject creates an information object addressed by ioa which consists of the information elements.
+// The Raw field of each information element is what is transmitted.
+func NewInformationObject(ioa IOA, ies ...*InformationElement) *InformationObject {
+	return &InformationObject{
+		ioa: ioa,
+		ies: ies,
+	}
+}
+
 func (i *InformationObject) Data() []byte {
 	data := make([]byte, 0)
 	data = append(data, i.serializeIOA()...)
@@ -79,7 +91,6 @@ func (i *InformationObject) parseCP24Time(data []byte) int32 {
 		return 0
 	}
 	panic(any("implement me"))
-	return 0
 }
 
 func (i *InformationObject) parseCP56Time(data []byte) int64 {
@@ -87,22 +98,71 @@ func (i *InformationObject) parseCP56Time(data []byte) int64 {
 		return 0
 	}
 	panic(any("implement me"))
-	return 0
 }
 
-func (asdu *ASDU) parseInformationObjects(asduBody []byte) {
+// elementLengths are the lengths of the information elements of the types, without the IOA. The segment of
+// F_SG_NA_1 is not included, its length is given by the element.
+var elementLengths = map[TypeID]int{
+	MSpNa1: 1, MSpTa1: 4, MDpNa1: 1, MDpTa1: 4, MMeNa1: 3, MMeTa1: 6, MMeNb1: 3, MMeTb1: 6, MMeNc1: 5, MMeTc1: 8,
+	MItNa1: 5, MItTa1: 8, MMeNd1: 2, MSpTb1: 8, MDpTb1: 8, MMeTd1: 10, MMeTe1: 10, MMeTf1: 12, MItTb1: 12,
+	CScNa1: 1, CDcNa1: 1, CRcNa1: 1, CSeNa1: 3, CSeNb1: 3, CSeNc1: 5, CScTa1: 8, CDcTa1: 8, CSeTa1: 10, CSeTb1: 10,
+	CSeTc1: 12, MEiNa1: 1, CIcNa1: 1, CCiNa1: 1, CRdNa1: 0, CCsNa1: 7, CTsNb1: 2, CRpNc1: 1, CCdNa1: 2, CTsTa1: 9,
+	PMeNa1: 3, PMeNb1: 3, PMeNc1: 5, PAcNa1: 1, FFrNa1: 6, FSrNa1: 7, FScNa1: 4, FLsNa1: 5, FAfNa1: 4, FSgNa1: 4,
+	FDrTa1: 13, FScNb1: 16,
+}
+
+// elementLength returns the length of every information element of the ASDU body, without the IOA, or an error if
+// the length of the body doesn't match the number of objects, so that a malformed ASDU never reaches the parsers of
+// the elements. The body of a type unknown is split evenly into the objects.
+func (asdu *ASDU) elementLength(asduBody []byte) (int, error) {
+	n := int(asdu.nObjs)
+	size, ok := elementLengths[asdu.typeID]
+	switch {
+	case asdu.typeID == FSgNa1 && len(asduBody) >= IOALength+size:
+		size += int(asduBody[IOALength+3]) // LOS
+		if n != 1 {
+			return 0, &FramingError{Reason: "invalid number of segments", Data: asdu.raw}
+		}
+	case !ok && bool(asdu.sq) && len(asduBody) >= IOALength && (len(asduBody)-IOALength)%n == 0:
+		size = (len(asduBody) - IOALength) / n
+	case !ok && !bool(asdu.sq) && len(asduBody)%n == 0 && len(asduBody)/n >= IOALength:
+		size = len(asduBody)/n - IOALength
+	case !ok:
+		return 0, &FramingError{Reason: "invalid length of information objects", Data: asdu.raw}
+	}
+	want := n * (IOALength + size)
+	if asdu.sq {
+		want = IOALength + n*size
+	}
+	if len(asduBody) != want {
+		return 0, &FramingError{
+			Reason: fmt.Sprintf("invalid length of information objects, expected %d bytes, got %d", want,
+				len(asduBody)),
+			Data: asdu.raw,
+		}
+	}
+	return size, nil
+}
+
+func (asdu *ASDU) parseInformationObjects(asduBody []byte) error {
 	ios := make([]*InformationObject, 0)
 	signals := make([]*InformationElement, 0)
 	defer func() {
 		asdu.ios = ios
 		asdu.Signals = signals
 	}()
+	if asdu.nObjs == 0 {
+		return nil
+	}
+	size, err := asdu.elementLength(asduBody)
+	if err != nil {
+		return err
+	}
 
 	if asdu.sq {
 		io := &InformationObject{}
 		io.parseIOA(asduBody[:IOALength])
 
-		size := (len(asduBody) - IOALength) / int(asdu.nObjs)
 		for i := 0; i < int(asdu.nObjs); i++ {
 			ie := &InformationElement{
 				TypeID:  asdu.typeID,
@@ -113,8 +173,9 @@ func (asdu *ASDU) parseInformationObjects(asduBody []byte) {
 
 			signals = append(signals, ie)
 		}
+		ios = append(ios, io)
 	} else {
-		size := len(asduBody) / int(asdu.nObjs)
+		size += IOALength
 		for i := 0; i < int(asdu.nObjs); i++ {
 			io := &InformationObject{}
 			io.parseIOA(asduBody[i*size : i*size+3])
@@ -131,6 +192,7 @@ func (asdu *ASDU) parseInformationObjects(asduBody []byte) {
 			ios = append(ios, io)
 		}
 	}
+	return nil
 }
 
 const (
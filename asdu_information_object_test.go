@@ -1,6 +1,9 @@
 package iec104
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestInformationObject_parseIOA(t *testing.T) {
 	type args struct {
@@ -82,3 +85,53 @@ func TestInformationObject_parseIOA(t *testing.T) {
 		})
 	}
 }
+
+func TestASDU_parseInformationObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		signals int
+		wantErr bool
+	}{
+		{"test command without FBP", []byte{0x68, 0x01, 0x06, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}, 0, true},
+		{"test command", []byte{0x68, 0x01, 0x06, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0xaa, 0x55}, 1, false},
+		{"test command too long", []byte{0x68, 0x01, 0x06, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0xaa, 0x55, 0x00}, 0,
+			true},
+		{"two floats", []byte{0x0d, 0x02, 0x03, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0, 0, 0x80, 0x3f, 0x00, 0x02,
+			0x00, 0x00, 0, 0, 0, 0x40, 0x00}, 2, false},
+		{"one float of two", []byte{0x0d, 0x02, 0x03, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0, 0, 0x80, 0x3f, 0x00}, 0,
+			true},
+		{"sequence of single points", []byte{0x01, 0x83, 0x14, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01},
+			3, false},
+		{"sequence of single points without IOA", []byte{0x01, 0x83, 0x14, 0x00, 0x01, 0x00, 0x01, 0x00}, 0, true},
+		{"sequence of single points too short", []byte{0x01, 0x83, 0x14, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x01},
+			0, true},
+		{"segment", []byte{0x7d, 0x01, 0x0d, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x02, 0xaa, 0xbb},
+			1, false},
+		{"truncated segment", []byte{0x7d, 0x01, 0x0d, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x02,
+			0xaa}, 0, true},
+		{"unknown type", []byte{0x14, 0x02, 0x03, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0xff, 0x02, 0x00, 0x00, 0xff},
+			2, false},
+		{"unknown type too short", []byte{0x14, 0x02, 0x03, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asdu := new(ASDU)
+			err := asdu.Parse(tt.data)
+			var fe *FramingError
+			if tt.wantErr != errors.As(err, &fe) {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(asdu.Signals) != tt.signals {
+				t.Errorf("Parse() signals = %d, want %d", len(asdu.Signals), tt.signals)
+			}
+		})
+	}
+
+	// the I-frame of a test command with only the IOA closes the connection instead of crashing the process
+	var fe *FramingError
+	if err := new(APDU).Parse([]byte{0x00, 0x00, 0x00, 0x00, 0x68, 0x01, 0x06, 0x00, 0x01, 0x00, 0x00, 0x00,
+		0x00}); !errors.As(err, &fe) {
+		t.Errorf("Parse() error = %v, want a framing error", err)
+	}
+}
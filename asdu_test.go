@@ -50,6 +50,37 @@ func TestParseTypeID(t *testing.T) {
 		})
 	}
 }
+func TestTypeID_Name(t *testing.T) {
+	tests := []struct {
+		name string
+		want TypeID
+	}{
+		{"M_SP_NA_1", MSpNa1},
+		{"M_ME_TF_1", MMeTf1},
+		{"C_SE_NC_1", CSeNc1},
+		{"F_SC_NB_1", FScNb1},
+		{"200", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.want.Name(); got != tt.name {
+				t.Errorf("Name() = %v, want %v", got, tt.name)
+			}
+			if got, err := ParseTypeID(tt.name); err != nil || got != tt.want {
+				t.Errorf("ParseTypeID() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+	if got, err := ParseTypeID("c_sc_na_1"); err != nil || got != CScNa1 {
+		t.Errorf("ParseTypeID() of lower case = %v, %v", got, err)
+	}
+	for _, s := range []string{"", "0", "256", "M_XX_NA_1"} {
+		if _, err := ParseTypeID(s); err == nil {
+			t.Errorf("ParseTypeID(%q) must fail", s)
+		}
+	}
+}
+
 func TestParseSQ(t *testing.T) {
 	type args struct {
 		data byte
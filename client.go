@@ -5,100 +5,151 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func NewClient(option *ClientOption) *Client {
-	return &Client{
-		ClientOption: option,
+const (
+	statusInitial int32 = iota
+	statusConnected
+	statusDisconnected
+)
 
-		org: ORG(0),
-		coa: COA(0x0001),
+const (
+	dataChanSize   = 64 // received APDUs buffered for the handler
+	framesChanSize = 32 // frames buffered for the writing goroutine
+)
 
-		sendChan:   make(chan []byte, 1),
-		recvChan:   make(chan *APDU),
-		dataChan:   make(chan *APDU),
-		cmdRspChan: make(chan *cmdRsp, 0),
-		isExec:     false,
-		Signals:    make(map[IOA]float64),
-	}
+var errNotConnected = errors.New("not connected")
+
+func NewClient(option *ClientOption) *Client {
+	return NewClientWithCoaAddress(option, COA(0x0001))
 }
 
 func NewClientWithCoaAddress(option *ClientOption, coaAddress COA) *Client {
+	option.defaults()
 	return &Client{
 		ClientOption: option,
-		org:          ORG(0),
 		coa:          coaAddress,
 
-		sendChan:   make(chan []byte, 1),
-		recvChan:   make(chan *APDU),
-		dataChan:   make(chan *APDU),
-		cmdRspChan: make(chan *cmdRsp, 0),
-		isExec:     false,
-		Signals:    make(map[IOA]float64),
+		recvChan:  make(chan *APDU, 1),
+		dataChan:  make(chan *APDU, dataChanSize),
+		pending:   make(map[pendingKey][]chan *ASDU),
+		transfers: make(map[COA]*transfer),
+		delays:    make(map[COA]time.Duration),
+		image:     newProcessImage(option.stalePeriod),
 	}
 }
 
-// Client in IEC 104 is also called as master or controlling station.
+/*
+Client in IEC 104 is also called as master or controlling station.
+
+The protocol state of a connection, that is, the sequence numbers, the unacknowledged I-frames and the timers t1 and
+t2, is owned by the event loop of the connection. The other goroutines only hand frames over to the event loop, so the
+methods of Client may be called from any goroutine.
+*/
 type Client struct {
 	*ClientOption
-	conn net.Conn // network channel with the iec104 substation/server
 
-	cancel     context.CancelFunc
-	sendChan   chan []byte // send data to server
-	recvChan   chan *APDU  // receive apdu from server
-	dataChan   chan *APDU  // make Client owner to handle data received from server by themselves
-	cmdRspChan chan *cmdRsp
+	mu     sync.Mutex // guards the current connection: conn, ctx, cancel and out
+	conn   net.Conn   // network channel with the iec104 substation/server
+	ctx    context.Context
+	cancel context.CancelFunc
+	out    *outbox // frames to be sent by the event loop of the connection
 
-	org      ORG    // originator address to identify controlling station when there are multiple controlling stations
-	coa      COA    // common address (or station address)
-	ssn, rsn uint16 // send sequence number, receive sequence number
-	ifn      uint16 // i-format frame number (for send S-frame data regularity)
+	recvChan chan *APDU // confirmations of U-frame functions
+	dataChan chan *APDU // make Client owner to handle data received from server by themselves
 
-	status int32 // initial, connected, disconnected
+	pendingMutex sync.Mutex
+	pending      map[pendingKey][]chan *ASDU // commands waiting for their confirmations
+	transfers    map[COA]*transfer           // file transfers waiting for the ASDUs of their stations
 
-	isExec       bool
-	Signals      map[IOA]float64
-	SignalsMutex sync.Mutex
+	coa COA // common address (or station address)
+
+	status int32      // initial, connected, disconnected
+	uMutex sync.Mutex // only one U-frame function can be activated at the same time
+
+	srv    *Server          // server which serves the connection when it is a connection of a controlled station
+	group  *RedundancyGroup // redundancy group of the connection when it is served by Server
+	policy *ClientPolicy    // policy of the controlling station when it is served by Server
+
+	image *ProcessImage // the latest state of the points received from the controlled stations
+	tsc   uint32        // test sequence counter of the latest test command
+	acked uint32        // N(R) of the latest acknowledgement sent to the peer
+
+	admit func(apdu *APDU) bool // drops the received ASDU if it returns false, set by RedundantClient
+
+	delaysMutex sync.Mutex
+	delays      map[COA]time.Duration // transmission delays acquired by AcquireDelay
+
+	eventsMutex sync.Mutex
+	events      chan Event // created by Events
 }
 
 func (c *Client) Connect() error {
-	if err := c.dial(); err != nil {
+	conn, err := c.dial()
+	if err != nil {
 		return err
 	}
 
-	// After the establishment of a TCP connection, send and receive sequence number should be set to zero.
-	c.ssn, c.rsn = 0, 0
-
-	ctx, cancel := context.WithCancel(context.Background())
-	c.cancel = cancel
-	go c.writingToSocket(ctx)
-	go c.readingFromSocket(ctx)
+	ctx := c.start(conn)
 	go c.handlingData(ctx)
+	c.emit(ctx, ConnectionEvent{State: ConnectionConnected})
 
 	c.onConnectHandler(c)
 	return nil
 }
-func (c *Client) dial() (err error) {
+func (c *Client) dial() (conn net.Conn, err error) {
 	schema, address, timeout := c.server.Scheme, c.server.Host, c.connectTimeout
-	var conn net.Conn
 	switch schema {
 	case "tcp":
-		conn, err = net.DialTimeout("tcp", address, timeout)
+		return net.DialTimeout("tcp", address, timeout)
 	case "ssl", "tls", "tcps":
-		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, c.tc)
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, c.tc)
 	default:
-		return fmt.Errorf("unknown schema: %s", schema)
+		return nil, fmt.Errorf("unknown schema: %s", schema)
 	}
-	if err != nil {
-		return err
+}
+
+// start starts the goroutines of the connection: reading from the socket, writing to the socket and the event loop.
+// After the establishment of a TCP connection, send and receive sequence numbers start from zero.
+func (c *Client) start(conn net.Conn) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := newOutbox()
+	c.mu.Lock()
+	c.conn, c.ctx, c.cancel, c.out = conn, ctx, cancel, out
+	c.mu.Unlock()
+	atomic.StoreInt32(&c.status, statusConnected)
+	atomic.StoreUint32(&c.acked, 0)
+
+	frames := make(chan []byte, framesChanSize)
+	apdus := make(chan *APDU)
+	go c.writingToSocket(ctx, conn, frames)
+	go c.readingFromSocket(ctx, conn, apdus)
+	go c.running(ctx, out, frames, apdus)
+	return ctx
+}
+
+// session returns the context and the outbox of the current connection.
+func (c *Client) session() (context.Context, *outbox) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ctx, c.out
+}
+
+func (c *Client) remoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
 	}
-	c.conn = conn
-	return
+	return c.conn.RemoteAddr()
 }
 
-func (c *Client) writingToSocket(ctx context.Context) {
+func (c *Client) writingToSocket(ctx context.Context, conn net.Conn, frames <-chan []byte) {
 	_lg.Info("start goroutine for writing to socket")
 	defer func() {
 		_lg.Info("stop goroutine for writing to socket")
@@ -108,76 +159,255 @@ func (c *Client) writingToSocket(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case data := <-c.sendChan:
-			if _, err := c.conn.Write(data); err != nil {
-				_lg.Errorf("write to socket: %s", err.Error())
+		case frame := <-frames:
+			if _, err := conn.Write(frame); err != nil {
+				c.lost(ctx, fmt.Errorf("write to socket: %v", err))
+				return
 			}
 		}
 	}
 }
-func (c *Client) readingFromSocket(ctx context.Context) {
+func (c *Client) readingFromSocket(ctx context.Context, conn net.Conn, apdus chan<- *APDU) {
 	_lg.Info("start goroutine for reading from socket")
 	defer func() {
 		_lg.Info("stop goroutine for reading from socket")
 	}()
 
 	for {
+		apdu, err := c.readFromSocket(conn)
+		if err != nil {
+			c.lost(ctx, fmt.Errorf("read from socket: %v", err))
+			return
+		}
 		select {
+		case apdus <- apdu:
 		case <-ctx.Done():
 			return
-		default:
-			apdu, err := c.readFromSocket(ctx)
-			if err != nil {
-				panic(any(fmt.Errorf("read from socket: %v", err)))
-			}
-
-			switch apdu.frame.Type() {
-			case FrameTypeU:
-				uFrame, ok := apdu.frame.(*UFrame)
-				if ok {
-					switch uFrame.Cmd[0] {
-					case UFrameFunctionStartDTA[0]:
-						_lg.Debugf("receive u frame: StartDTA")
-						c.sendUFrame(UFrameFunctionStartDTC)
-					case UFrameFunctionStartDTC[0]:
-						_lg.Debugf("receive u frame: StartDTC")
-						c.recvChan <- apdu
-					case UFrameFunctionStopDTA[0]:
-						_lg.Debugf("receive u frame: StopDTA")
-					case UFrameFunctionStopDTC[0]:
-						_lg.Debugf("receive u frame: StopDTC")
-						c.recvChan <- apdu
-					case UFrameFunctionTestFA[0]:
-						_lg.Debugf("receive u frame: TestFA")
-						c.sendUFrame(UFrameFunctionTestFC)
-					case UFrameFunctionTestFC[0]:
-						_lg.Debugf("receive u frame: TestFC")
-						c.sendUFrame(UFrameFunctionTestFC)
-					}
-				}
-			case FrameTypeI:
-				if !c.isExec {
-					c.SendTestFrame()
-				}
-				c.isExec = false
-			}
 		}
 	}
 }
-func (c *Client) readFromSocket(ctx context.Context) (*APDU, error) {
-	apduLen, err := c.readApduHeader()
+func (c *Client) readFromSocket(conn net.Conn) (*APDU, error) {
+	apduLen, err := c.readApduHeader(conn)
 	if err != nil {
 		return nil, err
 	}
-	// c.conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.readApduBody(conn, apduLen)
+}
 
-	apdu, err := c.readApduBody(apduLen)
-	if err != nil {
+// readApduHeader reads both startByte and apduLen, and returns apduLen
+func (c *Client) readApduHeader(conn net.Conn) (uint8, error) {
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return 0, err
+	}
+	if buf[0] != startByte {
+		return 0, &FramingError{Reason: fmt.Sprintf("unexpected start, expected % X", startByte), Data: buf}
+	}
+	return buf[1], nil
+}
+func (c *Client) readApduBody(conn net.Conn, apduLen uint8) (*APDU, error) {
+	apduData := make([]byte, apduLen)
+	if _, err := io.ReadFull(conn, apduData); err != nil {
+		return nil, err
+	}
+	_lg.Debugf("receive: [% X]", append([]byte{startByte, apduLen}, apduData...))
+
+	apdu := new(APDU)
+	if err := apdu.Parse(apduData); err != nil {
 		return nil, err
 	}
 	return apdu, nil
 }
 
+// running is the event loop of the connection. It receives the APDUs read from the socket, sends the frames handed
+// over by other goroutines within the send window k, and supervises the acknowledgements by t1 and t2.
+func (c *Client) running(ctx context.Context, out *outbox, frames chan<- []byte, apdus <-chan *APDU) {
+	_lg.Info("start goroutine for the event loop of the connection")
+	defer func() {
+		_lg.Info("stop goroutine for the event loop of the connection")
+	}()
+
+	send := func(frame []byte) bool {
+		select {
+		case frames <- frame:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	tx := new(transmission)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		if !c.flush(tx, out, send) {
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if deadline, ok := tx.deadline(c.t1); ok {
+			timer.Reset(time.Until(deadline))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-out.wakeup:
+		case apdu := <-apdus:
+			if err := c.receive(ctx, tx, out, apdu); err != nil {
+				c.emit(ctx, ProtocolErrorEvent{Err: err})
+				c.lost(ctx, err)
+				return
+			}
+		case now := <-timer.C:
+			if err := tx.expire(now, c.t1); err != nil {
+				c.emit(ctx, ProtocolErrorEvent{Err: err})
+				c.lost(ctx, err)
+				return
+			}
+		}
+	}
+}
+
+// flush sends the U-frames, then the I-frames as long as the send window isn't full, and an S-frame if the received
+// I-frames have to be acknowledged and no I-frame did it.
+func (c *Client) flush(tx *transmission, out *outbox, send func([]byte) bool) bool {
+	uFrames, ack := out.takeUFrames()
+	for _, x := range uFrames {
+		frame := c.buildFrame(x)
+		_lg.Debugf("send u frame: %s - [% X]", uFrameName(x), frame)
+		if !send(frame) {
+			return false
+		}
+	}
+
+	for len(tx.unacked) < c.k {
+		ob := out.nextIFrame()
+		if ob == nil {
+			break
+		}
+		apci := &IFrame{
+			SendSN: tx.ssn,
+			RecvSN: tx.rsn,
+		}
+		frame := c.buildFrame(append(apci.Data(), ob.asdu...))
+		_lg.Debugf("send i frame: [% X]", frame)
+		if !send(frame) {
+			return false
+		}
+		tx.unacked = append(tx.unacked, sentFrame{ssn: tx.ssn, at: time.Now()})
+		tx.received, tx.ackNow = 0, false
+		atomic.StoreUint32(&c.acked, uint32(tx.rsn))
+		if ob.sent != nil {
+			ob.sent(tx.ssn)
+		}
+		tx.incSsn()
+	}
+
+	if ack || tx.ackNow {
+		frame := c.buildFrame((&SFrame{RecvSN: tx.rsn}).Data())
+		_lg.Debugf("send s frame: [% X]", frame)
+		if !send(frame) {
+			return false
+		}
+		tx.received, tx.ackNow = 0, false
+		atomic.StoreUint32(&c.acked, uint32(tx.rsn))
+	}
+	return true
+}
+
+// receive processes the APDU read from the socket, an error closes the connection.
+func (c *Client) receive(ctx context.Context, tx *transmission, out *outbox, apdu *APDU) error {
+	switch frame := apdu.frame.(type) {
+	case *UFrame:
+		switch frame.Cmd[0] {
+		case UFrameFunctionStartDTA[0]:
+			_lg.Debugf("receive u frame: StartDTA")
+			out.pushUFrame(UFrameFunctionStartDTC)
+			if c.group != nil {
+				c.group.start(c)
+				c.srv.announceInitialization(c)
+			}
+		case UFrameFunctionStartDTC[0]:
+			_lg.Debugf("receive u frame: StartDTC")
+			c.confirm(apdu)
+		case UFrameFunctionStopDTA[0]:
+			_lg.Debugf("receive u frame: StopDTA")
+			out.pushUFrame(UFrameFunctionStopDTC)
+			if c.group != nil {
+				c.group.stop(c)
+			}
+		case UFrameFunctionStopDTC[0]:
+			_lg.Debugf("receive u frame: StopDTC")
+			c.confirm(apdu)
+		case UFrameFunctionTestFA[0]:
+			_lg.Debugf("receive u frame: TestFA")
+			out.pushUFrame(UFrameFunctionTestFC)
+		case UFrameFunctionTestFC[0]:
+			_lg.Debugf("receive u frame: TestFC")
+			c.confirm(apdu)
+		}
+	case *SFrame:
+		if err := tx.ack(frame.RecvSN); err != nil {
+			return err
+		}
+		if c.group != nil {
+			c.group.ack(c, frame.RecvSN)
+		}
+	case *IFrame:
+		if frame.SendSN != tx.rsn {
+			return &SequenceError{Number: "N(S)", Received: frame.SendSN, Expected: tx.rsn}
+		}
+		tx.incRsn()
+		if err := tx.ack(frame.RecvSN); err != nil {
+			return err
+		}
+		if c.group != nil {
+			c.group.ack(c, frame.RecvSN)
+		}
+		if tx.received == 0 {
+			tx.t2 = time.Now().Add(c.t2)
+		}
+		tx.received++
+		if tx.received >= c.w || apdu.ASDU.sendSFrame {
+			tx.ackNow = true
+		}
+		c.dispatch(ctx, apdu)
+	}
+	return nil
+}
+
+// dispatch hands the received I-frame over to the command waiting for it, and to the handler or the events.
+func (c *Client) dispatch(ctx context.Context, apdu *APDU) {
+	if c.srv != nil {
+		if !c.srv.accept(c, apdu.ASDU) || !c.srv.authorize(c, apdu.ASDU) {
+			return
+		}
+		c.srv.record(c, apdu.ASDU)
+	} else if isResponse(apdu.ASDU) && apdu.org != c.org {
+		_lg.Debugf("ignore TypeID[%X] with COT[%d] to ORG[%d]", apdu.typeID, apdu.cot, apdu.org)
+		return
+	} else if c.transfer(ctx, apdu.ASDU) {
+		return
+	} else {
+		c.answerRead(apdu.ASDU)
+		responded := c.respond(apdu.ASDU)
+		if !responded && isResponse(apdu.ASDU) {
+			apdu.ASDU.toBeHandled = true // answers a command sent by SendIFrame, which only the handler waits for
+		}
+		if c.eventChan() == nil && (responded || !apdu.ASDU.toBeHandled) {
+			return
+		}
+	}
+	select {
+	case c.dataChan <- apdu:
+	case <-ctx.Done():
+	}
+}
+
 func (c *Client) handlingData(ctx context.Context) {
 	_lg.Info("start goroutine for handling data received from server")
 	defer func() {
@@ -189,114 +419,177 @@ func (c *Client) handlingData(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case apdu := <-c.dataChan:
-			if err := c.handleData(apdu); err != nil {
+			if err := c.handleData(ctx, apdu); err != nil {
 				_lg.Warnf("handle iFrame, got: %v", err)
 			}
 		}
 	}
 }
-func (c *Client) handleData(apdu *APDU) error {
+func (c *Client) handleData(ctx context.Context, apdu *APDU) error {
 	defer func() {
 		if err := recover(); err != nil {
 			_lg.Errorf("client handler: %+v", err)
 		}
 	}()
 
-	// 加锁
-	c.SignalsMutex.Lock()
-	defer c.SignalsMutex.Unlock()
-
 	_lg.Debugf("handle iFrame: TypeID: %X, COT: %X", apdu.ASDU.typeID, apdu.ASDU.cot)
-	for _, Signal := range apdu.Signals {
-		c.Signals[Signal.Address] = Signal.Value
-	}
-	switch apdu.typeID {
-	case CIcNa1:
-		return c.handler.GeneralInterrogationHandler(apdu)
-	case CCiNa1:
-		return c.handler.CounterInterrogationHandler(apdu)
-	case CRdNa1:
-		return c.handler.ReadCommandHandler(apdu)
-	case CCsNa1:
-		return c.handler.ClockSynchronizationHandler(apdu)
-	case CTsNb1, CTsTa1:
-		return c.handler.TestCommandHandler(apdu)
-	case CRpNc1:
-		return c.handler.ResetProcessCommandHandler(apdu)
-	case CCdNa1:
-		return c.handler.DelayAcquisitionCommandHandler(apdu)
+	if c.admit != nil && !c.admit(apdu) {
+		return nil
+	}
+	if c.srv == nil {
+		c.image.update(apdu.ASDU, time.Now())
+		for _, ev := range eventsOf(apdu) {
+			c.emit(ctx, ev)
+		}
+		if apdu.ASDU.typeID == MEiNa1 {
+			c.reinitialize(apdu.ASDU.coa)
+		}
+		if !apdu.ASDU.toBeHandled {
+			return nil
+		}
+	}
+	var err error
+	if c.handler != nil {
+		err = c.handler.ServeAPDU(c, apdu)
+	} else if c.srv != nil {
+		err = errNoHandler(apdu.ASDU)
+	}
+	if c.srv != nil && c.srv.reject(c, apdu.ASDU, err) {
+		return nil
+	}
+	return err
+}
+
+// ProcessImage returns the process image of the points received from the controlled stations.
+func (c *Client) ProcessImage() *ProcessImage {
+	return c.image
+}
+
+// confirm hands the confirmation of a U-frame function over to the waiting requestUFrame, if any.
+func (c *Client) confirm(apdu *APDU) {
+	select {
+	case c.recvChan <- apdu:
 	default:
-		return c.handler.APDUHandler(apdu)
+		_lg.Warnf("drop unexpected u frame: [% X]", apdu.frame.Data())
 	}
 }
 
-// readApduHeader reads both startByte and apduLen, and returns apduLen
-func (c *Client) readApduHeader() (uint8, error) { //
-	buf := make([]byte, 2)
+// requestUFrame activates the U-frame function and waits for its confirmation at most t1.
+func (c *Client) requestUFrame(act, con UFrameFunction) error {
+	if !c.IsConnected() {
+		return errNotConnected
+	}
+	c.uMutex.Lock()
+	defer c.uMutex.Unlock()
 
-	n, err := c.conn.Read(buf)
-	if err != nil {
-		return 0, err
+	// drop the confirmation which arrived too late for the previous activation
+	select {
+	case <-c.recvChan:
+	default:
 	}
-	if n != 2 {
-		return 0, errors.New("invalid data: empty")
-	} else if buf[0] != startByte {
-		return 0, fmt.Errorf("invalid data: unexpected start - % X, expected start - % X", buf[0], startByte)
+
+	ctx, out := c.session()
+	out.pushUFrame(act)
+	timer := time.NewTimer(c.t1)
+	defer timer.Stop()
+	for {
+		select {
+		case apdu := <-c.recvChan:
+			if apdu.frame.Data()[0] == con[0] {
+				return nil
+			}
+		case <-timer.C:
+			return &TimeoutError{Timer: "t1", Duration: c.t1, Op: fmt.Sprintf("confirmation of [% X]", act)}
+		case <-ctx.Done():
+			return errors.New("connection closed")
+		}
 	}
-	return buf[1], nil
 }
-func (c *Client) readApduBody(apduLen uint8) (*APDU, error) {
-	apduData := make([]byte, apduLen)
-	n, err := c.conn.Read(apduData)
-	if err != nil {
-		return nil, err
+
+// StartDT activates the user data transfer of the connection.
+func (c *Client) StartDT() error {
+	return c.requestUFrame(UFrameFunctionStartDTA, UFrameFunctionStartDTC)
+}
+
+// StopDT deactivates the user data transfer of the connection.
+func (c *Client) StopDT() error {
+	return c.requestUFrame(UFrameFunctionStopDTA, UFrameFunctionStopDTC)
+}
+
+// TestFR tests the connection by TESTFR, it fails if the test is not confirmed within t1.
+func (c *Client) TestFR() error {
+	return c.requestUFrame(UFrameFunctionTestFA, UFrameFunctionTestFC)
+}
+
+// lost closes the connection of ctx after an error, unless the connection has already been closed.
+func (c *Client) lost(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
 	}
-	for n < int(apduLen) {
-		bufLen := int(apduLen) - n
-		buf := make([]byte, bufLen)
-		m, err := c.conn.Read(buf)
-		if err != nil {
-			return nil, err
-		}
-		apduData = append(apduData[:n], buf[:m]...)
-		n = len(apduData)
+	c.connectionLost(err)
+}
+
+// connectionLost stops the goroutines of the connection after an unrecoverable transport error.
+func (c *Client) connectionLost(err error) {
+	if !atomic.CompareAndSwapInt32(&c.status, statusConnected, statusDisconnected) {
+		return // closed by Close
 	}
-	_lg.Debugf("receive: [% X]", append([]byte{startByte, apduLen}, apduData...))
+	_lg.Errorf("connection with %s lost: %v", c.remoteAddr(), err)
+	c.release()
+	c.image.invalidate()
+	c.emitClosed(ConnectionEvent{State: ConnectionLost, Err: err})
+	if c.onConnectionLostHandler != nil {
+		c.onConnectionLostHandler(c, err)
+	}
+}
 
-	apdu := new(APDU)
-	if err := apdu.Parse(apduData); err != nil {
-		return nil, err
+// terminate closes the connection served by Server.
+func (c *Client) terminate() {
+	if !atomic.CompareAndSwapInt32(&c.status, statusConnected, statusDisconnected) {
+		return
 	}
+	_lg.Debugf("close connection with %s", c.remoteAddr())
+	c.release()
+}
 
-	switch apdu.frame.Type() {
-	case FrameTypeI:
-		c.incRsn()
-		if apdu.ASDU.cmdRsp != nil {
-			c.cmdRspChan <- apdu.ASDU.cmdRsp
-		}
-		if apdu.ASDU.toBeHandled {
-			c.dataChan <- apdu
-		}
-		if apdu.ASDU.sendSFrame {
-			c.SendTestFrame()
-		}
+func (c *Client) release() {
+	c.mu.Lock()
+	cancel, conn := c.cancel, c.conn
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if conn != nil {
+		_ = conn.Close()
+	}
+	if c.group != nil {
+		c.group.detach(c)
+	}
+	if c.srv != nil {
+		c.srv.removeSession(c)
 	}
-	return apdu, nil
 }
 
 func (c *Client) IsConnected() bool {
-	return true
+	return atomic.LoadInt32(&c.status) == statusConnected
 }
 
+// Close calls the disconnect handler, which stops the data transfer by default, and closes the connection.
 func (c *Client) Close() {
+	if !c.IsConnected() {
+		return
+	}
 	c.onDisconnectHandler(c)
-
-	if c.cancel != nil {
-		c.cancel()
+	if !atomic.CompareAndSwapInt32(&c.status, statusConnected, statusDisconnected) {
+		return
 	}
+	c.release()
+	c.image.invalidate()
+	c.emitClosed(ConnectionEvent{State: ConnectionClosed})
 }
 
-func (c *Client) SendGeneralInterrogation() {
+// SendGeneralInterrogation interrogates the station, or all the stations if coa is GlobalCOA.
+func (c *Client) SendGeneralInterrogation(coa COA) error {
 	ios := []*InformationObject{
 		{
 			ioa: 0x000000,
@@ -308,33 +601,73 @@ func (c *Client) SendGeneralInterrogation() {
 			},
 		},
 	}
-	c.SendIFrame(&ASDU{
+	return c.SendIFrame(&ASDU{
 		typeID: CIcNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotAct,
+		coa:    coa,
 		ios:    ios,
 	})
 }
 
-func (c *Client) SendReadCommand(ioa IOA) {
+// SendGroupInterrogation interrogates the group 1-16 of the station, or all the stations if coa is GlobalCOA, which
+// answers with COT 21-36.
+func (c *Client) SendGroupInterrogation(coa COA, group uint8) error {
+	if group < 1 || group > 16 {
+		return fmt.Errorf("interrogation group %d is out of range 1-16", group)
+	}
+	return c.SendIFrame(NewASDU(CIcNa1, CotAct, coa, NewInformationObject(0x000000, &InformationElement{
+		Format: []InformationElementType{QOI},
+		Raw:    []byte{0x14 + group},
+	})))
+}
+
+// SendReadCommand reads the information object of the station without waiting for it, which is received by the
+// handler and the events with COT Req. Read waits for it instead.
+func (c *Client) SendReadCommand(coa COA, ioa IOA) error {
 	ios := []*InformationObject{
 		{
 			ioa: ioa,
 		},
 	}
-	c.SendIFrame(&ASDU{
+	return c.SendIFrame(&ASDU{
 		typeID: CRdNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotReq,
+		coa:    coa,
 		ios:    ios,
 	})
 }
 
-func (c *Client) SendCounterInterrogation() {
+/*
+Read reads the information object of the station, and returns its point once the station answers with COT Req, or
+fails after t1 with a TimeoutError. The point is also updated in the process image. The station rejects the read
+command with:
+  - COT 44 if it doesn't support reading the type of the object, returned as *UnknownTypeError;
+  - COT 47 if it has no object with the address, returned as *UnknownObjectAddressError.
+*/
+func (c *Client) Read(ctx context.Context, coa COA, ioa IOA) (Point, error) {
+	rsp, err := c.exchange(ctx, NewASDU(CRdNa1, CotReq, coa, NewInformationObject(ioa)))
+	if err != nil {
+		return Point{}, err
+	}
+	now := time.Now()
+	c.image.update(rsp, now) // before Read returns, rather than when the handler is called
+	for _, ie := range rsp.Signals {
+		if ie.Address == ioa {
+			return pointOf(rsp, ie, now), nil
+		}
+	}
+	return Point{}, fmt.Errorf("no information object at IOA[%d] in the answer of the read command", ioa)
+}
+
+// SendCounterInterrogation interrogates the integrated totals of the station, or all the stations if coa is
+// GlobalCOA.
+func (c *Client) SendCounterInterrogation(coa COA) error {
 	ios := []*InformationObject{
 		{
 			ioa: 0x000000,
@@ -346,17 +679,40 @@ func (c *Client) SendCounterInterrogation() {
 			},
 		},
 	}
-	c.SendIFrame(&ASDU{
+	return c.SendIFrame(&ASDU{
 		typeID: CCiNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotAct,
+		coa:    coa,
 		ios:    ios,
 	})
 }
 
-func (c *Client) SendSingleCommand(address IOA, close bool) error {
+// SendCounterFreeze freezes the integrated totals of the station, or all the stations if coa is GlobalCOA, with or
+// without resetting the counters. The frozen totals are read by SendCounterInterrogation.
+func (c *Client) SendCounterFreeze(coa COA, reset bool) error {
+	qcc := byte(0x45) // FRZ: counter freeze without reset, RQT: general request counter
+	if reset {
+		qcc = 0x85 // FRZ: counter freeze with reset
+	}
+	return c.SendIFrame(NewASDU(CCiNa1, CotAct, coa, NewInformationObject(0x000000, &InformationElement{
+		Format: []InformationElementType{QCC},
+		Raw:    []byte{qcc},
+	})))
+}
+
+// SendClockSync synchronizes the clock of the station, or all the stations if coa is GlobalCOA, to t. The time is
+// corrected by the transmission delay of the stations set by ClientOption.SetDelayCorrection.
+func (c *Client) SendClockSync(coa COA, t time.Time) error {
+	return c.SendIFrame(NewASDU(CCsNa1, CotAct, coa, NewInformationObject(0x000000, &InformationElement{
+		Format: []InformationElementType{CP56Time2a},
+		Raw:    serializeCP56Time2a(t.Add(c.clockCorrection(coa))),
+	})))
+}
+
+func (c *Client) SendSingleCommand(coa COA, address IOA, close bool) error {
 	// select
 	ie := &InformationElement{
 		Format: []InformationElementType{SCO},
@@ -372,19 +728,16 @@ func (c *Client) SendSingleCommand(address IOA, close bool) error {
 			ies: []*InformationElement{ie},
 		},
 	}
-	c.SendIFrame(&ASDU{
+	if err := c.command(&ASDU{
 		typeID: CScNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotAct,
+		coa:    coa,
 		ios:    ios,
-	})
-	select {
-	case rsp := <-c.cmdRspChan:
-		if rsp.err != nil {
-			return rsp.err
-		}
+	}); err != nil {
+		return err
 	}
 
 	// execute
@@ -402,24 +755,18 @@ func (c *Client) SendSingleCommand(address IOA, close bool) error {
 			ies: []*InformationElement{ie},
 		},
 	}
-	c.SendIFrame(&ASDU{
+	return c.command(&ASDU{
 		typeID: CScNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotAct,
+		coa:    coa,
 		ios:    ios,
 	})
-	select {
-	case rsp := <-c.cmdRspChan:
-		if rsp.err != nil {
-			return rsp.err
-		}
-	}
-	return nil
 }
 
-func (c *Client) SendDoubleCommand(address IOA, close bool) error {
+func (c *Client) SendDoubleCommand(coa COA, address IOA, close bool) error {
 	ie := &InformationElement{
 		Format: []InformationElementType{DCO},
 	}
@@ -434,20 +781,16 @@ func (c *Client) SendDoubleCommand(address IOA, close bool) error {
 			ies: []*InformationElement{ie},
 		},
 	}
-	c.SendIFrame(&ASDU{
+	if err := c.command(&ASDU{
 		typeID: CDcNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotAct,
+		coa:    coa,
 		ios:    ios,
-	})
-
-	select {
-	case rsp := <-c.cmdRspChan:
-		if rsp.err != nil {
-			return rsp.err
-		}
+	}); err != nil {
+		return err
 	}
 
 	// execute
@@ -465,101 +808,362 @@ func (c *Client) SendDoubleCommand(address IOA, close bool) error {
 			ies: []*InformationElement{ie},
 		},
 	}
-	c.SendIFrame(&ASDU{
+	return c.command(&ASDU{
 		typeID: CDcNa1,
 		sq:     false,
 		nObjs:  NOO(len(ios)),
 		t:      false,
 		cot:    CotAct,
+		coa:    coa,
 		ios:    ios,
 	})
+}
 
+// pendingKey identifies the command which a confirmation in monitor direction answers.
+type pendingKey struct {
+	typeID TypeID
+	coa    COA
+	ioa    IOA
+}
+
+func pendingKeyOf(asdu *ASDU) pendingKey {
+	key := pendingKey{typeID: asdu.typeID, coa: asdu.coa}
+	if len(asdu.ios) > 0 {
+		key.ioa = asdu.ios[0].ioa
+	}
+	return key
+}
+
+// command sends the command and waits for its confirmation at most t1. It fails if the command is confirmed
+// negatively, rejected by the controlled station or terminated before it's confirmed.
+func (c *Client) command(asdu *ASDU) error {
+	_, err := c.exchange(context.Background(), asdu)
+	return err
+}
+
+// exchange sends the ASDU in control direction and returns its answer, waiting at most t1 or until ctx is done. It
+// fails as command does, with a NegativeConfirmError or one of the rejection errors if the command is confirmed
+// negatively, or a TimeoutError.
+func (c *Client) exchange(ctx context.Context, asdu *ASDU) (*ASDU, error) {
+	if err := checkCOA(asdu.typeID, asdu.coa); err != nil {
+		return nil, err
+	}
+	asdu.org = c.org
+	key := pendingKeyOf(asdu)
+	rsp := make(chan *ASDU, 1)
+	c.pendingMutex.Lock()
+	c.pending[key] = append(c.pending[key], rsp)
+	c.pendingMutex.Unlock()
+	defer c.withdraw(key, rsp)
+
+	session, _ := c.session()
+	if err := c.sendASDU(asdu, nil); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(c.t1)
+	defer timer.Stop()
 	select {
-	case rsp := <-c.cmdRspChan:
-		if rsp.err != nil {
-			return rsp.err
+	case con := <-rsp:
+		switch {
+		case con.cot == CotActTerm && con.typeID == CScNa1:
+			return con, errSingleCmdTerm{}
+		case con.cot == CotActTerm && con.typeID == CDcNa1:
+			return con, errDoubleCmdTerm{}
+		case bool(con.pn) || con.cot >= CotUnknownType:
+			return con, rejectionOf(con, key)
 		}
+		return con, nil
+	case <-timer.C:
+		return nil, &TimeoutError{Timer: "t1", Duration: c.t1,
+			Op: fmt.Sprintf("confirmation of TypeID[%X] to IOA[%d]", key.typeID, key.ioa)}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-session.Done():
+		return nil, errors.New("connection closed")
 	}
-	return nil
 }
 
-func (c *Client) SendIFrame(asdu *ASDU) {
-	apci := &IFrame{
-		SendSN: c.ssn,
-		RecvSN: c.rsn,
+// withdraw removes the command from the pending commands if it's still waiting.
+func (c *Client) withdraw(key pendingKey, rsp chan *ASDU) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+	waiting := c.pending[key]
+	for i, x := range waiting {
+		if x == rsp {
+			waiting = append(waiting[:i:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(c.pending, key)
+	} else {
+		c.pending[key] = waiting
 	}
-	asdu.org = c.org
-	asdu.coa = c.coa
-	c.sendIFrame(apci, asdu)
 }
 
-func (c *Client) sendIFrame(apci *IFrame, asdu *ASDU) {
-	c.incSsn()
+// isResponse reports whether the ASDU is a command mirrored by the controlled station, which answers the controlling
+// station with the originator address of the ASDU only. Any ASDU with an unknown cause is a rejection, even of a type
+// in monitor direction which the controlled station doesn't accept.
+func isResponse(asdu *ASDU) bool {
+	if asdu.cot >= CotUnknownType && asdu.cot <= CotUnknownObjectAddress {
+		return true
+	}
+	if !isControlDirection(asdu.typeID) {
+		return false
+	}
+	switch asdu.cot {
+	case CotActCon, CotDeactCon, CotActTerm:
+		return true
+	case CotReq:
+		return isParameter(asdu.typeID) // the parameter read
+	}
+	return false
+}
 
-	frame := c.buildFrame(append(apci.Data(), asdu.Data()...))
-	_lg.Debugf("send i frame: [% X]", frame)
-	c.sendChan <- frame
+// respond hands the confirmation over to the oldest command waiting for it, and reports whether there is one.
+func (c *Client) respond(asdu *ASDU) bool {
+	if !isResponse(asdu) {
+		return false
+	}
+	return c.deliver(pendingKeyOf(asdu), asdu)
 }
 
-func (c *Client) SendTestFrame() {
-	c.isExec = true
-	c.sendSFrame(&SFrame{
-		RecvSN: c.rsn,
-	})
+// answerRead hands the information objects requested by the read command over to Read waiting for them. The process
+// image and the events are updated by them as usual.
+func (c *Client) answerRead(asdu *ASDU) {
+	if asdu.cot != CotReq || isControlDirection(asdu.typeID) {
+		return
+	}
+	for _, ie := range asdu.Signals {
+		c.deliver(pendingKey{typeID: CRdNa1, coa: asdu.coa, ioa: ie.Address}, asdu)
+	}
+}
+
+// deliver hands the ASDU over to the first command waiting with the key, and reports whether there is one.
+func (c *Client) deliver(key pendingKey, asdu *ASDU) bool {
+	c.pendingMutex.Lock()
+	waiting := c.pending[key]
+	if len(waiting) == 0 {
+		c.pendingMutex.Unlock()
+		return false
+	}
+	rsp := waiting[0]
+	if len(waiting) == 1 {
+		delete(c.pending, key)
+	} else {
+		c.pending[key] = waiting[1:]
+	}
+	c.pendingMutex.Unlock()
+	rsp <- asdu
+	return true
+}
+
+// SendIFrame sends the ASDU with the originator address of the client, to the common address of the client if the
+// common address of the ASDU is 0 (not used). It doesn't wait for the I-frame to be sent, the I-frames are sent in
+// order as soon as the send window k allows.
+//
+// A connection served by Server sends the ASDU with its originator address, which is the address of the controlling
+// station the ASDU answers.
+func (c *Client) SendIFrame(asdu *ASDU) error {
+	if c.srv == nil {
+		asdu.org = c.org
+	}
+	if asdu.coa == 0 {
+		asdu.coa = c.coa
+	}
+	if err := checkCOA(asdu.typeID, asdu.coa); err != nil {
+		return err
+	}
+	return c.sendASDU(asdu, nil)
+}
+
+// checkCOA verifies that the global address is only used by the ASDUs which may be broadcast.
+func checkCOA(typeID TypeID, coa COA) error {
+	if coa != GlobalCOA {
+		return nil
+	}
+	switch typeID {
+	case CIcNa1, CCiNa1, CCsNa1, CRpNc1:
+		return nil
+	}
+	return fmt.Errorf("TypeID[%X] can't be broadcast to the global address", typeID)
+}
+
+// sendASDU hands the ASDU over to the event loop of the connection as it is. sent, if it's not nil, is called by the
+// event loop with the send sequence number of the I-frame carrying the ASDU.
+func (c *Client) sendASDU(asdu *ASDU, sent func(ssn uint16)) error {
+	ctx, out := c.session()
+	if out == nil || ctx.Err() != nil {
+		return errNotConnected
+	}
+	out.pushIFrame(&outbound{asdu: asdu.Data(), sent: sent})
+	return nil
 }
-func (c *Client) sendSFrame(x *SFrame) {
-	frame := c.buildFrame(x.Data())
-	_lg.Debugf("send s frame: [% X]", frame)
-	c.sendChan <- frame
+
+// SendTestFrame sends an S-frame to acknowledge the received I-frames.
+func (c *Client) SendTestFrame() {
+	if _, out := c.session(); out != nil {
+		out.requestAck()
+	}
 }
 
-func (c *Client) sendUFrame(x UFrameFunction) {
-	name := ""
-	frame := c.buildFrame(x)
+func uFrameName(x UFrameFunction) string {
 	switch x[0] {
 	case UFrameFunctionStartDTA[0]:
-		name = "StartDTA"
+		return "StartDTA"
 	case UFrameFunctionStartDTC[0]:
-		name = "StartDTC"
+		return "StartDTC"
 	case UFrameFunctionStopDTA[0]:
-		name = "StopDTA"
+		return "StopDTA"
 	case UFrameFunctionStopDTC[0]:
-		name = "StopDTC"
+		return "StopDTC"
 	case UFrameFunctionTestFA[0]:
-		name = "TestFA"
+		return "TestFA"
 	case UFrameFunctionTestFC[0]:
-		name = "TestFC"
+		return "TestFC"
 	}
-	_lg.Debugf("send u frame: %s - [% X]", name, frame)
-	c.sendChan <- frame
+	return ""
 }
 
 func (c *Client) buildFrame(data []byte) []byte {
-	// fmt.Println("---------")
-	frame := make([]byte, 0, 0)
-	// fmt.Println(frame)
+	frame := make([]byte, 0, 2+len(data))
 	iBytes := serializeBigEndianUint16(uint16(len(data)))
-	// fmt.Println(iBytes)
 	frame = append(frame, startByte)
-	// fmt.Println(frame)
 	frame = append(frame, iBytes[1])
-	// fmt.Println(frame)
 	frame = append(frame, data...)
-	// fmt.Println(frame)
-	// fmt.Println("---------")
 	return frame
 }
 
-func (c *Client) incRsn() {
-	c.rsn++
-	if c.rsn == 1<<15 {
-		c.rsn = 0
+// outbox holds the frames handed over to the event loop of a connection.
+type outbox struct {
+	mu      sync.Mutex
+	uFrames []UFrameFunction
+	iFrames []*outbound
+	ack     bool // an S-frame is requested
+	wakeup  chan struct{}
+}
+
+// outbound is an ASDU waiting for the send window.
+type outbound struct {
+	asdu []byte
+	sent func(ssn uint16)
+}
+
+func newOutbox() *outbox {
+	return &outbox{wakeup: make(chan struct{}, 1)}
+}
+
+func (o *outbox) pushUFrame(x UFrameFunction) {
+	o.mu.Lock()
+	o.uFrames = append(o.uFrames, x)
+	o.mu.Unlock()
+	o.wake()
+}
+
+func (o *outbox) pushIFrame(ob *outbound) {
+	o.mu.Lock()
+	o.iFrames = append(o.iFrames, ob)
+	o.mu.Unlock()
+	o.wake()
+}
+
+func (o *outbox) requestAck() {
+	o.mu.Lock()
+	o.ack = true
+	o.mu.Unlock()
+	o.wake()
+}
+
+func (o *outbox) wake() {
+	select {
+	case o.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outbox) takeUFrames() ([]UFrameFunction, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	uFrames, ack := o.uFrames, o.ack
+	o.uFrames, o.ack = nil, false
+	return uFrames, ack
+}
+
+func (o *outbox) nextIFrame() *outbound {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.iFrames) == 0 {
+		return nil
+	}
+	ob := o.iFrames[0]
+	o.iFrames[0] = nil
+	o.iFrames = o.iFrames[1:]
+	return ob
+}
+
+// transmission is the protocol state of a connection, which is owned by the event loop of the connection.
+type transmission struct {
+	ssn, rsn uint16      // send sequence number, receive sequence number
+	unacked  []sentFrame // I-frames sent but not acknowledged by the peer, at most k
+	received int         // I-frames received but not acknowledged to the peer, at most w
+	t2       time.Time   // deadline to acknowledge the received I-frames
+	ackNow   bool        // the received I-frames have to be acknowledged at once
+}
+
+type sentFrame struct {
+	ssn uint16
+	at  time.Time
+}
+
+func (tx *transmission) incRsn() {
+	tx.rsn++
+	if tx.rsn == 1<<15 {
+		tx.rsn = 0
+	}
+}
+
+func (tx *transmission) incSsn() {
+	tx.ssn++
+	if tx.ssn == 1<<15 {
+		tx.ssn = 0
+	}
+}
+
+// ack drops the I-frames acknowledged by the receive sequence number of the peer, which must be between the oldest
+// unacknowledged I-frame and the next I-frame to be sent.
+func (tx *transmission) ack(recvSN uint16) error {
+	if (tx.ssn-recvSN)&0x7fff > uint16(len(tx.unacked)) {
+		return &SequenceError{Number: "N(R)", Received: recvSN, Expected: tx.ssn, Unacked: len(tx.unacked)}
+	}
+	n := 0
+	for n < len(tx.unacked) && seqAcked(tx.unacked[n].ssn, recvSN) {
+		n++
 	}
+	tx.unacked = tx.unacked[n:]
+	return nil
 }
 
-func (c *Client) incSsn() {
-	c.ssn++
-	if c.rsn == 1<<15 {
-		c.ssn = 0
+// deadline returns when the timer of the event loop has to expire: either t1 of the oldest unacknowledged I-frame or
+// t2 of the received I-frames.
+func (tx *transmission) deadline(t1 time.Duration) (deadline time.Time, ok bool) {
+	if len(tx.unacked) > 0 {
+		deadline, ok = tx.unacked[0].at.Add(t1), true
 	}
+	if tx.received > 0 && (!ok || tx.t2.Before(deadline)) {
+		deadline, ok = tx.t2, true
+	}
+	return deadline, ok
+}
+
+// expire fails if the oldest I-frame isn't acknowledged within t1, and requests to acknowledge the received I-frames
+// after t2.
+func (tx *transmission) expire(now time.Time, t1 time.Duration) error {
+	if len(tx.unacked) > 0 && !now.Before(tx.unacked[0].at.Add(t1)) {
+		return &TimeoutError{Timer: "t1", Duration: t1,
+			Op: fmt.Sprintf("acknowledgement of I-frame N(S)=%d", tx.unacked[0].ssn)}
+	}
+	if tx.received > 0 && !now.Before(tx.t2) {
+		tx.ackNow = true
+	}
+	return nil
 }
@@ -2,7 +2,6 @@ package iec104
 
 import (
 	"crypto/tls"
-	"fmt"
 	"net/url"
 	"strings"
 	"time"
@@ -11,6 +10,11 @@ import (
 const (
 	DefaultReconnectRetries  = 1
 	DefaultReconnectInterval = 3 * time.Second
+	DefaultT1                = 15 * time.Second // time-out of send or test APDUs
+	DefaultT2                = 10 * time.Second // time-out for acknowledges in case of no data messages, t2 < t1
+	DefaultK                 = 12               // maximum number of unacknowledged I-frames sent
+	DefaultW                 = 8                // latest acknowledge after receiving w I-frames
+	DefaultEventBufferSize   = 256
 )
 
 func NewClientOption(server string, handler ClientHandler, connecttimeout time.Duration) (*ClientOption, error) {
@@ -20,42 +24,61 @@ func NewClientOption(server string, handler ClientHandler, connecttimeout time.D
 	if !strings.Contains(server, "://") {
 		server = "tcp://" + server
 	}
-	fmt.Println(server)
 	remoteURL, err := url.Parse(server)
 	if err != nil {
 		return nil, err
 	}
-	return &ClientOption{
+	o := &ClientOption{
 		server:         remoteURL,
 		connectTimeout: connecttimeout,
 		autoReconnectRule: &AutoReconnectRule{
 			retries:  DefaultReconnectRetries,
 			interval: DefaultReconnectInterval,
 		},
+		t1: DefaultT1,
+		t2: DefaultT2,
+		k:  DefaultK,
+		w:  DefaultW,
+
+		eventBufferSize: DefaultEventBufferSize,
 		onConnectHandler: func(c *Client) {
-			_lg.Printf("connected with %s", c.conn.RemoteAddr())
-			c.sendUFrame(UFrameFunctionStartDTA)
-			<-c.recvChan
+			_lg.Printf("connected with %s", c.remoteAddr())
+			if err := c.StartDT(); err != nil {
+				_lg.Errorf("start data transfer: %v", err)
+			}
 		},
 		onDisconnectHandler: func(c *Client) {
-			_lg.Printf("disconnected with %s", c.conn.RemoteAddr())
-			c.sendUFrame(UFrameFunctionStopDTA)
-			<-c.recvChan // receive StopDTC
+			_lg.Printf("disconnected with %s", c.remoteAddr())
+			if err := c.StopDT(); err != nil {
+				_lg.Errorf("stop data transfer: %v", err)
+			}
 		},
-		handler: handler,
-		tc:      nil,
-	}, nil
+		tc: nil,
+	}
+	if handler != nil {
+		o.handler = AdaptClientHandler(handler)
+	}
+	return o, nil
 }
 
 type ClientOption struct {
 	server            *url.URL
 	connectTimeout    time.Duration
+	t1, t2            time.Duration
+	k, w              int
+	eventBufferSize   int
+	org               ORG // originator address of the client
+	stalePeriod       time.Duration
+	syncClockOnInit   bool  // synchronize the clock of a station after its end of initialization
+	interrogateOnInit bool  // interrogate a station after its end of initialization
+	delayCorrected    []COA // stations whose clock synchronization is corrected by the client
 	autoReconnectRule *AutoReconnectRule
 
-	onConnectHandler    OnConnectHandler
-	onDisconnectHandler OnDisconnectHandler
+	onConnectHandler        OnConnectHandler
+	onDisconnectHandler     OnDisconnectHandler
+	onConnectionLostHandler OnConnectionLostHandler
 
-	handler ClientHandler
+	handler Handler
 
 	tc *tls.Config
 }
@@ -72,6 +95,91 @@ func (o *ClientOption) SetConnectTimeout(timeout time.Duration) *ClientOption {
 	return o
 }
 
+// SetT1 sets the time-out of send or test APDUs, for example, the time to wait for the confirmation of STARTDT.
+func (o *ClientOption) SetT1(t1 time.Duration) *ClientOption {
+	if t1 > 0 {
+		o.t1 = t1
+	}
+	return o
+}
+
+// SetT2 sets the time-out for acknowledges in case of no data messages, it must be less than t1.
+func (o *ClientOption) SetT2(t2 time.Duration) *ClientOption {
+	if t2 > 0 {
+		o.t2 = t2
+	}
+	return o
+}
+
+// SetWindow sets the maximum number k of unacknowledged I-frames sent, and the number w of received I-frames after
+// which they are acknowledged at the latest. w should not exceed two-thirds of k.
+func (o *ClientOption) SetWindow(k, w int) *ClientOption {
+	if k > 0 && w > 0 {
+		o.k, o.w = k, w
+	}
+	return o
+}
+
+// SetOriginatorAddress sets the originator address (ORG) of the client, which identifies the client when several
+// controlling stations are connected to the same controlled station. The client ignores the command confirmations
+// with another originator address, which answer the other controlling stations.
+func (o *ClientOption) SetOriginatorAddress(org ORG) *ClientOption {
+	o.org = org
+	return o
+}
+
+// SetEventBufferSize sets the capacity of the channel returned by Client.Events.
+func (o *ClientOption) SetEventBufferSize(size int) *ClientOption {
+	if size > 0 {
+		o.eventBufferSize = size
+	}
+	return o
+}
+
+// SetStalePeriod sets the period after which a point of the process image which is not updated is marked not topical
+// (NT). Zero, the default, disables the marking.
+func (o *ClientOption) SetStalePeriod(period time.Duration) *ClientOption {
+	if period >= 0 {
+		o.stalePeriod = period
+	}
+	return o
+}
+
+// SetInitializationActions sets what the client does when a station reports the end of its initialization (MEiNa1),
+// after which the values of the station may be stale: it synchronizes the clock of the station if syncClock is true,
+// and then interrogates the station if interrogate is true.
+func (o *ClientOption) SetInitializationActions(syncClock, interrogate bool) *ClientOption {
+	o.syncClockOnInit, o.interrogateOnInit = syncClock, interrogate
+	return o
+}
+
+// SetDelayCorrection sets the stations which don't correct their clock by the transmission delay themselves. The
+// client adds the delay acquired by Client.AcquireDelay to the time of their clock synchronization instead of sending
+// the delay to them.
+func (o *ClientOption) SetDelayCorrection(coas ...COA) *ClientOption {
+	o.delayCorrected = coas
+	return o
+}
+
+// defaults sets the protocol parameters which are not set to their default values.
+func (o *ClientOption) defaults() {
+	if o.t1 <= 0 {
+		o.t1 = DefaultT1
+	}
+	if o.t2 <= 0 {
+		o.t2 = DefaultT2
+	}
+	if o.k <= 0 {
+		o.k = DefaultK
+	}
+	if o.w <= 0 {
+		o.w = DefaultW
+	}
+	if o.eventBufferSize <= 0 {
+		o.eventBufferSize = DefaultEventBufferSize
+	}
+}
+
 func (o *ClientOption) SetAutoReconnectRule(rule *AutoReconnectRule) *ClientOption {
 	if rule == nil {
 		return o
@@ -86,6 +194,13 @@ func (o *ClientOption) SetAutoReconnectRule(rule *AutoReconnectRule) *ClientOpti
 	return o
 }
 
+// SetHandler sets the handler of the received APDUs, for example, a ServeMux. It replaces the ClientHandler passed to
+// NewClientOption.
+func (o *ClientOption) SetHandler(handler Handler) *ClientOption {
+	o.handler = handler
+	return o
+}
+
 func (o *ClientOption) SetTLS(tc *tls.Config) *ClientOption {
 	o.tc = tc
 	return o
@@ -108,3 +223,11 @@ func (o *ClientOption) SetOnDisconnectHandler(handler OnDisconnectHandler) *Clie
 	}
 	return o
 }
+
+// OnConnectionLostHandler is called when the connection is closed by an error instead of Client.Close.
+type OnConnectionLostHandler func(c *Client, err error)
+
+func (o *ClientOption) SetOnConnectionLostHandler(handler OnConnectionLostHandler) *ClientOption {
+	o.onConnectionLostHandler = handler
+	return o
+}
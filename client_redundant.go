@@ -0,0 +1,299 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultTestInterval = 20 * time.Second // t3, time-out for sending test frames in case of a long idle state
+	redundantHistoryLen = 256
+)
+
+/*
+RedundantClient holds connections to several addresses of one controlled station, for example, the network ports A
+and B of an outstation, and presents them as a single stream of data to the application.
+
+  - Only one connection is started by STARTDT, the others are standby connections which are kept alive by TESTFR.
+  - When the started connection fails (TCP failure or no confirmation of TESTFR within t1), STOPDT is sent on it if
+    it's still open, and another connection is started. A general interrogation is optionally sent afterwards.
+  - The controlled station sends again on the newly started connection the ASDUs which were not acknowledged on the
+    previous one. They are dropped if they are received first on the new connection in the same order, so that neither
+    the handler nor the events of the connection receive duplicates, while the ASDUs acknowledged on the previous connection are never dropped even
+    if they are repeated with the same content, like the confirmations of a general interrogation.
+*/
+type RedundantClient struct {
+	handler      Handler
+	links        []*redundantLink
+	testInterval time.Duration
+	interrogate  bool
+
+	mu       sync.Mutex
+	active   *redundantLink
+	history  []receivedASDU // ASDUs received on the started connection and not acknowledged yet
+	handover []string       // ASDUs which may be received again on the newly started connection
+
+	failover chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+type receivedASDU struct {
+	ssn uint16 // N(S) of the I-frame
+	raw string
+}
+
+type redundantLink struct {
+	*Client
+	rc *RedundantClient
+}
+
+// NewRedundantClient creates a RedundantClient with a connection for each option. The handler and the connect,
+// disconnect and connection lost handlers of the options are replaced by the RedundantClient.
+func NewRedundantClient(handler Handler, options ...*ClientOption) *RedundantClient {
+	rc := &RedundantClient{
+		handler:      handler,
+		testInterval: DefaultTestInterval,
+		failover:     make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		l := &redundantLink{rc: rc}
+		option.handler = l
+		option.onConnectHandler = func(c *Client) {
+			_lg.Infof("connected with %s", c.remoteAddr())
+		}
+		option.onDisconnectHandler = func(c *Client) {
+			_lg.Infof("disconnected with %s", c.remoteAddr())
+		}
+		option.onConnectionLostHandler = func(c *Client, err error) {
+			rc.linkLost(l)
+		}
+		l.Client = NewClient(option)
+		l.Client.admit = func(apdu *APDU) bool { return rc.admit(l, apdu) }
+		rc.links = append(rc.links, l)
+	}
+	return rc
+}
+
+// SetTestInterval sets the interval to test every connection by TESTFR.
+func (rc *RedundantClient) SetTestInterval(interval time.Duration) *RedundantClient {
+	if interval > 0 {
+		rc.testInterval = interval
+	}
+	return rc
+}
+
+// SetInterrogateOnSwitchover sets whether to send a general interrogation after another connection is started.
+func (rc *RedundantClient) SetInterrogateOnSwitchover(interrogate bool) *RedundantClient {
+	rc.interrogate = interrogate
+	return rc
+}
+
+// Connect connects all addresses and starts the first available connection. It fails only if no connection can be
+// started, the failed connections are reconnected in background.
+func (rc *RedundantClient) Connect() error {
+	for _, l := range rc.links {
+		if err := l.Connect(); err != nil {
+			_lg.Warnf("connect %s: %v", l.server.Host, err)
+		}
+	}
+	if !rc.start(nil, false) {
+		for _, l := range rc.links {
+			l.Close()
+		}
+		return errors.New("no connection can be started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rc.cancel = cancel
+	rc.wg.Add(1)
+	go rc.supervise(ctx)
+	return nil
+}
+
+// Close stops the data transfer of the started connection and closes all connections.
+func (rc *RedundantClient) Close() {
+	if rc.cancel != nil {
+		rc.cancel()
+	}
+	rc.wg.Wait()
+
+	rc.mu.Lock()
+	active := rc.active
+	rc.active = nil
+	rc.mu.Unlock()
+	if active != nil && active.IsConnected() {
+		if err := active.StopDT(); err != nil {
+			_lg.Warnf("stop data transfer with %s: %v", active.server.Host, err)
+		}
+	}
+	for _, l := range rc.links {
+		l.Close()
+	}
+}
+
+// Active returns the started connection, which is used to send commands. It returns nil if no connection is started.
+func (rc *RedundantClient) Active() *Client {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.active == nil {
+		return nil
+	}
+	return rc.active.Client
+}
+
+// SwitchOver stops the data transfer of the started connection and starts another one.
+func (rc *RedundantClient) SwitchOver() {
+	select {
+	case rc.failover <- struct{}{}:
+	default:
+	}
+}
+
+func (rc *RedundantClient) linkLost(l *redundantLink) {
+	rc.mu.Lock()
+	active := rc.active == l
+	rc.mu.Unlock()
+	if active {
+		rc.SwitchOver()
+	}
+}
+
+// supervise tests and reconnects the connections, and switches over the started connection.
+func (rc *RedundantClient) supervise(ctx context.Context) {
+	defer rc.wg.Done()
+	ticker := time.NewTicker(rc.testInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rc.failover:
+			rc.switchOver()
+		case <-ticker.C:
+			for _, l := range rc.links {
+				if !l.IsConnected() {
+					if err := l.Connect(); err != nil {
+						_lg.Debugf("reconnect %s: %v", l.server.Host, err)
+					}
+					continue
+				}
+				if err := l.TestFR(); err != nil {
+					l.connectionLost(err)
+				}
+			}
+			if rc.Active() == nil {
+				rc.switchOver()
+			}
+		}
+	}
+}
+
+func (rc *RedundantClient) switchOver() {
+	rc.mu.Lock()
+	old := rc.active
+	rc.active = nil
+	rc.mu.Unlock()
+
+	if old != nil && old.IsConnected() {
+		if err := old.StopDT(); err != nil {
+			old.connectionLost(err)
+		}
+	}
+
+	rc.mu.Lock()
+	rc.handover = nil
+	if old != nil {
+		for _, x := range rc.unacknowledged(old) {
+			rc.handover = append(rc.handover, x.raw)
+		}
+	}
+	rc.history = nil
+	rc.mu.Unlock()
+	rc.start(old, rc.interrogate)
+}
+
+// start starts the first connection which accepts STARTDT, preferring other connections than the previous one.
+func (rc *RedundantClient) start(previous *redundantLink, interrogate bool) bool {
+	candidates := make([]*redundantLink, 0, len(rc.links))
+	for _, l := range rc.links {
+		if l != previous {
+			candidates = append(candidates, l)
+		}
+	}
+	if previous != nil {
+		candidates = append(candidates, previous)
+	}
+
+	for _, l := range candidates {
+		if !l.IsConnected() {
+			continue
+		}
+		rc.mu.Lock()
+		rc.active = l // data may arrive before the confirmation of STARTDT
+		rc.mu.Unlock()
+		if err := l.StartDT(); err != nil {
+			_lg.Warnf("start data transfer with %s: %v", l.server.Host, err)
+			rc.mu.Lock()
+			rc.active = nil
+			rc.mu.Unlock()
+			continue
+		}
+		_lg.Infof("data transfer started with %s", l.server.Host)
+		if interrogate {
+			_ = l.SendGeneralInterrogation(GlobalCOA)
+		}
+		return true
+	}
+	_lg.Errorf("no connection can be started")
+	return false
+}
+
+// admit reports whether the data received on the connection is processed, that is, it isn't a duplicate of the
+// data received on the previous connection. It's called before the data is emitted as events or handled.
+func (rc *RedundantClient) admit(l *redundantLink, apdu *APDU) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.active != l {
+		return true
+	}
+	raw := string(apdu.ASDU.raw)
+	if len(rc.handover) > 0 {
+		if rc.handover[0] == raw {
+			rc.handover = rc.handover[1:]
+			_lg.Debugf("drop duplicate ASDU: [% X]", apdu.ASDU.raw)
+			return false
+		}
+		rc.handover = nil
+	}
+	if frame, ok := apdu.frame.(*IFrame); ok {
+		rc.history = append(rc.unacknowledged(l), receivedASDU{ssn: frame.SendSN, raw: raw})
+		if len(rc.history) > redundantHistoryLen {
+			rc.history = rc.history[len(rc.history)-redundantHistoryLen:]
+		}
+	}
+	return true
+}
+
+// unacknowledged returns the ASDUs of the history which are not acknowledged yet on the connection. It must be called
+// with mu held.
+func (rc *RedundantClient) unacknowledged(l *redundantLink) []receivedASDU {
+	acked := uint16(atomic.LoadUint32(&l.acked))
+	n := 0
+	for n < len(rc.history) && seqAcked(rc.history[n].ssn, acked) {
+		n++
+	}
+	return rc.history[n:]
+}
+
+// ServeAPDU passes the data received on the started connection to the handler.
+func (l *redundantLink) ServeAPDU(c *Client, apdu *APDU) error {
+	if l.rc.handler == nil || l.rc.Active() != l.Client {
+		return nil
+	}
+	return l.rc.handler.ServeAPDU(c, apdu)
+}
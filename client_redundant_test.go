@@ -0,0 +1,142 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// testServer serves the controlled station on an ephemeral port of the loopback interface.
+func testServer(t *testing.T) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	go func() {
+		_ = s.Serve(listener, nil)
+	}()
+	t.Cleanup(func() {
+		_ = s.Shutdown(context.Background())
+	})
+	return s, listener.Addr().String()
+}
+
+// dropSessions breaks the connections of the server as if the network failed.
+func (s *Server) dropSessions() {
+	s.mu.Lock()
+	sessions := make([]*Client, 0, len(s.sessions))
+	for c := range s.sessions {
+		sessions = append(sessions, c)
+	}
+	s.mu.Unlock()
+	for _, c := range sessions {
+		c.connectionLost(errors.New("network failure"))
+	}
+}
+
+type testHandler struct {
+	apdus chan *APDU
+}
+
+func (h testHandler) GeneralInterrogationHandler(apdu *APDU) error    { h.apdus <- apdu; return nil }
+func (h testHandler) CounterInterrogationHandler(apdu *APDU) error    { h.apdus <- apdu; return nil }
+func (h testHandler) ClockSynchronizationHandler(apdu *APDU) error    { h.apdus <- apdu; return nil }
+func (h testHandler) TestCommandHandler(apdu *APDU) error             { h.apdus <- apdu; return nil }
+func (h testHandler) ReadCommandHandler(apdu *APDU) error             { h.apdus <- apdu; return nil }
+func (h testHandler) ResetProcessCommandHandler(apdu *APDU) error     { h.apdus <- apdu; return nil }
+func (h testHandler) DelayAcquisitionCommandHandler(apdu *APDU) error { h.apdus <- apdu; return nil }
+func (h testHandler) APDUHandler(apdu *APDU) error                    { h.apdus <- apdu; return nil }
+
+func (h testHandler) expect(t *testing.T, ioa IOA) {
+	t.Helper()
+	select {
+	case apdu := <-h.apdus:
+		if got := apdu.Signals[0].Address; got != ioa {
+			t.Fatalf("receive IOA %d, want %d", got, ioa)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("receive nothing, want IOA %d", ioa)
+	}
+}
+
+func TestRedundantClient_switchover(t *testing.T) {
+	a, addrA := testServer(t)
+	b, addrB := testServer(t)
+
+	h := testHandler{apdus: make(chan *APDU, 10)}
+	optionA, _ := NewClientOption(addrA, nil, time.Second)
+	optionB, _ := NewClientOption(addrB, nil, time.Second)
+	rc := NewRedundantClient(AdaptClientHandler(h), optionA.SetT1(time.Second), optionB.SetT1(time.Second)).
+		SetTestInterval(100 * time.Millisecond)
+	if err := rc.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	a.Send(testSinglePoint(1, 1))
+	b.Send(testSinglePoint(2, 1)) // B is not started, nothing is sent
+	h.expect(t, 1)
+
+	a.dropSessions()
+	deadline := time.Now().Add(2 * time.Second)
+	for rc.Active() == nil || rc.Active().server.Host != addrB {
+		if time.Now().After(deadline) {
+			t.Fatalf("no switchover to %s", addrB)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.Send(testSinglePoint(3, 0))
+	h.expect(t, 3)
+}
+
+func TestRedundantClient_admit(t *testing.T) {
+	h := testHandler{apdus: make(chan *APDU, 10)}
+	optionA, _ := NewClientOption("127.0.0.1:2404", nil, time.Second)
+	optionB, _ := NewClientOption("127.0.0.1:2405", nil, time.Second)
+	rc := NewRedundantClient(AdaptClientHandler(h), optionA, optionB)
+	a, b := rc.links[0], rc.links[1]
+	events := b.Events()
+	ctx := context.Background()
+	ssn := uint16(0)
+	apdu := func(ioa IOA) *APDU {
+		ssn++
+		parsed := testParseASDU(t, testSinglePoint(ioa, 1))
+		parsed.APCI, parsed.frame = &APCI{}, &IFrame{SendSN: ssn - 1}
+		return parsed
+	}
+
+	rc.active = a
+	for _, ioa := range []IOA{1, 2, 3} {
+		_ = a.handleData(ctx, apdu(ioa))
+	}
+	_ = b.handleData(ctx, apdu(9)) // standby connection
+	if len(h.apdus) != 3 {
+		t.Fatalf("forward %d ASDUs, want 3", len(h.apdus))
+	}
+	<-events // of the standby connection
+
+	// 1 was acknowledged, 2 and 3 were not and are sent again on the newly started connection.
+	a.acked = 1
+	rc.active = b
+	for _, x := range rc.unacknowledged(a) {
+		rc.handover = append(rc.handover, x.raw)
+	}
+	rc.history = nil
+	for _, ioa := range []IOA{2, 3, 1, 4, 2} {
+		_ = b.handleData(ctx, apdu(ioa))
+	}
+	if len(h.apdus) != 6 {
+		t.Fatalf("forward %d ASDUs, want 6", len(h.apdus))
+	}
+	for _, want := range []IOA{1, 4, 2} {
+		if ev, ok := (<-events).(SinglePointEvent); !ok || ev.IOA != want {
+			t.Fatalf("expect the event of IOA %d, got %+v", want, ev)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("%d duplicate events", len(events))
+	}
+}
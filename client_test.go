@@ -0,0 +1,194 @@
+package iec104
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_transmission(t *testing.T) {
+	tx := &transmission{ssn: 1<<15 - 1, rsn: 1<<15 - 1}
+	tx.unacked = append(tx.unacked, sentFrame{ssn: tx.ssn})
+	tx.incSsn()
+	tx.incRsn()
+	if tx.ssn != 0 || tx.rsn != 0 {
+		t.Fatalf("sequence numbers after wraparound = %d, %d, want 0, 0", tx.ssn, tx.rsn)
+	}
+
+	tests := []struct {
+		name    string
+		recvSN  uint16
+		wantErr bool
+		unacked int
+	}{
+		{"nothing acknowledged", 1<<15 - 1, false, 1},
+		{"acknowledged after wraparound", 0, false, 0},
+		{"acknowledge I-frame not sent", 1, true, 1},
+		{"acknowledge I-frame acknowledged before", 1<<15 - 2, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := *tx
+			if err := tx.ack(tt.recvSN); (err != nil) != tt.wantErr {
+				t.Fatalf("ack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(tx.unacked) != tt.unacked {
+				t.Errorf("unacknowledged I-frames = %d, want %d", len(tx.unacked), tt.unacked)
+			}
+		})
+	}
+}
+
+func Test_transmission_expire(t *testing.T) {
+	now := time.Now()
+	tx := &transmission{received: 1, t2: now.Add(time.Second)}
+	if deadline, ok := tx.deadline(2 * time.Second); !ok || !deadline.Equal(tx.t2) {
+		t.Fatalf("deadline() = %v, %v, want t2", deadline, ok)
+	}
+	if err := tx.expire(tx.t2, 2*time.Second); err != nil || !tx.ackNow {
+		t.Fatalf("expire() at t2 = %v, the received I-frames must be acknowledged", err)
+	}
+	tx.unacked = []sentFrame{{ssn: 0, at: now}}
+	if err := tx.expire(now.Add(2*time.Second), 2*time.Second); err == nil {
+		t.Fatalf("expire() at t1 must fail")
+	}
+}
+
+// TestClient_concurrent sends from many goroutines in both directions at the same time, run it with -race.
+func TestClient_concurrent(t *testing.T) {
+	const goroutines, events = 8, 50
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	commands := testHandler{apdus: make(chan *APDU, goroutines*events)}
+	go func() {
+		_ = s.Serve(listener, AdaptClientHandler(commands))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	h := testHandler{apdus: make(chan *APDU, goroutines*events)}
+	option, _ := NewClientOption(listener.Addr().String(), h, time.Second)
+	c := NewClient(option)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		i := i
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				s.Send(testSinglePoint(IOA(i*events+j), byte(j%2)))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				if j%2 == 0 {
+					_ = c.SendGeneralInterrogation(1)
+				} else {
+					_ = c.SendReadCommand(1, IOA(j))
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := c.TestFR(); err != nil {
+					t.Errorf("TestFR() = %v", err)
+				}
+				c.ProcessImage().Snapshot()
+				c.SendTestFrame()
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.apdus) < goroutines*events || len(commands.apdus) < goroutines*events {
+		if time.Now().After(deadline) {
+			t.Fatalf("client receives %d events, server receives %d commands, want %d",
+				len(h.apdus), len(commands.apdus), goroutines*events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := c.ProcessImage().Len(); n != goroutines*events {
+		t.Errorf("the process image has %d points, want %d", n, goroutines*events)
+	}
+	if !c.IsConnected() {
+		t.Errorf("the connection is lost")
+	}
+}
+
+func TestClient_multiStation(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	received := make(chan *APDU, 8)
+	go func() {
+		_ = s.Serve(listener, HandlerFunc(func(c *Client, apdu *APDU) error {
+			received <- apdu
+			if apdu.typeID == CScNa1 {
+				return c.sendASDU(apdu.Mirror(CotActCon, false), nil)
+			}
+			return nil
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.SendReadCommand(GlobalCOA, 1); err == nil {
+		t.Errorf("SendReadCommand() to the global address must fail")
+	}
+	tests := []struct {
+		name   string
+		send   func() error
+		typeID TypeID
+		coa    COA
+	}{
+		{"broadcast interrogation", func() error { return c.SendGeneralInterrogation(GlobalCOA) }, CIcNa1, GlobalCOA},
+		{"broadcast clock sync", func() error { return c.SendClockSync(GlobalCOA, time.Now()) }, CCsNa1, GlobalCOA},
+		{"counter freeze", func() error { return c.SendCounterFreeze(3, true) }, CCiNa1, 3},
+		{"command to a station", func() error { return c.SendSingleCommand(7, 1, true) }, CScNa1, 7},
+		{
+			"default address",
+			func() error { return c.SendIFrame(NewASDU(CRdNa1, CotReq, 0, NewInformationObject(1))) },
+			CRdNa1, 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case apdu := <-received:
+				if apdu.typeID != tt.typeID || apdu.coa != tt.coa {
+					t.Errorf("server receives TypeID[%X] to COA[%d], want TypeID[%X] to COA[%d]",
+						apdu.typeID, apdu.coa, tt.typeID, tt.coa)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("server receives nothing")
+			}
+			if tt.typeID == CScNa1 {
+				<-received // execute after select
+			}
+		})
+	}
+}
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+// errQuit is returned by the quit command to stop the console.
+var errQuit = errors.New("quit")
+
+// command is a command of the console.
+type command struct {
+	usage string
+	help  string
+	run   func(c *Console, args []string) error
+}
+
+// commands are the commands of the console by their names.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"connect":    {"connect [address]", "connect to the station and start the data transfer", (*Console).connect},
+		"disconnect": {"disconnect", "stop the data transfer and close the connection", (*Console).disconnect},
+		"startdt":    {"startdt", "start the data transfer", (*Console).startDT},
+		"stopdt":     {"stopdt", "stop the data transfer", (*Console).stopDT},
+		"gi": {"gi [coa] [group]", "interrogate the station, or the group 1-16 of it, and wait for the termination",
+			(*Console).interrogate},
+		"ci":    {"ci [coa]", "interrogate the counters and wait for the termination", (*Console).interrogateCounters},
+		"read":  {"read coa ioa", "read the information object and print it", (*Console).read},
+		"sc":    {"sc coa ioa on|off [sbo|select|execute]", "send a single command", (*Console).singleCommand},
+		"dc":    {"dc coa ioa on|off [sbo|select|execute]", "send a double command", (*Console).doubleCommand},
+		"rc":    {"rc coa ioa higher|lower [sbo|select|execute]", "send a regulating step command", (*Console).stepCommand},
+		"sp":    {"sp coa ioa type value [sbo|select|execute]", "send a set-point command", (*Console).setPoint},
+		"clock": {"clock [coa]", "synchronize the clock of the station to now", (*Console).syncClock},
+		"table": {"table [coa]", "print the process image", (*Console).table},
+		"watch": {"watch [interval] [duration]", "print the process image every interval for the duration or until Enter",
+			(*Console).watch},
+		"save": {"save file.json|file.csv", "save the process image as a snapshot", (*Console).save},
+		"load": {"load file.json|file.csv", "load the points of a snapshot into the process image", (*Console).load},
+		"wait": {"wait duration", "wait, for example, for spontaneous updates", (*Console).wait},
+		"help": {"help", "print the commands", (*Console).help},
+		"quit": {"quit", "disconnect and quit", func(*Console, []string) error { return errQuit }},
+	}
+}
+
+/*
+Console is an interactive master built on iec104.Client. It executes the commands of the lines it reads, one per line,
+see help. The events of the connection which need attention, like the loss of the connection, the terminations of
+the commands and the ends of initialization, are written to the log writer as they are received, so that the output
+of a script only contains the results of its commands.
+*/
+type Console struct {
+	out     io.Writer
+	log     io.Writer
+	address string
+	coa     iec104.COA // default station of the commands
+	timeout time.Duration
+
+	mu     sync.Mutex
+	client *iec104.Client
+	done   chan struct{}     // closed when the client is disconnected
+	awaits chan iec104.Event // terminations of interrogations and confirmations of clock synchronizations
+	enter  chan struct{}     // lines read by Run while a command runs interactively, nil if it doesn't read them
+}
+
+func NewConsole(out, log io.Writer, address string, coa iec104.COA, timeout time.Duration) *Console {
+	return &Console{out: out, log: log, address: address, coa: coa, timeout: timeout}
+}
+
+/*
+Run executes the lines read from r until r ends or the quit command. Interactively, it prompts for each line and
+continues after the errors, which it prints. Otherwise, it stops at the first error and returns it, so that a script
+fails as a shell script with set -e does.
+*/
+func (c *Console) Run(r io.Reader, interactive bool) error {
+	lines := make(chan string)
+	if interactive {
+		c.enter = make(chan struct{})
+	}
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case c.enter <- struct{}{}: // Enter pressed to stop the command, like watch
+			}
+		}
+	}()
+	defer c.Close()
+
+	for {
+		if interactive {
+			fmt.Fprint(c.out, "iec104> ")
+		}
+		line, ok := <-lines
+		if !ok {
+			return nil
+		}
+		err := c.Exec(line)
+		switch {
+		case errors.Is(err, errQuit):
+			return nil
+		case err != nil && interactive:
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		case err != nil:
+			return fmt.Errorf("%s: %w", strings.TrimSpace(line), err)
+		}
+	}
+}
+
+// Exec executes the commands of the line, separated by semicolons. Empty commands and comments after # are skipped.
+func (c *Console) Exec(line string) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	for _, cmdline := range strings.Split(line, ";") {
+		args := strings.Fields(cmdline)
+		if len(args) == 0 {
+			continue
+		}
+		cmd, ok := commands[strings.ToLower(args[0])]
+		if !ok {
+			return fmt.Errorf("unknown command %q, see help", args[0])
+		}
+		if err := cmd.run(c, args[1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection, if any.
+func (c *Console) Close() {
+	_ = c.disconnect(nil)
+}
+
+func (c *Console) connect(args []string) error {
+	if len(args) > 1 {
+		return errUsage("connect")
+	}
+	if len(args) == 1 {
+		c.address = args[0]
+	}
+	if c.address == "" {
+		return errors.New("no address to connect to")
+	}
+	if err := c.disconnect(nil); err != nil {
+		return err
+	}
+	option, err := iec104.NewClientOption(c.address, nil, c.timeout)
+	if err != nil {
+		return err
+	}
+	client := iec104.NewClient(option.SetT1(c.timeout))
+	events := client.Events()
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	done, awaits := make(chan struct{}), make(chan iec104.Event, 16)
+	go c.receive(events, done, awaits)
+
+	c.mu.Lock()
+	c.client, c.done, c.awaits = client, done, awaits
+	c.mu.Unlock()
+	fmt.Fprintf(c.out, "connected to %s\n", c.address)
+	return nil
+}
+
+func (c *Console) disconnect([]string) error {
+	c.mu.Lock()
+	client, done := c.client, c.done
+	c.client, c.done, c.awaits = nil, nil, nil
+	c.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	client.Close()
+	close(done)
+	return nil
+}
+
+// receive receives the events of the client until it's disconnected. It writes the events which need attention to
+// the log, and hands the terminations and the confirmations awaited over to await.
+func (c *Console) receive(events <-chan iec104.Event, done chan struct{}, awaits chan iec104.Event) {
+	for {
+		var ev iec104.Event
+		select {
+		case ev = <-events:
+		case <-done:
+			return
+		}
+		switch ev := ev.(type) {
+		case iec104.InterrogationEndEvent, iec104.ClockSyncEvent:
+			select {
+			case awaits <- ev:
+			default:
+			}
+		case iec104.ConnectionEvent:
+			if ev.State == iec104.ConnectionLost {
+				fmt.Fprintf(c.log, "connection lost: %v\n", ev.Err)
+			}
+		case iec104.CommandResultEvent:
+			if ev.Negative || ev.COT == iec104.CotActTerm || ev.COT >= iec104.CotUnknownType {
+				fmt.Fprintf(c.log, "%s to IOA %d of COA %d: COT %d, negative %v\n", ev.TypeID.Name(), ev.IOA,
+					ev.COA, ev.COT, ev.Negative)
+			}
+		case iec104.EndOfInitializationEvent:
+			fmt.Fprintf(c.log, "end of initialization of COA %d, cause %d\n", ev.COA, ev.Cause)
+		case iec104.ProtocolErrorEvent:
+			fmt.Fprintf(c.log, "protocol error: %v\n", ev.Err)
+		}
+	}
+}
+
+// connected returns the client and the events awaited, or fails if the console isn't connected.
+func (c *Console) connected() (*iec104.Client, chan iec104.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil || !c.client.IsConnected() {
+		return nil, nil, errors.New("not connected, see connect")
+	}
+	return c.client, c.awaits, nil
+}
+
+// await sends the request, and waits at most the timeout for the event matched.
+func (c *Console) await(send func(*iec104.Client) error, match func(iec104.Event) bool) error {
+	client, awaits, err := c.connected()
+	if err != nil {
+		return err
+	}
+	for len(awaits) > 0 { // drop the events of the previous requests
+		<-awaits
+	}
+	if err := send(client); err != nil {
+		return err
+	}
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-awaits:
+			if match(ev) {
+				return nil
+			}
+		case <-timer.C:
+			return fmt.Errorf("no answer in %s", c.timeout)
+		}
+	}
+}
+
+func (c *Console) startDT([]string) error {
+	client, _, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return client.StartDT()
+}
+
+func (c *Console) stopDT([]string) error {
+	client, _, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return client.StopDT()
+}
+
+func (c *Console) interrogate(args []string) error {
+	if len(args) > 2 {
+		return errUsage("gi")
+	}
+	coa, err := c.station(args)
+	if err != nil {
+		return err
+	}
+	var group uint64
+	if len(args) == 2 {
+		if group, err = strconv.ParseUint(args[1], 10, 8); err != nil {
+			return fmt.Errorf("group %q: %w", args[1], err)
+		}
+	}
+	err = c.await(func(client *iec104.Client) error {
+		if group == 0 {
+			return client.SendGeneralInterrogation(coa)
+		}
+		return client.SendGroupInterrogation(coa, uint8(group))
+	}, terminates(iec104.CIcNa1, coa))
+	if err != nil {
+		return fmt.Errorf("interrogation of COA %d: %w", coa, err)
+	}
+	fmt.Fprintf(c.out, "interrogation of COA %d terminated\n", coa)
+	return nil
+}
+
+func (c *Console) interrogateCounters(args []string) error {
+	if len(args) > 1 {
+		return errUsage("ci")
+	}
+	coa, err := c.station(args)
+	if err != nil {
+		return err
+	}
+	err = c.await(func(client *iec104.Client) error {
+		return client.SendCounterInterrogation(coa)
+	}, terminates(iec104.CCiNa1, coa))
+	if err != nil {
+		return fmt.Errorf("counter interrogation of COA %d: %w", coa, err)
+	}
+	fmt.Fprintf(c.out, "counter interrogation of COA %d terminated\n", coa)
+	return nil
+}
+
+// terminates matches the termination of the interrogation of the station, any station of a global interrogation.
+func terminates(typeID iec104.TypeID, coa iec104.COA) func(iec104.Event) bool {
+	return func(ev iec104.Event) bool {
+		end, ok := ev.(iec104.InterrogationEndEvent)
+		return ok && end.TypeID == typeID && (coa == iec104.GlobalCOA || end.COA == coa)
+	}
+}
+
+func (c *Console) read(args []string) error {
+	if len(args) != 2 {
+		return errUsage("read")
+	}
+	coa, ioa, err := parseAddress(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	client, _, err := c.connected()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	p, err := client.Read(ctx, coa, ioa)
+	if err != nil {
+		return err
+	}
+	printPoints(c.out, []iec104.Point{p})
+	return nil
+}
+
+func (c *Console) singleCommand(args []string) error {
+	return c.switchCommand("sc", iec104.CScNa1, args)
+}
+
+func (c *Console) doubleCommand(args []string) error {
+	return c.switchCommand("dc", iec104.CDcNa1, args)
+}
+
+func (c *Console) stepCommand(args []string) error {
+	if len(args) < 3 || len(args) > 4 {
+		return errUsage("rc")
+	}
+	var value iec104.Scaled
+	switch strings.ToLower(args[2]) {
+	case "higher":
+		value = 1
+	case "lower":
+		value = -1
+	default:
+		return fmt.Errorf("step %q is neither higher nor lower", args[2])
+	}
+	return c.sendCommand(iec104.CRcNa1, args[0], args[1], value, args[3:])
+}
+
+// switchCommand sends the single or double command switching on or off.
+func (c *Console) switchCommand(name string, typeID iec104.TypeID, args []string) error {
+	if len(args) < 3 || len(args) > 4 {
+		return errUsage(name)
+	}
+	var value iec104.SinglePoint
+	switch strings.ToLower(args[2]) {
+	case "on", "close", "1":
+		value = true
+	case "off", "open", "0":
+	default:
+		return fmt.Errorf("state %q is neither on nor off", args[2])
+	}
+	return c.sendCommand(typeID, args[0], args[1], value, args[3:])
+}
+
+func (c *Console) setPoint(args []string) error {
+	if len(args) < 4 || len(args) > 5 {
+		return errUsage("sp")
+	}
+	typeID, err := iec104.ParseTypeID(args[2])
+	if err != nil {
+		return err
+	}
+	switch typeID {
+	case iec104.CSeNa1, iec104.CSeNb1, iec104.CSeNc1, iec104.CSeTa1, iec104.CSeTb1, iec104.CSeTc1:
+	default:
+		return fmt.Errorf("%s is not a type of set-point command", typeID.Name())
+	}
+	value, err := strconv.ParseFloat(args[3], 64)
+	if err != nil {
+		return fmt.Errorf("value %q: %w", args[3], err)
+	}
+	return c.sendCommand(typeID, args[0], args[1], iec104.Float(value), args[4:])
+}
+
+// sendCommand sends the command in the mode: select before operate (sbo), the default, select or execute only.
+func (c *Console) sendCommand(typeID iec104.TypeID, coaArg, ioaArg string, value iec104.TypedValue,
+	mode []string) error {
+	coa, ioa, err := parseAddress(coaArg, ioaArg)
+	if err != nil {
+		return err
+	}
+	steps := []bool{true, false} // select, then execute
+	if len(mode) == 1 {
+		switch strings.ToLower(mode[0]) {
+		case "sbo":
+		case "select":
+			steps = steps[:1]
+		case "execute", "direct":
+			steps = steps[1:]
+		default:
+			return fmt.Errorf("mode %q is neither sbo, select nor execute", mode[0])
+		}
+	}
+	client, _, err := c.connected()
+	if err != nil {
+		return err
+	}
+	for _, sel := range steps {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := client.SendCommand(ctx, coa, ioa, typeID, value, sel)
+		cancel()
+		if err != nil {
+			return err
+		}
+		action := "executed"
+		if sel {
+			action = "selected"
+		}
+		fmt.Fprintf(c.out, "%s to IOA %d of COA %d %s\n", typeID.Name(), ioa, coa, action)
+	}
+	return nil
+}
+
+func (c *Console) syncClock(args []string) error {
+	if len(args) > 1 {
+		return errUsage("clock")
+	}
+	coa, err := c.station(args)
+	if err != nil {
+		return err
+	}
+	err = c.await(func(client *iec104.Client) error {
+		return client.SendClockSync(coa, time.Now())
+	}, func(ev iec104.Event) bool {
+		con, ok := ev.(iec104.ClockSyncEvent)
+		return ok && (coa == iec104.GlobalCOA || con.COA == coa)
+	})
+	if err != nil {
+		return fmt.Errorf("clock synchronization of COA %d: %w", coa, err)
+	}
+	fmt.Fprintf(c.out, "clock of COA %d synchronized\n", coa)
+	return nil
+}
+
+func (c *Console) table(args []string) error {
+	if len(args) > 1 {
+		return errUsage("table")
+	}
+	points, err := c.points(args)
+	if err != nil {
+		return err
+	}
+	printPoints(c.out, points)
+	return nil
+}
+
+// watch prints the process image every interval until Enter is pressed interactively, or the duration passes if it
+// isn't zero. The terminal is cleared before each table only interactively, so that the output of a script keeps all
+// the tables.
+func (c *Console) watch(args []string) error {
+	if len(args) > 2 {
+		return errUsage("watch")
+	}
+	interval, duration := time.Second, time.Duration(0)
+	var err error
+	if len(args) > 0 {
+		if interval, err = time.ParseDuration(args[0]); err != nil || interval <= 0 {
+			return fmt.Errorf("interval %q: %v", args[0], err)
+		}
+	}
+	if len(args) > 1 {
+		if duration, err = time.ParseDuration(args[1]); err != nil {
+			return fmt.Errorf("duration %q: %w", args[1], err)
+		}
+	}
+	if duration == 0 && c.enter == nil {
+		return errors.New("watch needs a duration when the console isn't interactive")
+	}
+	if _, _, err := c.connected(); err != nil {
+		return err
+	}
+	var stop <-chan time.Time
+	if duration > 0 {
+		stop = time.After(duration)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.mu.Lock()
+		client := c.client
+		c.mu.Unlock()
+		if client == nil {
+			return nil
+		}
+		if c.enter != nil {
+			fmt.Fprint(c.out, "\033[H\033[2J") // clear the terminal
+			fmt.Fprintf(c.out, "%s, every %s, press Enter to stop\n", time.Now().Format(timeLayout), interval)
+		} else {
+			fmt.Fprintf(c.out, "%s\n", time.Now().Format(timeLayout))
+		}
+		printPoints(c.out, client.ProcessImage().Snapshot())
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		case <-c.enter:
+			return nil
+		}
+	}
+}
+
+func (c *Console) save(args []string) error {
+	if len(args) != 1 {
+		return errUsage("save")
+	}
+	format, err := iec104.SnapshotFormatOf(args[0])
+	if err != nil {
+		return err
+	}
+	client, _, err := c.connected()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := client.ProcessImage().WriteSnapshot(f, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%d points saved to %s\n", client.ProcessImage().Len(), args[0])
+	return nil
+}
+
+func (c *Console) load(args []string) error {
+	if len(args) != 1 {
+		return errUsage("load")
+	}
+	format, err := iec104.SnapshotFormatOf(args[0])
+	if err != nil {
+		return err
+	}
+	client, _, err := c.connected()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := client.ProcessImage().ReadSnapshot(f, format); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	fmt.Fprintf(c.out, "points of %s loaded\n", args[0])
+	return nil
+}
+
+func (c *Console) wait(args []string) error {
+	if len(args) != 1 {
+		return errUsage("wait")
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return err
+	}
+	time.Sleep(d)
+	return nil
+}
+
+func (c *Console) help([]string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(c.out, "  %-46s %s\n", commands[name].usage, commands[name].help)
+	}
+	return nil
+}
+
+// points returns the process image, or the points of the station of the arguments.
+func (c *Console) points(args []string) ([]iec104.Point, error) {
+	client, _, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return client.ProcessImage().Snapshot(), nil
+	}
+	coa, err := c.station(args)
+	if err != nil {
+		return nil, err
+	}
+	return client.ProcessImage().Station(coa), nil
+}
+
+// station returns the common address of the first argument, or the default station of the console.
+func (c *Console) station(args []string) (iec104.COA, error) {
+	if len(args) == 0 {
+		return c.coa, nil
+	}
+	coa, err := strconv.ParseUint(args[0], 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("COA %q: %w", args[0], err)
+	}
+	return iec104.COA(coa), nil
+}
+
+func parseAddress(coaArg, ioaArg string) (iec104.COA, iec104.IOA, error) {
+	coa, err := strconv.ParseUint(coaArg, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("COA %q: %w", coaArg, err)
+	}
+	ioa, err := strconv.ParseUint(ioaArg, 10, 24)
+	if err != nil {
+		return 0, 0, fmt.Errorf("IOA %q: %w", ioaArg, err)
+	}
+	return iec104.COA(coa), iec104.IOA(ioa), nil
+}
+
+func errUsage(name string) error {
+	return fmt.Errorf("usage: %s", commands[name].usage)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+// testStation serves a station of points, which confirms the commands and the clock synchronizations.
+func testStation(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := logrus.New()
+	lg.SetOutput(io.Discard)
+	s := iec104.NewServer(listener.Addr().String(), nil, lg)
+	db := iec104.NewPointDatabase().
+		Add(iec104.Point{COA: 1, IOA: 1, TypeID: iec104.MDpNa1, Value: 2}).
+		Add(iec104.Point{COA: 1, IOA: 100, TypeID: iec104.MMeNc1, Value: 12.5, Quality: iec104.IV | iec104.OV}, 2).
+		Add(iec104.Point{COA: 1, IOA: 200, TypeID: iec104.MItNa1, Value: 3})
+	confirm := iec104.HandlerFunc(func(c *iec104.Client, apdu *iec104.APDU) error {
+		return c.SendIFrame(apdu.Mirror(iec104.CotActCon, false))
+	})
+	mux := iec104.NewServeMux().
+		HandleRoute(iec104.Route{TypeIDs: []iec104.TypeID{iec104.CIcNa1, iec104.CCiNa1, iec104.CRdNa1}}, db).
+		Handle(iec104.CScNa1, confirm).
+		Handle(iec104.CDcNa1, confirm).
+		Handle(iec104.CSeNc1, confirm).
+		Handle(iec104.CCsNa1, confirm)
+	go func() { _ = s.Serve(listener, mux) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return listener.Addr().String()
+}
+
+func TestConsole(t *testing.T) {
+	address := testStation(t)
+	out := &bytes.Buffer{}
+	console := NewConsole(out, io.Discard, address, 1, 2*time.Second)
+	defer console.Close()
+	image := filepath.Join(t.TempDir(), "image.csv")
+
+	tests := []struct {
+		line string
+		want []string // in the output
+		err  string   // in the error
+	}{
+		{line: "table", err: "not connected"},
+		{line: "connect", want: []string{"connected to " + address}},
+		{line: "gi; table", want: []string{"interrogation of COA 1 terminated", "M_DP_NA_1", "on",
+			"M_ME_NC_1", "12.5", "IV|OV"}},
+		{line: "gi 1 2", want: []string{"interrogation of COA 1 terminated"}},
+		{line: "gi 1 17", err: "out of range"},
+		{line: "ci 1 # counters", want: []string{"counter interrogation of COA 1 terminated"}},
+		{line: "table 1", want: []string{"M_IT_NA_1", "300"}},
+		{line: "table 2", want: []string{"COA"}},
+		{line: "read 1 100", want: []string{"M_ME_NC_1", "12.5"}},
+		{line: "read 1 300", err: "IOA"},
+		{line: "sc 1 6001 on", want: []string{"C_SC_NA_1 to IOA 6001 of COA 1 selected",
+			"C_SC_NA_1 to IOA 6001 of COA 1 executed"}},
+		{line: "dc 1 6002 off execute", want: []string{"C_DC_NA_1 to IOA 6002 of COA 1 executed"}},
+		{line: "sp 1 6003 C_SE_NC_1 12.5 select", want: []string{"C_SE_NC_1 to IOA 6003 of COA 1 selected"}},
+		{line: "sp 1 6003 M_ME_NC_1 12.5", err: "not a type of set-point command"},
+		{line: "sc 1 6001 maybe", err: "neither on nor off"},
+		{line: "sc 1", err: "usage: sc"},
+		{line: "clock", want: []string{"clock of COA 1 synchronized"}},
+		{line: "watch 10ms 30ms", want: []string{"M_ME_NC_1"}},
+		{line: "save " + image, want: []string{"3 points saved to " + image}},
+		{line: "save image.txt", err: "unknown snapshot format"},
+		{line: "load ../../testdata/points.json; table 2", want: []string{"M_ME_TF_1", "NT"}},
+		{line: "load " + image + "; table 1", want: []string{"M_IT_NA_1", "300"}},
+		{line: "help", want: []string{"gi [coa] [group]"}},
+		{line: "frobnicate", err: "unknown command"},
+		{line: "disconnect; table", err: "not connected"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		err := console.Exec(tt.line)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Exec(%q) error = %v, want %q", tt.line, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Exec(%q) error = %v", tt.line, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Exec(%q) output %q, want %q", tt.line, out.String(), want)
+			}
+		}
+	}
+}
+
+func TestConsole_Run(t *testing.T) {
+	address := testStation(t)
+	out := &bytes.Buffer{}
+	script := "connect " + address + "\ngi\nread 1 300\ntable\n"
+	err := NewConsole(out, io.Discard, "", 1, 2*time.Second).Run(strings.NewReader(script), false)
+	if err == nil || !strings.Contains(err.Error(), "read 1 300") {
+		t.Errorf("Run() error = %v, want the error of the read command", err)
+	}
+	if strings.Contains(out.String(), "M_DP_NA_1") {
+		t.Errorf("Run() must stop at the first error, got %q", out.String())
+	}
+
+	out.Reset()
+	script = "connect " + address + "\nread 1 300\nquit\ntable\n"
+	if err := NewConsole(out, io.Discard, "", 1, 2*time.Second).Run(strings.NewReader(script), true); err != nil {
+		t.Errorf("Run() interactively error = %v, want to continue after the errors", err)
+	}
+	if !strings.Contains(out.String(), "error: ") || strings.Contains(out.String(), "COA  IOA") {
+		t.Errorf("Run() interactively output %q, want the error printed and to quit", out.String())
+	}
+
+	// watch doesn't consume the next line of a script, nor clear the terminal
+	out.Reset()
+	script = "connect " + address + "\nwatch 10ms 30ms\nread 1 300\n"
+	err = NewConsole(out, io.Discard, "", 1, 2*time.Second).Run(strings.NewReader(script), false)
+	if err == nil || !strings.Contains(err.Error(), "read 1 300") {
+		t.Errorf("Run() error = %v, want the error of the read command after watch", err)
+	}
+	if strings.Contains(out.String(), "\033[2J") {
+		t.Errorf("Run() output %q, want no clearing of the terminal", out.String())
+	}
+	script = "connect " + address + "\nwatch 10ms\n"
+	if err := NewConsole(out, io.Discard, "", 1, 2*time.Second).Run(strings.NewReader(script), false); err == nil {
+		t.Errorf("Run() of watch without a duration in a script must fail")
+	}
+
+	// interactively, Enter stops watch
+	out.Reset()
+	script = "connect " + address + "\nwatch 10ms\n\nread 1 300\nquit\n"
+	if err := NewConsole(out, io.Discard, "", 1, 2*time.Second).Run(strings.NewReader(script), true); err != nil {
+		t.Errorf("Run() interactively error = %v", err)
+	}
+	if !strings.Contains(out.String(), "press Enter to stop") || !strings.Contains(out.String(), "error: ") {
+		t.Errorf("Run() interactively output %q, want watch stopped by Enter and the read command", out.String())
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Command iec104cli is an interactive master (controlling station) for commissioning and troubleshooting controlled
+stations. It connects to a station, interrogates it, reads its objects, sends single, double, regulating step and
+set-point commands with select before operate, synchronizes its clock, and prints the process image received with the
+quality flags, which it saves and loads as snapshots in JSON or CSV, see help for the commands.
+
+Usage:
+
+	iec104cli [-addr host:2404] [-coa 1] [-timeout 5s] [-v]
+	iec104cli -addr host:2404 -c "gi; sc 1 6001 on; wait 2s; table"
+	iec104cli -addr host:2404 -f script.txt
+
+Without -c and -f, it reads the commands interactively from the standard input. With them, it runs the commands of
+the script, or of the standard input if the file is "-", stops at the first command which fails and exits with status
+1, so it can be used in shell scripts. The events which need attention, like the loss of the connection and the
+terminations of the commands, are printed to the standard error.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	var (
+		address = flag.String("addr", "", "address of the station to connect to at start")
+		coa     = flag.Uint("coa", 1, "common address of the station of the commands without one")
+		timeout = flag.Duration("timeout", 5*time.Second, "time-out of the connection and the confirmations")
+		script  = flag.String("c", "", "commands to run, separated by semicolons, instead of reading them interactively")
+		file    = flag.String("f", "", "file of the commands to run, - for the standard input")
+		verbose = flag.Bool("v", false, "log the frames and the APDUs")
+	)
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	if *verbose {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+	iec104.SetLogger(logger)
+
+	console := NewConsole(os.Stdout, os.Stderr, *address, iec104.COA(*coa), *timeout)
+	var (
+		input       io.Reader = os.Stdin
+		interactive           = *script == "" && *file == ""
+	)
+	switch {
+	case *script != "":
+		input = strings.NewReader(*script)
+	case *file != "" && *file != "-":
+		script, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		input = strings.NewReader(string(script))
+	}
+
+	if *address != "" {
+		if err := console.Exec("connect"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else if interactive {
+		fmt.Println("not connected, see connect and help")
+	}
+	if err := console.Run(input, interactive); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
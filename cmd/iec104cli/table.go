@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+// timeLayout is the layout of the times of the table, to the millisecond.
+const timeLayout = "2006-01-02 15:04:05.000"
+
+// printPoints prints the points as a table with their quality flags and the time of their time tag, or the time they
+// are received if their type has no time tag.
+func printPoints(w io.Writer, points []iec104.Point) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COA\tIOA\tTYPE\tVALUE\tQUALITY\tCOT\tTIME")
+	for _, p := range points {
+		ts := p.Ts
+		if ts.IsZero() {
+			ts = p.Received
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%d\t%s\n", p.COA, p.IOA, p.TypeID.Name(), formatValue(p),
+			formatQuality(p.Quality), p.COT, ts.Format(timeLayout))
+	}
+	_ = tw.Flush()
+}
+
+// formatValue formats the value of the point by its type: the state of a single or double point, the reading of a
+// counter, or the measured value.
+func formatValue(p iec104.Point) string {
+	switch v := p.Typed.(type) {
+	case iec104.SinglePoint:
+		if v {
+			return "on"
+		}
+		return "off"
+	case iec104.DoublePoint:
+		return v.String()
+	case iec104.BinaryCounter:
+		return strconv.FormatInt(int64(v.Value), 10)
+	case iec104.Float:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return strconv.FormatFloat(p.Value, 'g', -1, 64)
+}
+
+// formatQuality formats the flags of the quality descriptor set, separated by "|", or "-" if none is set.
+func formatQuality(q iec104.QualityDescriptor) string {
+	if q == 0 {
+		return "-"
+	}
+	return strings.Join(q.Names(), "|")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultInterval is the interval between the updates of the points by their profiles.
+const DefaultInterval = time.Second
+
+/*
+Config is the configuration of the simulator, read from a YAML or JSON file:
+
+	listen: ":2404"
+	interval: 1s
+	seed: 42
+	snapshot: points.csv
+	points:
+	  - {coa: 1, ioa: 100, type: M_ME_NC_1, value: 50, profile: {kind: sine, amplitude: 10, period: 1m}}
+	  - {coa: 1, ioa: 1, type: M_SP_TB_1, value: 0, command: 6001}
+	faults:
+	  - {kind: negative-confirmation, at: 30s, duration: 30s, ioa: 6001}
+	  - {kind: disconnect, at: 2m}
+
+The durations are strings such as "1.5s" or "2m". The snapshot is a file of constant points in JSON or CSV, see
+iec104.SnapshotPoint, which are served before the points of the configuration, so the simulator shares the fixtures of
+the tests.
+*/
+type Config struct {
+	Listen   string        `yaml:"listen"`
+	Interval time.Duration `yaml:"interval"`
+	Seed     int64         `yaml:"seed"`     // seed of the random walks, the current time if zero
+	Snapshot string        `yaml:"snapshot"` // file of the initial points, relative to the configuration
+	Points   []PointConfig `yaml:"points"`
+	Faults   []Fault       `yaml:"faults"`
+}
+
+// PointConfig is a point of the simulated stations.
+type PointConfig struct {
+	COA     iec104.COA     `yaml:"coa"`
+	IOA     iec104.IOA     `yaml:"ioa"`
+	Type    string         `yaml:"type"` // name or number of the type in monitor direction, for example, M_ME_NC_1
+	Value   float64        `yaml:"value"`
+	Quality string         `yaml:"quality"` // quality descriptor such as "IV" or "NT|SB", valid if empty
+	Groups  []uint8        `yaml:"groups"`  // interrogation groups
+	Profile *ProfileConfig `yaml:"profile"` // constant if nil
+
+	// Command is the IOA of the command which sets the point as its feedback: a single command for a single point, a
+	// double command for a double point, and a set-point command of the same value type for a measured value.
+	Command iec104.IOA `yaml:"command"`
+
+	typeID  iec104.TypeID
+	quality iec104.QualityDescriptor
+}
+
+// LoadConfig reads the configuration from the file, whose snapshot is relative to the directory of the file.
+func LoadConfig(name string) (*Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data, filepath.Dir(name))
+}
+
+// ParseConfig parses the configuration in YAML or JSON, which is a subset of YAML. Its snapshot is relative to the
+// working directory.
+func ParseConfig(data []byte) (*Config, error) {
+	return parseConfig(data, "")
+}
+
+func parseConfig(data []byte, dir string) (*Config, error) {
+	config := &Config{Listen: ":2404", Interval: DefaultInterval}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if config.Snapshot != "" {
+		if !filepath.IsAbs(config.Snapshot) {
+			config.Snapshot = filepath.Join(dir, config.Snapshot)
+		}
+		if err := config.loadSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadSnapshot prepends the points of the snapshot to the points of the configuration.
+func (config *Config) loadSnapshot() error {
+	format, err := iec104.SnapshotFormatOf(config.Snapshot)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(config.Snapshot)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	snapshot, err := iec104.DecodeSnapshot(f, format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", config.Snapshot, err)
+	}
+	points := make([]PointConfig, 0, len(snapshot)+len(config.Points))
+	for _, p := range snapshot {
+		points = append(points, PointConfig{COA: p.COA, IOA: p.IOA, Type: p.TypeID.Name(), Value: p.Value,
+			Quality: strings.Join(p.Quality.Names(), "|"), Groups: p.Groups})
+	}
+	config.Points = append(points, config.Points...)
+	return nil
+}
+
+func (config *Config) validate() error {
+	if config.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s", config.Interval)
+	}
+	type address struct {
+		coa iec104.COA
+		ioa iec104.IOA
+	}
+	points := make(map[address]bool)
+	commands := make(map[address]bool)
+	for i := range config.Points {
+		p := &config.Points[i]
+		typeID, err := iec104.ParseTypeID(p.Type)
+		if err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+		if _, err := iec104.NewInformationElement(typeID, iec104.NewTypedValue(typeID, p.Value), 0,
+			time.Time{}); err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+		if p.quality, err = iec104.ParseQuality(p.Quality); err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+		if p.COA == 0 || p.COA == iec104.GlobalCOA {
+			return fmt.Errorf("point %d: invalid COA %d", i, p.COA)
+		}
+		if points[address{p.COA, p.IOA}] {
+			return fmt.Errorf("point %d: duplicate IOA %d of COA %d", i, p.IOA, p.COA)
+		}
+		points[address{p.COA, p.IOA}] = true
+		if p.Command != 0 {
+			if _, ok := commandTypes[typeID.Family()]; !ok {
+				return fmt.Errorf("point %d: %s can't be commanded", i, typeID.Name())
+			}
+			if commands[address{p.COA, p.Command}] {
+				return fmt.Errorf("point %d: duplicate command IOA %d of COA %d", i, p.Command, p.COA)
+			}
+			commands[address{p.COA, p.Command}] = true
+		}
+		if err := p.Profile.validate(); err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+		p.typeID = typeID
+	}
+	for i, f := range config.Faults {
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("fault %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// stations returns the common addresses of the points in the order they appear.
+func (config *Config) stations() []iec104.COA {
+	var coas []iec104.COA
+	seen := make(map[iec104.COA]bool)
+	for _, p := range config.Points {
+		if !seen[p.COA] {
+			seen[p.COA] = true
+			coas = append(coas, p.COA)
+		}
+	}
+	return coas
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+// The kinds of the faults which the simulator injects.
+const (
+	FaultDelayConfirmation    = "delay-confirmation"    // confirms the commands after the delay
+	FaultNegativeConfirmation = "negative-confirmation" // confirms the commands negatively
+	FaultDropTestFrames       = "drop-test-frames"      // doesn't answer TESTFR act, so the master's t1 expires
+	FaultSequenceError        = "sequence-error"        // sends the next I-frame with a wrong N(S)
+	FaultDisconnect           = "disconnect"            // closes the connections
+)
+
+/*
+Fault is a fault scripted at a time since the simulator is started. The faults of the commands and the dropped test
+frames last for the duration, or until the simulator stops if it's zero, while the sequence error and the disconnect
+happen once on all the connections at the time.
+*/
+type Fault struct {
+	Kind     string        `yaml:"kind"`
+	At       time.Duration `yaml:"at"`
+	Duration time.Duration `yaml:"duration"`
+	Delay    time.Duration `yaml:"delay"` // delay of the confirmations
+	COA      iec104.COA    `yaml:"coa"`   // station of the faulty commands, any if zero, only for the commands
+	IOA      iec104.IOA    `yaml:"ioa"`   // IOA of the faulty commands, any if zero, only for the commands
+}
+
+func (f Fault) validate() error {
+	switch f.Kind {
+	case FaultDelayConfirmation:
+		if f.Delay <= 0 {
+			return fmt.Errorf("%s without delay", f.Kind)
+		}
+	case FaultNegativeConfirmation:
+	case FaultDropTestFrames, FaultSequenceError, FaultDisconnect:
+		if f.COA != 0 || f.IOA != 0 {
+			return fmt.Errorf("%s of the connections with a common or object address", f.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown fault %q", f.Kind)
+	}
+	if f.At < 0 || f.Duration < 0 {
+		return fmt.Errorf("%s at negative time", f.Kind)
+	}
+	return nil
+}
+
+// once reports whether the fault happens once instead of lasting.
+func (f Fault) once() bool {
+	return f.Kind == FaultSequenceError || f.Kind == FaultDisconnect
+}
+
+// active reports whether the lasting fault is in effect at the elapsed time for the command.
+func (f Fault) active(elapsed time.Duration, coa iec104.COA, ioa iec104.IOA) bool {
+	return elapsed >= f.At && (f.Duration == 0 || elapsed < f.At+f.Duration) &&
+		(f.COA == 0 || f.COA == coa) && (f.IOA == 0 || f.IOA == ioa)
+}
+
+// faultListener accepts the connections whose frames the faults are injected into.
+type faultListener struct {
+	net.Listener
+	sim *Simulator
+}
+
+func (l *faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c := &faultConn{Conn: conn, sim: l.sim}
+	l.sim.addConn(c)
+	return c, nil
+}
+
+// faultConn is a connection which drops the test frames received and skews the send sequence number sent when the
+// faults are in effect.
+type faultConn struct {
+	net.Conn
+	sim *Simulator
+
+	frame     []byte // the rest of the frame being read
+	skewed    int32  // 1 if the next I-frame is sent with a wrong N(S)
+	closeOnce sync.Once
+}
+
+// testFrameAct is the U-frame TESTFR act.
+var testFrameAct = []byte{0x68, 0x04, 0x43, 0x00, 0x00, 0x00}
+
+func (c *faultConn) Read(p []byte) (int, error) {
+	for len(c.frame) == 0 {
+		frame, err := readFrame(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		if string(frame) == string(testFrameAct) && c.sim.fault(FaultDropTestFrames, 0, 0) != nil {
+			c.sim.lg.Infof("drop TESTFR act from %s", c.RemoteAddr())
+			continue
+		}
+		c.frame = frame
+	}
+	n := copy(p, c.frame)
+	c.frame = c.frame[n:]
+	return n, nil
+}
+
+// readFrame reads an APDU, or only its first 2 bytes if it doesn't start with the start byte, which the server rejects.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0x68 {
+		return header, nil
+	}
+	frame := make([]byte, 2+int(header[1]))
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[2:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Write writes a frame, the server writes each frame by a call.
+func (c *faultConn) Write(p []byte) (int, error) {
+	if len(p) >= 6 && p[0] == 0x68 && p[2]&0x01 == 0 && atomic.CompareAndSwapInt32(&c.skewed, 1, 0) {
+		frame := append([]byte(nil), p...)
+		ssn := binary.LittleEndian.Uint16(frame[2:4]) >> 1
+		binary.LittleEndian.PutUint16(frame[2:4], ((ssn+1)&0x7fff)<<1)
+		c.sim.lg.Infof("send I-frame with N(S)=%d instead of %d to %s", (ssn+1)&0x7fff, ssn, c.RemoteAddr())
+		if _, err := c.Conn.Write(frame); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *faultConn) Close() error {
+	c.closeOnce.Do(func() { c.sim.removeConn(c) })
+	return c.Conn.Close()
+}
+
+// inject injects the fault which happens once into all the connections.
+func (s *Simulator) inject(f Fault) {
+	s.mu.Lock()
+	conns := make([]*faultConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	s.lg.Infof("inject %s into %d connections", f.Kind, len(conns))
+	for _, c := range conns {
+		switch f.Kind {
+		case FaultDisconnect:
+			_ = c.Close()
+		case FaultSequenceError:
+			atomic.StoreInt32(&c.skewed, 1)
+		}
+	}
+}
+
+// fault returns the lasting fault of the kind in effect for the command, or nil.
+func (s *Simulator) fault(kind string, coa iec104.COA, ioa iec104.IOA) *Fault {
+	elapsed := time.Since(s.start)
+	for i := range s.config.Faults {
+		if f := &s.config.Faults[i]; f.Kind == kind && f.active(elapsed, coa, ioa) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) addConn(c *faultConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c] = true
+}
+
+func (s *Simulator) removeConn(c *faultConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
@@ -0,0 +1,65 @@
+/*
+Command iec104sim simulates controlled stations (RTUs) for testing controlling stations, for example in CI. It serves
+the points of a YAML or JSON configuration, see Config, whose values are generated by profiles (constant, ramp, sine,
+random walk and toggle), executes the commands to the points as their feedback, and injects the faults scripted:
+delayed or negative confirmations of the commands, dropped test frames, sequence errors and disconnects.
+
+Usage:
+
+	iec104sim -config points.yaml [-listen :2404] [-v]
+
+It runs until it's interrupted.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	configFile := flag.String("config", "", "configuration of the points and the faults, in YAML or JSON")
+	listen := flag.String("listen", "", "address to listen on, instead of the one of the configuration")
+	verbose := flag.Bool("v", false, "log the frames and the APDUs handled")
+	flag.Parse()
+
+	logger := logrus.New()
+	if *verbose {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+	iec104.SetLogger(logger)
+	if *configFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	config, err := LoadConfig(*configFile)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+
+	sim := NewSimulator(config, logger)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := sim.Shutdown(shutdown); err != nil {
+			logger.Warnf("shut down: %v", err)
+		}
+	}()
+	if err := sim.ListenAndServe(); err != nil && !errors.Is(err, iec104.ErrServerClosed) {
+		logger.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+// The kinds of the profiles which generate the values of the points.
+const (
+	ProfileConstant   = "constant"    // the initial value
+	ProfileRamp       = "ramp"        // the initial value plus rate per second, wrapped into [min, max) if max > min
+	ProfileSine       = "sine"        // the initial value plus a sine wave of the amplitude and the period
+	ProfileRandomWalk = "random-walk" // a random step of at most step per update, limited to [min, max] if max > min
+	ProfileToggle     = "toggle"      // switches between off and on every period
+)
+
+// ProfileConfig is the profile which generates the values of a point.
+type ProfileConfig struct {
+	Kind      string        `yaml:"kind"`
+	Rate      float64       `yaml:"rate"`
+	Amplitude float64       `yaml:"amplitude"`
+	Period    time.Duration `yaml:"period"`
+	Step      float64       `yaml:"step"`
+	Min       float64       `yaml:"min"`
+	Max       float64       `yaml:"max"`
+}
+
+func (p *ProfileConfig) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Kind {
+	case ProfileConstant, ProfileRamp, ProfileRandomWalk:
+	case ProfileSine, ProfileToggle:
+		if p.Period <= 0 {
+			return fmt.Errorf("profile %s without period", p.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown profile %q", p.Kind)
+	}
+	return nil
+}
+
+// next returns the value of the point of the type at the elapsed time since the simulator is started, whose initial
+// value is initial and whose latest value is last.
+func (p *ProfileConfig) next(typeID iec104.TypeID, initial, last float64, elapsed time.Duration,
+	rnd *rand.Rand) float64 {
+	if p == nil {
+		return last
+	}
+	switch p.Kind {
+	case ProfileRamp:
+		v := initial + p.Rate*elapsed.Seconds()
+		if p.Max > p.Min {
+			v = p.Min + math.Mod(v-p.Min, p.Max-p.Min)
+			if v < p.Min {
+				v += p.Max - p.Min
+			}
+		}
+		return v
+	case ProfileSine:
+		return initial + p.Amplitude*math.Sin(2*math.Pi*elapsed.Seconds()/p.Period.Seconds())
+	case ProfileRandomWalk:
+		v := last + (2*rnd.Float64()-1)*p.Step
+		if p.Max > p.Min {
+			v = math.Max(p.Min, math.Min(p.Max, v))
+		}
+		return v
+	case ProfileToggle:
+		if int64(elapsed/p.Period)%2 == 1 {
+			return toggled(typeID, initial)
+		}
+		return initial
+	}
+	return last
+}
+
+// toggled returns the other state of a single point, 0 (off) or 1 (on), or of a double point, 1 (off) or 2 (on).
+func toggled(typeID iec104.TypeID, v float64) float64 {
+	if typeID.Family() == iec104.MDpNa1 {
+		if v == float64(iec104.DoublePointOn) {
+			return float64(iec104.DoublePointOff)
+		}
+		return float64(iec104.DoublePointOn)
+	}
+	if v != 0 {
+		return 0
+	}
+	return 1
+}
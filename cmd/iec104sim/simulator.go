@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+// commandTypes are the types of the commands which set the points of the type families.
+var commandTypes = map[iec104.TypeID][]iec104.TypeID{
+	iec104.MSpNa1: {iec104.CScNa1, iec104.CScTa1},
+	iec104.MDpNa1: {iec104.CDcNa1, iec104.CDcTa1},
+	iec104.MMeNa1: {iec104.CSeNa1, iec104.CSeTa1},
+	iec104.MMeNb1: {iec104.CSeNb1, iec104.CSeTb1},
+	iec104.MMeNc1: {iec104.CSeNc1, iec104.CSeTc1},
+}
+
+/*
+Simulator is a controlled station built on iec104.Server, which serves the points of its configuration:
+  - the points are answered from an iec104.PointDatabase to the interrogations and the read commands, and their
+    profiles change them every interval, which are sent spontaneously;
+  - the commands are confirmed, executed and terminated, and the point commanded is set to the value of the command
+    and sent as return information, after which it doesn't follow its profile anymore;
+  - the clock synchronization, test, delay acquisition and reset process commands are answered as a station does;
+  - the faults are injected at the times scripted.
+*/
+type Simulator struct {
+	config *Config
+	server *iec104.Server
+	db     *iec104.PointDatabase
+	lg     *logrus.Logger
+	start  time.Time
+
+	mu       sync.Mutex
+	points   []*point
+	commands map[address]*point
+	conns    map[*faultConn]bool
+	rnd      *rand.Rand
+	cancel   context.CancelFunc
+	timers   []*time.Timer
+}
+
+type address struct {
+	coa iec104.COA
+	ioa iec104.IOA
+}
+
+// point is the state of a point of the configuration.
+type point struct {
+	*PointConfig
+	last      float64 // latest value generated or commanded
+	commanded bool    // set by a command, so it doesn't follow its profile anymore
+}
+
+func NewSimulator(config *Config, lg *logrus.Logger) *Simulator {
+	s := &Simulator{
+		config:   config,
+		server:   iec104.NewServer(config.Listen, nil, lg),
+		db:       iec104.NewPointDatabase(),
+		lg:       lg,
+		commands: make(map[address]*point),
+		conns:    make(map[*faultConn]bool),
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s.rnd = rand.New(rand.NewSource(seed))
+
+	for i := range config.Points {
+		p := &point{PointConfig: &config.Points[i], last: config.Points[i].Value}
+		s.points = append(s.points, p)
+		if p.Command != 0 {
+			s.commands[address{p.COA, p.Command}] = p
+		}
+		s.db.Add(iec104.Point{COA: p.COA, IOA: p.IOA, TypeID: p.typeID, Value: p.Value, Quality: p.quality,
+			Ts: time.Now()}, p.Groups...)
+	}
+	stations := config.stations()
+	s.server.SetCommonAddresses(stations...).SetEndOfInitialization(iec104.CoiLocalPowerOn, stations...)
+	return s
+}
+
+// Server returns the server of the simulator, for example, to set its redundancy groups before it serves.
+func (s *Simulator) Server() *iec104.Server {
+	return s.server
+}
+
+// PointDatabase returns the points served by the simulator.
+func (s *Simulator) PointDatabase() *iec104.PointDatabase {
+	return s.db
+}
+
+// Handler returns the handler of the ASDUs the simulator receives.
+func (s *Simulator) Handler() iec104.Handler {
+	mux := iec104.NewServeMux().Use(iec104.Recover, iec104.Logging(s.lg))
+	mux.HandleRoute(iec104.Route{TypeIDs: []iec104.TypeID{iec104.CIcNa1, iec104.CCiNa1, iec104.CRdNa1}}, s.db)
+	for _, types := range commandTypes {
+		for _, typeID := range types {
+			mux.Handle(typeID, s.command)
+		}
+	}
+	return mux.
+		Handle(iec104.CCsNa1, s.syncClock).
+		Handle(iec104.CTsNb1, iec104.ServeTestCommand).
+		Handle(iec104.CTsTa1, iec104.ServeTestCommand).
+		Handle(iec104.CCdNa1, iec104.ServeDelayAcquisition).
+		Handle(iec104.CRpNc1, iec104.ResetProcess(s.reset))
+}
+
+// ListenAndServe listens on the address of the configuration and serves until Shutdown is called.
+func (s *Simulator) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve starts the profiles and the faults, and serves the connections accepted by the listener until Shutdown is
+// called.
+func (s *Simulator) Serve(listener net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.start = time.Now()
+	s.cancel = cancel
+	for _, f := range s.config.Faults {
+		if f := f; f.once() {
+			s.timers = append(s.timers, time.AfterFunc(f.At, func() { s.inject(f) }))
+		}
+	}
+	s.mu.Unlock()
+	go s.generate(ctx)
+
+	s.lg.Infof("simulate %d points of stations %v on %s", len(s.points), s.config.stations(), listener.Addr())
+	return s.server.Serve(&faultListener{Listener: listener, sim: s}, s.Handler())
+}
+
+// Shutdown stops the profiles and the faults, and shuts down the server.
+func (s *Simulator) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for _, t := range s.timers {
+		t.Stop()
+	}
+	s.mu.Unlock()
+	return s.server.Shutdown(ctx)
+}
+
+// generate updates the points by their profiles every interval.
+func (s *Simulator) generate(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.update(time.Since(s.start))
+		}
+	}
+}
+
+// update generates the values of the points at the elapsed time, and sends the values changed spontaneously.
+func (s *Simulator) update(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.points {
+		if p.Profile == nil || p.commanded {
+			continue
+		}
+		p.last = p.Profile.next(p.typeID, p.Value, p.last, elapsed, s.rnd)
+		value := iec104.NewTypedValue(p.typeID, p.last)
+		if current, _ := s.db.Point(p.COA, p.IOA); current.Typed == value {
+			continue
+		}
+		asdu, err := s.db.Update(iec104.CotSpont, p.COA, p.IOA, value, p.quality)
+		if err != nil {
+			s.lg.Warnf("update IOA %d of COA %d: %v", p.IOA, p.COA, err)
+			continue
+		}
+		s.server.Send(asdu)
+	}
+}
+
+// command confirms the command, executes it unless it selects the point, and terminates it.
+func (s *Simulator) command(c *iec104.Client, apdu *iec104.APDU) error {
+	if len(apdu.Signals) != 1 {
+		return c.SendIFrame(apdu.Mirror(iec104.CotActCon, true))
+	}
+	coa, ioa := apdu.COA(), apdu.Signals[0].Address
+	s.mu.Lock()
+	p := s.commands[address{coa, ioa}]
+	s.mu.Unlock()
+	neg := iec104.NegativeConfirmError{TypeID: apdu.TypeID(), COA: coa, IOA: ioa}
+	if p == nil {
+		return &iec104.UnknownObjectAddressError{NegativeConfirmError: neg}
+	}
+	if !containsTypeID(commandTypes[p.typeID.Family()], apdu.TypeID()) {
+		return &iec104.UnknownTypeError{NegativeConfirmError: neg}
+	}
+
+	switch {
+	case apdu.COT() == iec104.CotDeact:
+		return c.SendIFrame(apdu.Mirror(iec104.CotDeactCon, false))
+	case s.fault(FaultNegativeConfirmation, coa, ioa) != nil:
+		s.lg.Infof("confirm TypeID[%X] to IOA %d of COA %d negatively", apdu.TypeID(), ioa, coa)
+		return c.SendIFrame(apdu.Mirror(iec104.CotActCon, true))
+	}
+	if f := s.fault(FaultDelayConfirmation, coa, ioa); f != nil {
+		s.lg.Infof("confirm TypeID[%X] to IOA %d of COA %d in %s", apdu.TypeID(), ioa, coa, f.Delay)
+		time.AfterFunc(f.Delay, func() {
+			if err := s.execute(c, apdu.ASDU, p); err != nil {
+				s.lg.Warnf("execute TypeID[%X] to IOA %d of COA %d: %v", apdu.TypeID(), ioa, coa, err)
+			}
+		})
+		return nil
+	}
+	return s.execute(c, apdu.ASDU, p)
+}
+
+func (s *Simulator) execute(c *iec104.Client, asdu *iec104.ASDU, p *point) error {
+	if err := c.SendIFrame(asdu.Mirror(iec104.CotActCon, false)); err != nil {
+		return err
+	}
+	ie := asdu.Signals[0]
+	if selects(asdu.TypeID(), ie) {
+		return nil
+	}
+	value := commandValue(p.typeID, ie)
+	s.mu.Lock()
+	p.last, p.commanded = value.Float64(), true
+	s.mu.Unlock()
+	feedback, err := s.db.Update(iec104.CotRetRem, p.COA, p.IOA, value, p.quality)
+	if err != nil {
+		return err
+	}
+	s.server.Send(feedback)
+	return c.SendIFrame(asdu.Mirror(iec104.CotActTerm, false))
+}
+
+// selects reports whether the command selects the point, by its S/E bit.
+func selects(typeID iec104.TypeID, ie *iec104.InformationElement) bool {
+	if cmd, ok := ie.Typed.(iec104.Command); ok {
+		return cmd.Select
+	}
+	qos := len(ie.Raw) - 1 // the QOS follows the value of a set-point command
+	if typeID >= iec104.CSeTa1 {
+		qos -= 7 // and precedes its time tag
+	}
+	return qos >= 0 && ie.Raw[qos]&0x80 != 0
+}
+
+// commandValue returns the value of the point of the type which the command sets.
+func commandValue(typeID iec104.TypeID, ie *iec104.InformationElement) iec104.TypedValue {
+	cmd, ok := ie.Typed.(iec104.Command)
+	switch {
+	case !ok:
+		return ie.Typed // the value of a set-point command
+	case typeID.Family() == iec104.MDpNa1 && cmd.On:
+		return iec104.DoublePointOn
+	case typeID.Family() == iec104.MDpNa1:
+		return iec104.DoublePointOff
+	}
+	return iec104.SinglePoint(cmd.On)
+}
+
+func containsTypeID(ids []iec104.TypeID, id iec104.TypeID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// syncClock confirms the clock synchronization, the clock of the simulator isn't set.
+func (s *Simulator) syncClock(c *iec104.Client, apdu *iec104.APDU) error {
+	if t, err := s.server.ClockSyncTime(apdu); err == nil {
+		s.lg.Infof("synchronize clock of COA %d to %s", apdu.COA(), t.Format(time.RFC3339Nano))
+	}
+	return c.SendIFrame(apdu.Mirror(iec104.CotActCon, false))
+}
+
+// reset resets the points of the station to their initial values by the general reset of the process.
+func (s *Simulator) reset(coa iec104.COA, qrp iec104.ResetQualifier) error {
+	if qrp != iec104.ResetGeneral {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.points {
+		if coa != iec104.GlobalCOA && p.COA != coa {
+			continue
+		}
+		p.last, p.commanded = p.Value, false
+		if _, err := s.db.Update(iec104.CotInit, p.COA, p.IOA, iec104.NewTypedValue(p.typeID, p.Value),
+			p.quality); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseConfig(t *testing.T) {
+	yamlConfig := `
+interval: 100ms
+points:
+  - {coa: 1, ioa: 100, type: M_ME_NC_1, value: 50, profile: {kind: sine, amplitude: 10, period: 1m}}
+  - {coa: 1, ioa: 1, type: M_SP_TB_1, command: 6001, quality: "nt|sb"}
+faults:
+  - {kind: delay-confirmation, at: 30s, delay: 2s, ioa: 6001}
+`
+	jsonConfig := `{"points": [{"coa": 2, "ioa": 3, "type": "3", "value": 2, "groups": [1, 2]}],
+		"faults": [{"kind": "disconnect", "at": "1m30s"}]}`
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"yaml", yamlConfig, false},
+		{"json", jsonConfig, false},
+		{"unknown field", `{"points": [{"coa": 1, "ioa": 1, "type": "M_SP_NA_1", "color": "red"}]}`, true},
+		{"unknown type", `{"points": [{"coa": 1, "ioa": 1, "type": "M_XX_NA_1"}]}`, true},
+		{"control direction", `{"points": [{"coa": 1, "ioa": 1, "type": "C_SC_NA_1"}]}`, true},
+		{"global address", `{"points": [{"coa": 65535, "ioa": 1, "type": "M_SP_NA_1"}]}`, true},
+		{"duplicate", `{"points": [{"coa": 1, "ioa": 1, "type": "M_SP_NA_1"}, {"coa": 1, "ioa": 1, "type": "3"}]}`, true},
+		{"counter commanded", `{"points": [{"coa": 1, "ioa": 1, "type": "M_IT_NA_1", "command": 2}]}`, true},
+		{"unknown quality", `{"points": [{"coa": 1, "ioa": 1, "type": "M_SP_NA_1", "quality": "XX"}]}`, true},
+		{"unknown profile", `{"points": [{"coa": 1, "ioa": 1, "type": "13", "profile": {"kind": "saw"}}]}`, true},
+		{"sine without period", `{"points": [{"coa": 1, "ioa": 1, "type": "13", "profile": {"kind": "sine"}}]}`, true},
+		{"unknown fault", `{"faults": [{"kind": "fire"}]}`, true},
+		{"delay without delay", `{"faults": [{"kind": "delay-confirmation"}]}`, true},
+		{"dropped test frames of a station", `{"faults": [{"kind": "drop-test-frames", "coa": 1}]}`, true},
+		{"missing snapshot", `{"snapshot": "points.csv"}`, true},
+		{"duplicate of snapshot", `{"snapshot": "../../testdata/points.json",
+			"points": [{"coa": 1, "ioa": 1, "type": "M_SP_NA_1"}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	config, _ := ParseConfig([]byte(yamlConfig))
+	if config.Interval != 100*time.Millisecond || config.Listen != ":2404" || len(config.Points) != 2 ||
+		config.Points[1].typeID != iec104.MSpTb1 || config.Points[1].quality != iec104.NT|iec104.SB ||
+		config.Faults[0].At != 30*time.Second || config.Faults[0].Delay != 2*time.Second {
+		t.Errorf("ParseConfig() = %+v", config)
+	}
+	config, _ = ParseConfig([]byte(jsonConfig))
+	if config.Points[0].typeID != iec104.MDpNa1 || config.Faults[0].At != 90*time.Second {
+		t.Errorf("ParseConfig() = %+v", config)
+	}
+	config, err := ParseConfig([]byte(`{"snapshot": "../../testdata/points.csv",
+		"points": [{"coa": 3, "ioa": 1, "type": "M_SP_NA_1", "value": 1}]}`))
+	if err != nil || len(config.Points) != 8 || config.Points[0].typeID != iec104.MDpTb1 ||
+		config.Points[3].quality != iec104.IV|iec104.OV || len(config.Points[2].Groups) != 2 ||
+		config.Points[7].COA != 3 {
+		t.Errorf("ParseConfig() with snapshot = %+v, %v", config, err)
+	}
+}
+
+func TestProfileConfig_next(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name    string
+		profile *ProfileConfig
+		typeID  iec104.TypeID
+		initial float64
+		last    float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"constant", nil, iec104.MMeNc1, 1, 1, time.Minute, 1},
+		{"ramp", &ProfileConfig{Kind: ProfileRamp, Rate: 0.5}, iec104.MMeNc1, 10, 0, 4 * time.Second, 12},
+		{"wrapped ramp", &ProfileConfig{Kind: ProfileRamp, Rate: 1, Min: 0, Max: 10}, iec104.MMeNc1, 5, 0,
+			7 * time.Second, 2},
+		{"sine", &ProfileConfig{Kind: ProfileSine, Amplitude: 2, Period: 4 * time.Second}, iec104.MMeNc1, 10, 0,
+			time.Second, 12},
+		{"limited random walk", &ProfileConfig{Kind: ProfileRandomWalk, Step: 100, Min: 0, Max: 1}, iec104.MMeNc1,
+			0, 0.5, time.Second, math.NaN()},
+		{"toggled single point", &ProfileConfig{Kind: ProfileToggle, Period: time.Second}, iec104.MSpTb1, 0, 0,
+			1500 * time.Millisecond, 1},
+		{"single point toggled back", &ProfileConfig{Kind: ProfileToggle, Period: time.Second}, iec104.MSpNa1, 0, 1,
+			2 * time.Second, 0},
+		{"toggled double point", &ProfileConfig{Kind: ProfileToggle, Period: time.Second}, iec104.MDpNa1, 1, 1,
+			time.Second, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.profile.next(tt.typeID, tt.initial, tt.last, tt.elapsed, rnd)
+			if math.IsNaN(tt.want) {
+				if got < tt.profile.Min || got > tt.profile.Max {
+					t.Errorf("next() = %v, want within [%v, %v]", got, tt.profile.Min, tt.profile.Max)
+				}
+				return
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testSimulator serves the simulator of the configuration, and returns a client connected to it which has started the
+// data transfer.
+func testSimulator(t *testing.T, data string) (*Simulator, *iec104.Client, <-chan iec104.Event) {
+	t.Helper()
+	config, err := ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulator(config, logrus.StandardLogger())
+	go func() {
+		_ = sim.Serve(listener)
+	}()
+	t.Cleanup(func() { _ = sim.Shutdown(context.Background()) })
+
+	option, _ := iec104.NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := iec104.NewClient(option)
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if err := c.StartDT(); err != nil {
+		t.Fatal(err)
+	}
+	return sim, c, events
+}
+
+// testPoint waits until the point of the process image of the client satisfies ok.
+func testPoint(t *testing.T, c *iec104.Client, coa iec104.COA, ioa iec104.IOA, typeID iec104.TypeID,
+	ok func(p iec104.Point) bool) iec104.Point {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		p, found := c.ProcessImage().Point(coa, ioa, typeID)
+		if found && ok(p) {
+			return p
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("point IOA %d of COA %d = %+v, %v", ioa, coa, p, found)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	sim, c, _ := testSimulator(t, `
+interval: 20ms
+points:
+  - {coa: 1, ioa: 1, type: M_SP_NA_1, command: 6001}
+  - {coa: 1, ioa: 2, type: M_DP_TB_1, value: 1, command: 6002}
+  - {coa: 1, ioa: 100, type: M_ME_NC_1, value: 10, profile: {kind: ramp, rate: 100}}
+  - {coa: 1, ioa: 101, type: M_ME_NB_1, value: -5, quality: IV}
+faults:
+  - {kind: negative-confirmation, ioa: 6002}
+`)
+	if err := c.SendGeneralInterrogation(1); err != nil {
+		t.Fatal(err)
+	}
+	testPoint(t, c, 1, 101, iec104.MMeNb1, func(p iec104.Point) bool {
+		return p.COT == iec104.CotInrogen && p.Value == -5 && p.Quality == iec104.IV
+	})
+	testPoint(t, c, 1, 100, iec104.MMeNc1, func(p iec104.Point) bool {
+		return p.COT == iec104.CotSpont && p.Value > 10
+	})
+
+	if err := c.SendSingleCommand(1, 6001, true); err != nil {
+		t.Fatal(err)
+	}
+	testPoint(t, c, 1, 1, iec104.MSpNa1, func(p iec104.Point) bool {
+		return p.COT == iec104.CotRetRem && p.Value == 1
+	})
+	if p, _ := sim.PointDatabase().Point(1, 1); p.Typed != iec104.SinglePoint(true) {
+		t.Errorf("the point commanded = %+v", p)
+	}
+	if err := c.SendDoubleCommand(1, 6002, true); !errors.Is(err, &iec104.NegativeConfirmError{}) {
+		t.Errorf("SendDoubleCommand() error = %v, want the negative confirmation", err)
+	}
+	if err := c.SendSingleCommand(1, 6003, true); !errors.Is(err, &iec104.UnknownObjectAddressError{}) {
+		t.Errorf("SendSingleCommand() error = %v, want the unknown object", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if p, err := c.Read(ctx, 1, 2); err != nil || p.TypeID != iec104.MDpTb1 || p.Typed != iec104.DoublePointOff {
+		t.Errorf("Read() = %+v, %v", p, err)
+	}
+	if _, err := c.Read(ctx, 2, 1); !errors.Is(err, &iec104.UnknownCommonAddressError{}) {
+		t.Errorf("Read() error = %v, want the unknown station", err)
+	}
+}
+
+func TestSimulator_faults(t *testing.T) {
+	_, c, events := testSimulator(t, `
+points:
+  - {coa: 1, ioa: 1, type: M_SP_NA_1, command: 6001}
+faults:
+  - {kind: delay-confirmation, delay: 300ms}
+  - {kind: sequence-error, at: 1s}
+`)
+	start := time.Now()
+	if err := c.SendSingleCommand(1, 6001, true); err != nil || time.Since(start) < 600*time.Millisecond {
+		t.Errorf("SendSingleCommand() error = %v in %s, want the confirmations delayed", err, time.Since(start))
+	}
+
+	time.Sleep(time.Until(start.Add(time.Second)))
+	if err := c.SendGeneralInterrogation(1); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev, ok := ev.(iec104.ConnectionEvent); ok && ev.State == iec104.ConnectionLost {
+				if !errors.Is(ev.Err, &iec104.SequenceError{Number: "N(S)"}) {
+					t.Errorf("connection lost by %v, want the sequence error", ev.Err)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("the sequence error must close the connection")
+		}
+	}
+}
+
+func Test_selects(t *testing.T) {
+	tests := []struct {
+		name   string
+		typeID iec104.TypeID
+		ie     *iec104.InformationElement
+		want   bool
+		value  iec104.TypedValue
+		point  iec104.TypeID
+	}{
+		{"select single command", iec104.CScNa1, &iec104.InformationElement{Typed: iec104.Command{On: true, Select: true}},
+			true, iec104.SinglePoint(true), iec104.MSpNa1},
+		{"execute double command", iec104.CDcNa1, &iec104.InformationElement{Typed: iec104.Command{}}, false,
+			iec104.DoublePointOff, iec104.MDpTb1},
+		{"select set-point", iec104.CSeNc1, &iec104.InformationElement{Typed: iec104.Float(1.5),
+			Raw: []byte{0, 0, 0xc0, 0x3f, 0x80}}, true, iec104.Float(1.5), iec104.MMeNc1},
+		{"execute set-point with time tag", iec104.CSeTb1, &iec104.InformationElement{Typed: iec104.Scaled(7),
+			Raw: []byte{7, 0, 0x00, 1, 2, 3, 4, 5, 6, 0x80}}, false, iec104.Scaled(7), iec104.MMeNb1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selects(tt.typeID, tt.ie); got != tt.want {
+				t.Errorf("selects() = %v, want %v", got, tt.want)
+			}
+			if got := commandValue(tt.point, tt.ie); got != tt.value {
+				t.Errorf("commandValue() = %#v, want %#v", got, tt.value)
+			}
+		})
+	}
+}
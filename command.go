@@ -0,0 +1,76 @@
+package iec104
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+/*
+SendCommand sends the command of the type to the information object of the station and waits for its confirmation.
+The value is converted to the type:
+  - a single (CScNa1, CScTa1) or double command (CDcNa1, CDcTa1) is ON if the value is DoublePointOn, or non-zero for
+    the other values;
+  - a regulating step command (CRcNa1) steps higher if the value is positive, and lower otherwise;
+  - a set-point command (CSeNa1, CSeNb1, CSeNc1 and their types with time tag) is converted as NewInformationElement
+    converts the values, for example, a Float to a Normalized.
+
+The command selects the object if sel is true, otherwise it executes the command, so a select and execute command is
+sent by two calls. The commands with time tag are tagged with the current time. It fails as Read does if the command
+is confirmed negatively or rejected by the station, or isn't confirmed in t1.
+*/
+func (c *Client) SendCommand(ctx context.Context, coa COA, ioa IOA, typeID TypeID, value TypedValue, sel bool) error {
+	ie, err := newCommandElement(typeID, value, sel)
+	if err != nil {
+		return err
+	}
+	_, err = c.exchange(ctx, NewASDU(typeID, CotAct, coa, NewInformationObject(ioa, ie)))
+	return err
+}
+
+// newCommandElement encodes the value as the information element of the command.
+func newCommandElement(typeID TypeID, value TypedValue, sel bool) (*InformationElement, error) {
+	var se byte // S/E: select (1) or execute (0)
+	if sel {
+		se = 0x80
+	}
+	var ie *InformationElement
+	switch typeID {
+	case CScNa1, CScTa1:
+		ie = &InformationElement{Format: InformationElementFormat{SCO}, Raw: []byte{byte(toSinglePoint(value).Float64())}}
+	case CDcNa1, CDcTa1:
+		dco := byte(DoublePointOff)
+		if toSinglePoint(value) {
+			dco = byte(DoublePointOn)
+		}
+		ie = &InformationElement{Format: InformationElementFormat{DCO}, Raw: []byte{dco}}
+	case CRcNa1:
+		rco := byte(1) // next step lower
+		if value.Float64() > 0 {
+			rco = 2 // next step higher
+		}
+		ie = &InformationElement{Format: InformationElementFormat{RCO}, Raw: []byte{rco}}
+	case CSeNa1, CSeTa1:
+		ie = &InformationElement{Format: InformationElementFormat{NVA, QOS},
+			Raw: append(serializeLittleEndianUint16(uint16(toNormalized(value))), se)}
+	case CSeNb1, CSeTb1:
+		ie = &InformationElement{Format: InformationElementFormat{SVA, QOS},
+			Raw: append(serializeLittleEndianUint16(uint16(toScaled(value))), se)}
+	case CSeNc1, CSeTc1:
+		bits := math.Float32bits(float32(value.Float64()))
+		ie = &InformationElement{Format: InformationElementFormat{IEEE754STD, QOS},
+			Raw: append(serializeLittleEndianUint32(bits), se)}
+	default:
+		return nil, fmt.Errorf("TypeID[%X] is not a type of command", typeID)
+	}
+	if len(ie.Format) == 1 {
+		ie.Raw[0] |= se
+	}
+	switch typeID {
+	case CScTa1, CDcTa1, CSeTa1, CSeTb1, CSeTc1:
+		ie.Format = append(ie.Format, CP56Time2a)
+		ie.Raw = append(ie.Raw, serializeCP56Time2a(time.Now())...)
+	}
+	return ie, nil
+}
@@ -0,0 +1,93 @@
+package iec104
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_newCommandElement(t *testing.T) {
+	tests := []struct {
+		typeID TypeID
+		value  TypedValue
+		sel    bool
+		want   []byte
+	}{
+		{CScNa1, SinglePoint(true), true, []byte{0x81}},
+		{CScNa1, DoublePointOff, false, []byte{0x00}},
+		{CDcNa1, DoublePointOn, true, []byte{0x82}},
+		{CDcNa1, Float(0), false, []byte{0x01}},
+		{CRcNa1, Scaled(1), false, []byte{0x02}},
+		{CRcNa1, Scaled(-1), true, []byte{0x81}},
+		{CSeNa1, Float(0.5), false, []byte{0x00, 0x40, 0x00}},
+		{CSeNb1, Float(-2), true, []byte{0xfe, 0xff, 0x80}},
+		{CSeNc1, Float(1), false, []byte{0x00, 0x00, 0x80, 0x3f, 0x00}},
+	}
+	for _, tt := range tests {
+		ie, err := newCommandElement(tt.typeID, tt.value, tt.sel)
+		if err != nil || !bytes.Equal(ie.Raw, tt.want) {
+			t.Errorf("newCommandElement(%X, %v, %v) = %X, %v, want %X", tt.typeID, tt.value, tt.sel, ie.Raw, err,
+				tt.want)
+		}
+	}
+
+	ie, err := newCommandElement(CSeTb1, Scaled(3), false)
+	if err != nil || len(ie.Raw) != 3+7 || len(ie.Format) != 3 || ie.Format[2] != CP56Time2a {
+		t.Errorf("newCommandElement(CSeTb1) = %+v, %v, want a value, QOS and CP56Time2a", ie, err)
+	}
+	if _, err := newCommandElement(MMeNc1, Float(1), false); err == nil {
+		t.Errorf("newCommandElement() of a type in monitor direction must fail")
+	}
+}
+
+func TestClient_SendCommand(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	received := make(chan *APDU, 4)
+	confirm := HandlerFunc(func(c *Client, apdu *APDU) error {
+		if apdu.Signals[0].Address == 2 {
+			return &UnknownObjectAddressError{NegativeConfirmError: NegativeConfirmError{TypeID: apdu.TypeID(),
+				COA: apdu.COA(), IOA: 2}}
+		}
+		received <- apdu
+		return c.SendIFrame(apdu.Mirror(CotActCon, false))
+	})
+	mux := NewServeMux().Handle(CDcNa1, confirm).Handle(CSeTc1, confirm)
+	go func() { _ = s.Serve(listener, mux) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testEvent(t, events) // connected
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, sel := range []bool{true, false} {
+		if err := c.SendCommand(ctx, 1, 1, CDcNa1, DoublePointOn, sel); err != nil {
+			t.Fatalf("SendCommand(select %v) error = %v", sel, err)
+		}
+		if cmd := (<-received).Signals[0].Typed.(Command); !cmd.On || cmd.Select != sel {
+			t.Errorf("received %+v, want ON with select %v", cmd, sel)
+		}
+	}
+	if err := c.SendCommand(ctx, 1, 3, CSeTc1, Float(12.5), false); err != nil {
+		t.Fatalf("SendCommand(CSeTc1) error = %v", err)
+	}
+	if ie := (<-received).Signals[0]; ie.Value != 12.5 || ie.Ts.IsZero() {
+		t.Errorf("received set-point %v at %v, want 12.5 with time tag", ie.Value, ie.Ts)
+	}
+	if err := c.SendCommand(ctx, 1, 2, CDcNa1, DoublePointOff, false); !errors.Is(err, &UnknownObjectAddressError{}) {
+		t.Errorf("SendCommand() to an unknown object error = %v", err)
+	}
+}
@@ -44,7 +44,3 @@ func serializeLittleEndianUint32(i uint32) []byte {
 	binary.LittleEndian.PutUint32(bytes, i)
 	return bytes
 }
-
-type cmdRsp struct {
-	err error
-}
@@ -0,0 +1,324 @@
+/*
+Package converter exposes IEC 101 outstations polled over an FT1.2 link as an IEC 104 controlled station.
+
+A Converter serves the controlling stations with an iec104.Server, and polls the outstations with an iec101.Master:
+  - each outstation is identified by its common address, which is kept upstream, as the information object addresses
+    are: the fields are widened from the profile of the link to the lengths of IEC 104;
+  - after the link of an outstation is reset, the converter interrogates it, and the user data of class 1 and 2 are
+    polled cyclically;
+  - the information with time tag CP24Time2a, which isn't defined by IEC 104, is converted to the types with time tag
+    CP56Time2a, completing the time with the current hour;
+  - the commands and the system commands are sent to the outstations as they are, and they are confirmed negatively
+    upstream if the outstation doesn't confirm them at the link layer, the confirmations and terminations of the
+    outstation are sent back to the controlling station which issued the command;
+  - the commands with time tag CP56Time2a are sent to the outstations as the commands without time tag, and their
+    confirmations and terminations are sent back as those of the commands with time tag.
+*/
+package converter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/github-of-lyj/iec104/iec101"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPollInterval is the interval between the cycles polling the user data of class 2 of the outstations.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// cp56Types maps the types with time tag CP24Time2a to the types with time tag CP56Time2a.
+var cp56Types = map[iec104.TypeID]iec104.TypeID{
+	iec104.MSpTa1: iec104.MSpTb1,
+	iec104.MDpTa1: iec104.MDpTb1,
+	iec104.MMeTa1: iec104.MMeTd1,
+	iec104.MMeTb1: iec104.MMeTe1,
+	iec104.MMeTc1: iec104.MMeTf1,
+	iec104.MItTa1: iec104.MItTb1,
+}
+
+// untaggedCommands maps the commands with time tag CP56Time2a to the commands without time tag.
+var untaggedCommands = map[iec104.TypeID]iec104.TypeID{
+	iec104.CScTa1: iec104.CScNa1,
+	iec104.CDcTa1: iec104.CDcNa1,
+	iec104.CSeTa1: iec104.CSeNa1,
+	iec104.CSeTb1: iec104.CSeNb1,
+	iec104.CSeTc1: iec104.CSeNc1,
+}
+
+// cp56TimeLen is the length of the time tag CP56Time2a.
+const cp56TimeLen = 7
+
+type Converter struct {
+	server *iec104.Server
+	master *iec101.Master
+	lg     *logrus.Logger
+
+	mu          sync.Mutex
+	outstations map[iec104.COA]*outstation
+	order       []*outstation // in the order they are added, which is the order they are polled
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wake        chan struct{}             // polls the outstations before the interval elapses
+	tagged      map[untagged]*iec104.ASDU // commands with time tag sent without it, until they are finished
+
+	pollInterval time.Duration
+}
+
+// untagged identifies a command with time tag sent to an outstation without it.
+type untagged struct {
+	typeID iec104.TypeID // type without time tag
+	coa    iec104.COA
+	ioa    iec104.IOA
+}
+
+// outstation is an IEC 101 outstation on the link.
+type outstation struct {
+	address uint16 // link address
+	coa     iec104.COA
+	ready   bool // the link is reset, only accessed by polling
+}
+
+func New(server *iec104.Server, master *iec101.Master, lg *logrus.Logger) *Converter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Converter{
+		server:       server,
+		master:       master,
+		lg:           lg,
+		outstations:  make(map[iec104.COA]*outstation),
+		ctx:          ctx,
+		cancel:       cancel,
+		wake:         make(chan struct{}, 1),
+		tagged:       make(map[untagged]*iec104.ASDU),
+		pollInterval: DefaultPollInterval,
+	}
+}
+
+func (c *Converter) SetPollInterval(interval time.Duration) *Converter {
+	if interval > 0 {
+		c.pollInterval = interval
+	}
+	return c
+}
+
+// AddOutstation adds the outstation of the link address, whose stations is exposed by the common address.
+func (c *Converter) AddOutstation(address uint16, coa iec104.COA) *Converter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := &outstation{address: address, coa: coa}
+	c.outstations[coa] = o
+	c.order = append(c.order, o)
+	return c
+}
+
+// Serve polls the outstations, and serves the controlling stations on the listener until Shutdown is called.
+func (c *Converter) Serve(listener net.Listener) error {
+	go c.polling()
+	return c.server.Serve(listener, c)
+}
+
+// Shutdown stops polling and shuts down the server. The link of the master is left open.
+func (c *Converter) Shutdown(ctx context.Context) error {
+	c.cancel()
+	return c.server.Shutdown(ctx)
+}
+
+func (c *Converter) polling() {
+	for {
+		c.mu.Lock()
+		order := append([]*outstation(nil), c.order...)
+		c.mu.Unlock()
+		for _, o := range order {
+			c.poll(o)
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.wake:
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// poll resets the link of the outstation and interrogates it if it isn't ready, and polls its user data of class 1
+// and then of class 2, polling class 1 again as long as the outstation has any.
+func (c *Converter) poll(o *outstation) {
+	if !o.ready {
+		if err := c.master.ResetLink(c.ctx, o.address); err != nil {
+			c.lg.Warnf("reset link address %d: %v", o.address, err)
+			return
+		}
+		o.ready = true
+		gi := iec104.NewASDU(iec104.CIcNa1, iec104.CotAct, o.coa, iec104.NewInformationObject(0x000000,
+			&iec104.InformationElement{Format: []iec104.InformationElementType{iec104.QOI}, Raw: []byte{0x14}}))
+		if err := c.master.Send(c.ctx, o.address, gi); err != nil {
+			c.lg.Warnf("interrogate link address %d: %v", o.address, err)
+		}
+	}
+
+	class := iec101.Class1
+	for {
+		asdu, acd, err := c.master.Poll(c.ctx, o.address, class)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.lg.Warnf("poll link address %d: %v", o.address, err)
+				o.ready = false
+			}
+			return
+		}
+		if asdu != nil {
+			c.upstream(asdu)
+		}
+		switch {
+		case acd:
+			class = iec101.Class1
+		case class == iec101.Class1:
+			class = iec101.Class2
+		default:
+			return
+		}
+	}
+}
+
+// upstream sends the ASDU received from an outstation to the controlling stations.
+func (c *Converter) upstream(asdu *iec104.ASDU) {
+	if answer, ok := c.tag(asdu); ok {
+		c.server.Send(answer)
+		return
+	}
+	typeID, ok := cp56Types[asdu.TypeID()]
+	if !ok {
+		c.server.Send(asdu)
+		return
+	}
+
+	now := time.Now()
+	var ios []*iec104.InformationObject
+	for _, ie := range asdu.Signals {
+		converted, err := iec104.NewInformationElement(typeID, ie.Typed, ie.Quality, completeCP24(ie.Ts, now))
+		if err != nil {
+			c.lg.Warnf("convert IOA[%d] of COA[%d]: %v", ie.Address, asdu.COA(), err)
+			continue
+		}
+		ios = append(ios, iec104.NewInformationObject(ie.Address, converted))
+	}
+	for len(ios) > 0 {
+		n := (iec104.MaxAsduLen - iec104.AsduHeaderLen) / len(ios[0].Data())
+		if n > len(ios) {
+			n = len(ios)
+		}
+		c.server.Send(iec104.NewASDU(typeID, asdu.COT(), asdu.COA(), ios[:n]...))
+		ios = ios[n:]
+	}
+}
+
+// completeCP24 completes the minutes, seconds and milliseconds of CP24Time2a with the latest hour until now. The
+// time a little later than now is kept in the current hour, since the clocks of the stations aren't exactly the same.
+func completeCP24(ts, now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(),
+		now.Location())
+	if t.After(now.Add(time.Minute)) {
+		t = t.Add(-time.Hour)
+	}
+	return t
+}
+
+// ServeAPDU handles the ASDUs from the controlling stations.
+func (c *Converter) ServeAPDU(client *iec104.Client, apdu *iec104.APDU) error {
+	switch apdu.TypeID() {
+	case iec104.CIcNa1, iec104.CCiNa1, iec104.CRdNa1, iec104.CCsNa1, iec104.CRpNc1,
+		iec104.CScNa1, iec104.CDcNa1, iec104.CRcNa1, iec104.CSeNa1, iec104.CSeNb1, iec104.CSeNc1,
+		iec104.CScTa1, iec104.CDcTa1, iec104.CSeTa1, iec104.CSeTb1, iec104.CSeTc1:
+		return c.forward(client, apdu.ASDU)
+	}
+	if apdu.COT() == iec104.CotAct || apdu.COT() == iec104.CotDeact {
+		return client.SendIFrame(apdu.Mirror(iec104.CotUnknownType, true))
+	}
+	return nil
+}
+
+// forward sends the command to the outstation of its common address, or to all of them if it's GlobalCOA, and
+// confirms it negatively if an outstation doesn't acknowledge it. The command with time tag is sent without it.
+func (c *Converter) forward(client *iec104.Client, asdu *iec104.ASDU) error {
+	c.mu.Lock()
+	var targets []*outstation
+	if asdu.COA() == iec104.GlobalCOA {
+		targets = append(targets, c.order...)
+	} else if o, ok := c.outstations[asdu.COA()]; ok {
+		targets = append(targets, o)
+	}
+	c.mu.Unlock()
+	if len(targets) == 0 {
+		return client.SendIFrame(asdu.Mirror(iec104.CotUnknownAsduAddress, true))
+	}
+	if len(asdu.Signals) != 1 {
+		return client.SendIFrame(asdu.Mirror(iec104.CotActCon, true))
+	}
+
+	ie := asdu.Signals[0]
+	typeID, raw := asdu.TypeID(), ie.Raw
+	if t, ok := untaggedCommands[typeID]; ok {
+		if len(raw) <= cp56TimeLen {
+			return client.SendIFrame(asdu.Mirror(iec104.CotActCon, true))
+		}
+		typeID, raw = t, raw[:len(raw)-cp56TimeLen]
+	}
+	for _, o := range targets {
+		key := untagged{typeID: typeID, coa: o.coa, ioa: ie.Address}
+		if typeID != asdu.TypeID() {
+			c.mu.Lock()
+			c.tagged[key] = asdu
+			c.mu.Unlock()
+		}
+		down := iec104.NewASDU(typeID, asdu.COT(), o.coa,
+			iec104.NewInformationObject(ie.Address, &iec104.InformationElement{Raw: raw}))
+		err := c.master.Send(c.ctx, o.address, down)
+		if err != nil && typeID != asdu.TypeID() {
+			c.mu.Lock()
+			delete(c.tagged, key)
+			c.mu.Unlock()
+		}
+		switch {
+		case errors.Is(err, iec101.ErrObjectAddress):
+			return client.SendIFrame(asdu.Mirror(iec104.CotUnknownObjectAddress, true))
+		case errors.Is(err, iec101.ErrCommonAddress):
+			return client.SendIFrame(asdu.Mirror(iec104.CotUnknownAsduAddress, true))
+		case err != nil:
+			c.lg.Warnf("send TypeID[%X] to link address %d: %v", asdu.TypeID(), o.address, err)
+			return client.SendIFrame(asdu.Mirror(iec104.CotActCon, true))
+		}
+	}
+	select { // the confirmation is polled as user data of class 1
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// tag returns the answer of an outstation to a command with time tag sent without it as the answer to the command
+// with time tag, and reports whether the ASDU is such an answer. The command is forgotten once it's finished.
+func (c *Converter) tag(asdu *iec104.ASDU) (*iec104.ASDU, bool) {
+	if len(asdu.Signals) != 1 {
+		return nil, false
+	}
+	key := untagged{typeID: asdu.TypeID(), coa: asdu.COA(), ioa: asdu.Signals[0].Address}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmd, ok := c.tagged[key]
+	if !ok {
+		return nil, false
+	}
+	if asdu.COT() != iec104.CotActCon || asdu.Negative() || cmd.Signals[0].Raw[0]&0x80 != 0 { // finished or selected
+		delete(c.tagged, key)
+	}
+	if cmd.COA() == asdu.COA() {
+		return cmd.Mirror(asdu.COT(), asdu.Negative()), true
+	}
+	// the answer of an outstation to the broadcast command
+	return iec104.NewASDU(cmd.TypeID(), cmd.COT(), asdu.COA(), iec104.NewInformationObject(key.ioa,
+		&iec104.InformationElement{Raw: cmd.Signals[0].Raw})).Mirror(asdu.COT(), asdu.Negative()), true
+}
@@ -0,0 +1,187 @@
+package converter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/github-of-lyj/iec104/iec101"
+	"github.com/sirupsen/logrus"
+)
+
+func testElement(t *testing.T, typeID iec104.TypeID, value iec104.TypedValue) *iec104.InformationElement {
+	t.Helper()
+	ie, err := iec104.NewInformationElement(typeID, value, 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ie
+}
+
+func testEvent(t *testing.T, events <-chan iec104.Event) iec104.Event {
+	t.Helper()
+	for {
+		select {
+		case ev := <-events:
+			if _, ok := ev.(iec104.CommandResultEvent); ok {
+				continue // checked by the result of the command
+			}
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event")
+			return nil
+		}
+	}
+}
+
+// testOutstation serves the outstation of link address 3 and COA 5, which answers the interrogation with the
+// normalized value 0.5 at IOA 100, and confirms the single commands.
+func testOutstation(t *testing.T, rw net.Conn) *iec101.Slave {
+	s := iec101.NewSlave(rw, iec101.Config{}, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = s.Serve(ctx, func(asdu *iec104.ASDU) error {
+			switch asdu.TypeID() {
+			case iec104.CIcNa1:
+				_ = s.Enqueue(iec101.Class1, asdu.Mirror(iec104.CotActCon, false))
+				_ = s.Enqueue(iec101.Class2, iec104.NewASDU(iec104.MMeNa1, iec104.CotInrogen, 5,
+					iec104.NewInformationObject(100, testElement(t, iec104.MMeNa1, iec104.Normalized(16384)))))
+				return s.Enqueue(iec101.Class2, asdu.Mirror(iec104.CotActTerm, false))
+			case iec104.CScNa1:
+				_ = s.Enqueue(iec101.Class1, asdu.Mirror(iec104.CotActCon, false))
+				if asdu.Signals[0].Raw[0]&0x80 == 0 { // execute
+					return s.Enqueue(iec101.Class1, asdu.Mirror(iec104.CotActTerm, false))
+				}
+			}
+			return nil
+		})
+	}()
+	return s
+}
+
+func TestConverter(t *testing.T) {
+	a, b := net.Pipe()
+	master := iec101.NewMaster(a, iec101.Config{Timeout: 100 * time.Millisecond})
+	defer master.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(iec104.NewServer(listener.Addr().String(), nil, logrus.StandardLogger()), master,
+		logrus.StandardLogger()).SetPollInterval(20*time.Millisecond).AddOutstation(3, 5)
+	go func() {
+		_ = c.Serve(listener)
+	}()
+	t.Cleanup(func() { _ = c.Shutdown(context.Background()) })
+
+	option, _ := iec104.NewClientOption(listener.Addr().String(), nil, time.Second)
+	client := iec104.NewClient(option)
+	events := client.Events()
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	testEvent(t, events) // connected
+
+	// the outstation is available after the client is connected, which receives the interrogation at start
+	outstation := testOutstation(t, b)
+	defer outstation.Close()
+
+	interrogated := func(t *testing.T) {
+		t.Helper()
+		if ev, ok := testEvent(t, events).(iec104.InterrogationBeginEvent); !ok || ev.Negative {
+			t.Fatalf("expect positive confirmation, got %+v", ev)
+		}
+		ev, ok := testEvent(t, events).(iec104.MeasuredEvent)
+		if !ok || ev.TypeID != iec104.MMeNa1 || ev.COA != 5 || ev.IOA != 100 || ev.Value != 0.5 {
+			t.Fatalf("expect the interrogated value, got %+v", ev)
+		}
+		if ev, ok := testEvent(t, events).(iec104.InterrogationEndEvent); !ok {
+			t.Fatalf("expect termination, got %+v", ev)
+		}
+	}
+	t.Run("interrogation at start", interrogated)
+	t.Run("interrogation", func(t *testing.T) {
+		if err := client.SendGeneralInterrogation(5); err != nil {
+			t.Fatal(err)
+		}
+		interrogated(t)
+	})
+
+	t.Run("CP24Time2a converted", func(t *testing.T) {
+		now := time.Now()
+		ie, err := iec104.NewInformationElement(iec104.MMeTc1, iec104.Float(1.5), 0, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := outstation.Enqueue(iec101.Class1, iec104.NewASDU(iec104.MMeTc1, iec104.CotSpont, 5,
+			iec104.NewInformationObject(300, ie))); err != nil {
+			t.Fatal(err)
+		}
+		ev, ok := testEvent(t, events).(iec104.MeasuredEvent)
+		if !ok || ev.TypeID != iec104.MMeTf1 || ev.IOA != 300 || ev.Value != 1.5 {
+			t.Fatalf("expect the value with time tag CP56Time2a, got %+v", ev)
+		}
+		if d := ev.Ts.Sub(now); d < -time.Second || d > time.Second {
+			t.Errorf("the time tag %s isn't completed to %s", ev.Ts, now)
+		}
+	})
+
+	t.Run("single command", func(t *testing.T) {
+		if err := client.SendSingleCommand(5, 200, true); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("single command with time tag", func(t *testing.T) { // answered by the outstation without time tag
+		if err := client.SendCommand(context.Background(), 5, 200, iec104.CScTa1, iec104.SinglePoint(true),
+			false); err != nil {
+			t.Fatal(err)
+		}
+		pending := func() int {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return len(c.tagged)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for pending() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := pending(); n != 0 {
+			t.Errorf("%d commands with time tag remain after their termination", n)
+		}
+	})
+
+	t.Run("unknown address", func(t *testing.T) {
+		if err := client.SendSingleCommand(6, 200, true); err == nil {
+			t.Errorf("the command to an unknown station must be rejected")
+		}
+		if err := client.SendSingleCommand(5, 0x10000, true); err == nil {
+			t.Errorf("the command to an address out of range of the profile must be rejected")
+		}
+	})
+}
+
+func Test_completeCP24(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		ts   time.Time
+		want time.Time
+	}{
+		{"current hour", time.Date(0, 1, 1, 0, 29, 15, 0, time.UTC), time.Date(2024, 3, 1, 10, 29, 15, 0, time.UTC)},
+		{"clock ahead", time.Date(0, 1, 1, 0, 30, 20, 0, time.UTC), time.Date(2024, 3, 1, 10, 30, 20, 0, time.UTC)},
+		{"previous hour", time.Date(0, 1, 1, 0, 45, 0, 0, time.UTC), time.Date(2024, 3, 1, 9, 45, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := completeCP24(tt.ts, now); !got.Equal(tt.want) {
+				t.Errorf("completeCP24() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
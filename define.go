@@ -1,5 +1,7 @@
 package iec104
 
+// ClientHandler handles the APDUs with a method for each kind of command. It is adapted to a Handler by
+// AdaptClientHandler, a ServeMux is more flexible to route the APDUs.
 type ClientHandler interface {
 	GeneralInterrogationHandler(apdu *APDU) error
 	CounterInterrogationHandler(apdu *APDU) error
@@ -0,0 +1,121 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+/*
+Acquisition of the transmission delay, which the controlled station adds to the time of the following clock
+synchronizations:
+
+	controlling station                            controlled station
+	CCdNa1 (COT 6) with SDT, the sending time  ->
+	                                           <-  CCdNa1 (COT 7) with SDT plus the time the station has taken
+	CCdNa1 (COT 3) with the delay              ->
+
+The delay is half of the round-trip time without the time taken by the controlled station. The times are CP16Time2a,
+the milliseconds of the current minute.
+*/
+
+// cp16Time2a returns the milliseconds of the minute of t, 0-59999.
+func cp16Time2a(t time.Time) uint16 {
+	return uint16(t.Second()*1000 + t.Nanosecond()/int(time.Millisecond))
+}
+
+func newDelayAcquisition(cot COT, coa COA, ms uint16) *ASDU {
+	return NewASDU(CCdNa1, cot, coa, NewInformationObject(0, &InformationElement{
+		Format: InformationElementFormat{CP16Time2a},
+		Raw:    serializeLittleEndianUint16(ms),
+	}))
+}
+
+// AcquireDelay acquires the transmission delay to the station, and sends it to the station unless the client
+// corrects the clock synchronization of the station, see ClientOption.SetDelayCorrection.
+func (c *Client) AcquireDelay(ctx context.Context, coa COA) (time.Duration, error) {
+	start := time.Now()
+	sdt := cp16Time2a(start)
+	con, err := c.exchange(ctx, newDelayAcquisition(CotAct, coa, sdt))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if len(con.Signals) == 0 {
+		return 0, errors.New("delay acquisition confirmed without information object")
+	}
+	taken := time.Duration((int(con.Signals[0].Value)-int(sdt)+60000)%60000) * time.Millisecond
+	delay := (elapsed - taken) / 2
+	if delay < 0 {
+		delay = 0
+	}
+
+	c.delaysMutex.Lock()
+	c.delays[coa] = delay
+	c.delaysMutex.Unlock()
+	if containsCOA(c.delayCorrected, coa) {
+		return delay, nil
+	}
+	return delay, c.SendIFrame(newDelayAcquisition(CotSpont, coa, uint16(delay.Milliseconds())))
+}
+
+// TransmissionDelay returns the transmission delay to the station acquired by AcquireDelay, and whether it has been
+// acquired.
+func (c *Client) TransmissionDelay(coa COA) (time.Duration, bool) {
+	c.delaysMutex.Lock()
+	defer c.delaysMutex.Unlock()
+	delay, ok := c.delays[coa]
+	return delay, ok
+}
+
+// clockCorrection returns the delay which the client adds to the time of the clock synchronization of the station.
+func (c *Client) clockCorrection(coa COA) time.Duration {
+	if !containsCOA(c.delayCorrected, coa) {
+		return 0
+	}
+	delay, _ := c.TransmissionDelay(coa)
+	return delay
+}
+
+/*
+ServeDelayAcquisition is the handler of the delay acquisition command CCdNa1 of a controlled station:
+  - the activation is confirmed with the sending time of the command, as the time taken by the station is negligible;
+  - the spontaneous delay is recorded as the transmission delay of the station, see Server.TransmissionDelay.
+*/
+func ServeDelayAcquisition(c *Client, apdu *APDU) error {
+	switch apdu.cot {
+	case CotAct:
+		return c.SendIFrame(apdu.Mirror(CotActCon, len(apdu.Signals) == 0))
+	case CotSpont:
+		if len(apdu.Signals) > 0 && c.srv != nil {
+			c.srv.setTransmissionDelay(apdu.coa, time.Duration(apdu.Signals[0].Value)*time.Millisecond)
+		}
+		return nil
+	}
+	return c.SendIFrame(apdu.Mirror(CotUnknownCause, true))
+}
+
+func (s *Server) setTransmissionDelay(coa COA, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.delays == nil {
+		s.delays = make(map[COA]time.Duration)
+	}
+	s.delays[coa] = delay
+}
+
+// TransmissionDelay returns the transmission delay to the station sent by a controlling station.
+func (s *Server) TransmissionDelay(coa COA) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delays[coa]
+}
+
+// ClockSyncTime returns the time of the clock synchronization command CCsNa1 corrected by the transmission delay to
+// the station, which the handler of the command sets the clock of the station to.
+func (s *Server) ClockSyncTime(apdu *APDU) (time.Time, error) {
+	if apdu.typeID != CCsNa1 || len(apdu.Signals) == 0 || len(apdu.Signals[0].Raw) < 7 {
+		return time.Time{}, errors.New("not a clock synchronization command")
+	}
+	return parseCP56Time2a(apdu.Signals[0].Raw).Add(s.TransmissionDelay(apdu.coa)), nil
+}
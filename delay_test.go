@@ -0,0 +1,71 @@
+package iec104
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_AcquireDelay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	synced := make(chan time.Time, 2)
+	mux := NewServeMux().
+		Handle(CCdNa1, func(c *Client, apdu *APDU) error {
+			if apdu.cot == CotAct {
+				time.Sleep(200 * time.Millisecond) // a round trip of 200 ms
+			}
+			return ServeDelayAcquisition(c, apdu)
+		}).
+		Handle(CCsNa1, func(c *Client, apdu *APDU) error {
+			ts, err := s.ClockSyncTime(apdu)
+			if err != nil {
+				return err
+			}
+			synced <- ts
+			return c.SendIFrame(apdu.Mirror(CotActCon, false))
+		})
+	go func() { _ = s.Serve(listener, mux) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option.SetDelayCorrection(2))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	near := func(d, want time.Duration) bool {
+		return d >= want-20*time.Millisecond && d <= want+50*time.Millisecond
+	}
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	for _, coa := range []COA{1, 2} {
+		delay, err := c.AcquireDelay(ctx, coa)
+		if err != nil || !near(delay, 100*time.Millisecond) {
+			t.Fatalf("AcquireDelay(%d) = %v, %v, want about 100ms", coa, delay, err)
+		}
+		if got, ok := c.TransmissionDelay(coa); !ok || got != delay {
+			t.Errorf("TransmissionDelay(%d) = %v, %v, want %v", coa, got, ok, delay)
+		}
+		if err := c.SendClockSync(coa, base); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case ts := <-synced:
+			if !near(ts.Sub(base), delay) {
+				t.Errorf("clock of COA[%d] synchronized to %s, want %s corrected by %s", coa, ts, base, delay)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no clock synchronization of COA[%d]", coa)
+		}
+	}
+	if d := s.TransmissionDelay(2); d != 0 {
+		t.Errorf("the delay of a station corrected by the client must not be sent, got %v", d)
+	}
+}
@@ -1,5 +1,25 @@
 package iec104
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+The errors of the protocol are typed, so that they are examined by errors.Is and errors.As:
+  - NegativeConfirmError, an ASDU in control direction confirmed negatively by the controlled station, which is also
+    the underlying error of the rejections with the unknown causes: UnknownTypeError (COT 44), UnknownCauseError
+    (COT 45), UnknownCommonAddressError (COT 46) and UnknownObjectAddressError (COT 47);
+  - SequenceError, TimeoutError and FramingError, the violations of the protocol which close the connection, except
+    TimeoutError of a command which isn't confirmed in time.
+
+errors.Is matches an error with a target of the same type whose fields are either zero or equal, for example,
+errors.Is(err, &NegativeConfirmError{TypeID: CScNa1}) reports whether a single command is confirmed negatively or
+rejected. A handler of Server returns a rejection error, such as UnknownObjectAddressError, to have the ASDU answered
+with its cause.
+*/
+
 type errSingleCmdTerm struct{}
 
 func (e errSingleCmdTerm) Error() string {
@@ -21,3 +41,179 @@ func IsErrDoubleCmdTerm(err error) bool {
 	_, ok := err.(errDoubleCmdTerm)
 	return ok
 }
+
+// NegativeConfirmError is the negative confirmation of an ASDU in control direction, whose cause is COT.
+type NegativeConfirmError struct {
+	TypeID TypeID
+	COT    COT
+	COA    COA
+	IOA    IOA
+}
+
+func (e *NegativeConfirmError) Error() string {
+	return fmt.Sprintf("negative confirmation of TypeID[%X] to COA[%d] IOA[%d] with COT[%d]", e.TypeID, e.COA, e.IOA,
+		e.COT)
+}
+
+func (e *NegativeConfirmError) Is(target error) bool {
+	t, ok := target.(*NegativeConfirmError)
+	return ok && e.matches(t)
+}
+
+// matches reports whether the fields of the target are either zero or equal.
+func (e *NegativeConfirmError) matches(t *NegativeConfirmError) bool {
+	return (t.TypeID == 0 || t.TypeID == e.TypeID) && (t.COT == 0 || t.COT == e.COT) &&
+		(t.COA == 0 || t.COA == e.COA) && (t.IOA == 0 || t.IOA == e.IOA)
+}
+
+// UnknownTypeError is the rejection of an ASDU whose type the station doesn't support, with COT 44.
+type UnknownTypeError struct{ NegativeConfirmError }
+
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("TypeID[%X] to COA[%d] IOA[%d] rejected: unknown type", e.TypeID, e.COA, e.IOA)
+}
+
+func (e *UnknownTypeError) Unwrap() error { return &e.NegativeConfirmError }
+
+func (e *UnknownTypeError) Is(target error) bool {
+	t, ok := target.(*UnknownTypeError)
+	return ok && e.matches(&t.NegativeConfirmError)
+}
+
+// UnknownCauseError is the rejection of an ASDU whose cause of transmission the station doesn't support, with COT 45.
+type UnknownCauseError struct{ NegativeConfirmError }
+
+func (e *UnknownCauseError) Error() string {
+	return fmt.Sprintf("TypeID[%X] to COA[%d] IOA[%d] rejected: unknown cause of transmission", e.TypeID, e.COA,
+		e.IOA)
+}
+
+func (e *UnknownCauseError) Unwrap() error { return &e.NegativeConfirmError }
+
+func (e *UnknownCauseError) Is(target error) bool {
+	t, ok := target.(*UnknownCauseError)
+	return ok && e.matches(&t.NegativeConfirmError)
+}
+
+// UnknownCommonAddressError is the rejection of an ASDU addressed to a station which doesn't exist, with COT 46.
+type UnknownCommonAddressError struct{ NegativeConfirmError }
+
+func (e *UnknownCommonAddressError) Error() string {
+	return fmt.Sprintf("TypeID[%X] to COA[%d] rejected: unknown common address", e.TypeID, e.COA)
+}
+
+func (e *UnknownCommonAddressError) Unwrap() error { return &e.NegativeConfirmError }
+
+func (e *UnknownCommonAddressError) Is(target error) bool {
+	t, ok := target.(*UnknownCommonAddressError)
+	return ok && e.matches(&t.NegativeConfirmError)
+}
+
+// UnknownObjectAddressError is the rejection of an ASDU whose information object the station doesn't have, with COT
+// 47.
+type UnknownObjectAddressError struct{ NegativeConfirmError }
+
+func (e *UnknownObjectAddressError) Error() string {
+	return fmt.Sprintf("TypeID[%X] to COA[%d] rejected: unknown IOA[%d]", e.TypeID, e.COA, e.IOA)
+}
+
+func (e *UnknownObjectAddressError) Unwrap() error { return &e.NegativeConfirmError }
+
+func (e *UnknownObjectAddressError) Is(target error) bool {
+	t, ok := target.(*UnknownObjectAddressError)
+	return ok && e.matches(&t.NegativeConfirmError)
+}
+
+// rejectionOf returns the error of the negative confirmation of the ASDU addressed by the key.
+func rejectionOf(con *ASDU, key pendingKey) error {
+	neg := NegativeConfirmError{TypeID: key.typeID, COT: con.cot, COA: key.coa, IOA: key.ioa}
+	switch con.cot {
+	case CotUnknownType:
+		return &UnknownTypeError{neg}
+	case CotUnknownCause:
+		return &UnknownCauseError{neg}
+	case CotUnknownAsduAddress:
+		return &UnknownCommonAddressError{neg}
+	case CotUnknownObjectAddress:
+		return &UnknownObjectAddressError{neg}
+	}
+	return &neg
+}
+
+// rejectionCOT returns the cause of transmission which answers the ASDU rejected by the error.
+func rejectionCOT(err error) (COT, bool) {
+	var (
+		unknownType   *UnknownTypeError
+		unknownCause  *UnknownCauseError
+		unknownCOA    *UnknownCommonAddressError
+		unknownObject *UnknownObjectAddressError
+	)
+	switch {
+	case errors.As(err, &unknownType):
+		return CotUnknownType, true
+	case errors.As(err, &unknownCause):
+		return CotUnknownCause, true
+	case errors.As(err, &unknownCOA):
+		return CotUnknownAsduAddress, true
+	case errors.As(err, &unknownObject):
+		return CotUnknownObjectAddress, true
+	}
+	return 0, false
+}
+
+// SequenceError is a send sequence number N(S) or a receive sequence number N(R) received which doesn't match the
+// transmission.
+type SequenceError struct {
+	Number   string // "N(S)" or "N(R)"
+	Received uint16
+	Expected uint16 // N(S) expected, or N(S) of the next I-frame sent for N(R)
+	Unacked  int    // number of unacknowledged I-frames sent, for N(R)
+}
+
+func (e *SequenceError) Error() string {
+	if e.Number == "N(R)" {
+		return fmt.Sprintf("sequence error: receive N(R)=%d, but N(S)=%d with %d unacknowledged I-frames",
+			e.Received, e.Expected, e.Unacked)
+	}
+	return fmt.Sprintf("sequence error: receive %s=%d, expected %d", e.Number, e.Received, e.Expected)
+}
+
+func (e *SequenceError) Is(target error) bool {
+	t, ok := target.(*SequenceError)
+	return ok && (t.Number == "" || t.Number == e.Number)
+}
+
+// TimeoutError is the expiry of a timer, such as t1 of an I-frame which isn't acknowledged or of a command which isn't
+// confirmed.
+type TimeoutError struct {
+	Timer    string // "t1", "t2" or "t3"
+	Duration time.Duration
+	Op       string // what isn't done in time, for example "confirmation of TypeID[2D] to IOA[5]"
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("no %s within %s (%s)", e.Op, e.Timer, e.Duration)
+}
+
+// Timeout reports true, like the errors of the net package which time out.
+func (e *TimeoutError) Timeout() bool { return true }
+
+func (e *TimeoutError) Is(target error) bool {
+	t, ok := target.(*TimeoutError)
+	return ok && (t.Timer == "" || t.Timer == e.Timer)
+}
+
+// FramingError is an APDU received which can't be parsed.
+type FramingError struct {
+	Reason string
+	Data   []byte
+}
+
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("framing error: %s: [% X]", e.Reason, e.Data)
+}
+
+func (e *FramingError) Is(target error) bool {
+	_, ok := target.(*FramingError)
+	return ok
+}
@@ -0,0 +1,119 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNegativeConfirmError_Is(t *testing.T) {
+	neg := NegativeConfirmError{TypeID: CScNa1, COT: CotUnknownObjectAddress, COA: 1, IOA: 5}
+	var err error = &UnknownObjectAddressError{neg}
+
+	tests := []struct {
+		name   string
+		target error
+		want   bool
+	}{
+		{"same error", &UnknownObjectAddressError{neg}, true},
+		{"any unknown object", &UnknownObjectAddressError{}, true},
+		{"unknown object of the command", &UnknownObjectAddressError{NegativeConfirmError{TypeID: CScNa1}}, true},
+		{"unknown object of other command", &UnknownObjectAddressError{NegativeConfirmError{TypeID: CDcNa1}}, false},
+		{"negative confirmation", &NegativeConfirmError{}, true},
+		{"negative confirmation of the object", &NegativeConfirmError{COA: 1, IOA: 5}, true},
+		{"negative confirmation of other object", &NegativeConfirmError{IOA: 6}, false},
+		{"other rejection", &UnknownTypeError{}, false},
+		{"timeout", &TimeoutError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", err, tt.target, got, tt.want)
+			}
+		})
+	}
+
+	var target *NegativeConfirmError
+	if !errors.As(err, &target) || target.IOA != 5 {
+		t.Errorf("errors.As() must find the negative confirmation, got %+v", target)
+	}
+	if cot, ok := rejectionCOT(err); !ok || cot != CotUnknownObjectAddress {
+		t.Errorf("rejectionCOT() = %d, %v", cot, ok)
+	}
+	if _, ok := rejectionCOT(&neg); ok {
+		t.Errorf("rejectionCOT() of a negative confirmation must fail")
+	}
+
+	timeout := error(&TimeoutError{Timer: "t1", Duration: time.Second})
+	if !errors.Is(timeout, &TimeoutError{Timer: "t1"}) || errors.Is(timeout, &TimeoutError{Timer: "t3"}) {
+		t.Errorf("errors.Is() must match the timer of %v", timeout)
+	}
+	if e, ok := timeout.(interface{ Timeout() bool }); !ok || !e.Timeout() {
+		t.Errorf("%v must time out", timeout)
+	}
+}
+
+func TestServer_reject(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg).SetCommonAddresses(1)
+	go func() {
+		_ = s.Serve(listener, NewServeMux().Handle(CScNa1, func(c *Client, apdu *APDU) error {
+			if ioa := apdu.ios[0].ioa; ioa != 5 {
+				return &UnknownObjectAddressError{NegativeConfirmError{TypeID: apdu.typeID, COA: apdu.coa, IOA: ioa}}
+			}
+			return c.SendIFrame(apdu.Mirror(CotActCon, false))
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	single := func(cot COT, coa COA, ioa IOA) *ASDU {
+		return NewASDU(CScNa1, cot, coa, NewInformationObject(ioa, &InformationElement{
+			Format: InformationElementFormat{SCO},
+			Raw:    []byte{0x01},
+		}))
+	}
+	measured, _ := NewInformationElement(MMeNc1, Float(1), 0, time.Time{})
+	tests := []struct {
+		name string
+		asdu *ASDU
+		want error
+	}{
+		{"accepted", single(CotAct, 1, 5), nil},
+		{"unknown object", single(CotAct, 1, 6), &UnknownObjectAddressError{NegativeConfirmError{COA: 1, IOA: 6}}},
+		{"unknown station", single(CotAct, 2, 5), &UnknownCommonAddressError{NegativeConfirmError{COA: 2}}},
+		{"invalid cause", single(CotSpont, 1, 5), &UnknownCauseError{NegativeConfirmError{TypeID: CScNa1}}},
+		{"monitor direction", NewASDU(MMeNc1, CotAct, 1, NewInformationObject(5, measured)), &UnknownTypeError{}},
+		{"without handler", NewASDU(CDcNa1, CotAct, 1, NewInformationObject(5, &InformationElement{
+			Format: InformationElementFormat{DCO},
+			Raw:    []byte{0x02},
+		})), &UnknownTypeError{NegativeConfirmError{TypeID: CDcNa1, COA: 1, IOA: 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.exchange(ctx, tt.asdu)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("exchange() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) || !errors.Is(err, &NegativeConfirmError{}) {
+				t.Errorf("exchange() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package iec104
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Event is an event of a Client delivered by Client.Events, it is one of:
+  - SinglePointEvent, DoublePointEvent, MeasuredEvent and IntegratedTotalEvent, which update a point;
+  - CommandResultEvent, the confirmation or termination of a command;
+  - InterrogationBeginEvent and InterrogationEndEvent of general and counter interrogations;
+  - ClockSyncEvent, the confirmation of a clock synchronization;
+  - EndOfInitializationEvent, the end of initialization of a controlled station, after which its values may be stale;
+  - ConnectionEvent, the change of the connection state;
+  - ProtocolErrorEvent, a violation of the protocol which closes the connection.
+
+Applications use a type switch to handle the events.
+*/
+type Event interface {
+	isEvent()
+}
+
+// PointHeader identifies the information object of a point event, with its quality descriptor and time tag.
+type PointHeader struct {
+	TypeID  TypeID
+	COT     COT
+	COA     COA
+	IOA     IOA
+	Quality QualityDescriptor
+	Ts      time.Time // time tag of the information object, zero if its type has no time tag
+}
+
+type SinglePointEvent struct {
+	PointHeader
+	Value bool
+}
+
+type DoublePointEvent struct {
+	PointHeader
+	Value DoublePoint
+}
+
+// MeasuredEvent is a normalized, scaled or short floating point measured value.
+type MeasuredEvent struct {
+	PointHeader
+	Value float64
+}
+
+type IntegratedTotalEvent struct {
+	PointHeader
+	Counter BinaryCounter
+}
+
+// CommandResultEvent is a command mirrored by the controlled station with COT ActCon, DeactCon, ActTerm or one of the
+// unknown causes 44-47.
+type CommandResultEvent struct {
+	TypeID   TypeID
+	COT      COT
+	COA      COA
+	IOA      IOA
+	Negative bool
+}
+
+// InterrogationBeginEvent is the confirmation of a general (CIcNa1) or counter (CCiNa1) interrogation.
+type InterrogationBeginEvent struct {
+	TypeID   TypeID
+	COA      COA
+	Negative bool
+}
+
+// InterrogationEndEvent is the termination of a general (CIcNa1) or counter (CCiNa1) interrogation.
+type InterrogationEndEvent struct {
+	TypeID TypeID
+	COA    COA
+}
+
+type ClockSyncEvent struct {
+	COA      COA
+	Time     time.Time
+	Negative bool
+}
+
+// EndOfInitializationEvent is the end of initialization (MEiNa1) of the station, for example, after it's restarted.
+type EndOfInitializationEvent struct {
+	COA              COA
+	Cause            CauseOfInitialization
+	ParameterChanged bool // initialized after change of local parameters
+}
+
+type ConnectionState int
+
+const (
+	ConnectionConnected ConnectionState = iota
+	ConnectionClosed                    // closed by Client.Close
+	ConnectionLost                      // closed by an error
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionConnected:
+		return "connected"
+	case ConnectionClosed:
+		return "closed"
+	default:
+		return "lost"
+	}
+}
+
+type ConnectionEvent struct {
+	State ConnectionState
+	Err   error // the error if the connection is lost
+}
+
+type ProtocolErrorEvent struct {
+	Err error
+}
+
+func (SinglePointEvent) isEvent()         {}
+func (DoublePointEvent) isEvent()         {}
+func (MeasuredEvent) isEvent()            {}
+func (IntegratedTotalEvent) isEvent()     {}
+func (CommandResultEvent) isEvent()       {}
+func (InterrogationBeginEvent) isEvent()  {}
+func (InterrogationEndEvent) isEvent()    {}
+func (ClockSyncEvent) isEvent()           {}
+func (EndOfInitializationEvent) isEvent() {}
+func (ConnectionEvent) isEvent()          {}
+func (ProtocolErrorEvent) isEvent()       {}
+
+/*
+Events returns the channel of the events of the client, as an alternative to the handler. The channel is created by
+the first call, and from then on every event is delivered to it in order of reception, before the handler is called.
+
+The channel is never closed, it outlives the connections. The client waits for the application to receive the events
+when the channel is full, which eventually stops reading from the connection and makes the controlled station wait,
+so the application must keep receiving from the channel.
+*/
+func (c *Client) Events() <-chan Event {
+	c.eventsMutex.Lock()
+	defer c.eventsMutex.Unlock()
+	if c.events == nil {
+		c.events = make(chan Event, c.eventBufferSize)
+	}
+	return c.events
+}
+
+func (c *Client) eventChan() chan Event {
+	c.eventsMutex.Lock()
+	defer c.eventsMutex.Unlock()
+	return c.events
+}
+
+// emit delivers the event if Events has been called. It waits while the channel is full, unless the connection of ctx
+// is closed, then the event is dropped.
+func (c *Client) emit(ctx context.Context, ev Event) {
+	events := c.eventChan()
+	if events == nil {
+		return
+	}
+	select {
+	case events <- ev:
+		return
+	default:
+	}
+	select {
+	case events <- ev:
+	case <-ctx.Done():
+		_lg.Warnf("event channel is full, drop %T", ev)
+	}
+}
+
+// emitClosed delivers the event of a closed connection without waiting, Close may be called by the goroutine
+// receiving the events.
+func (c *Client) emitClosed(ev Event) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.emit(ctx, ev)
+}
+
+// eventsOf returns the events of the APDU received from the controlled station.
+func eventsOf(apdu *APDU) []Event {
+	asdu := apdu.ASDU
+	switch asdu.typeID {
+	case CIcNa1, CCiNa1:
+		switch asdu.cot {
+		case CotActCon:
+			return []Event{InterrogationBeginEvent{TypeID: asdu.typeID, COA: asdu.coa, Negative: bool(asdu.pn)}}
+		case CotActTerm:
+			return []Event{InterrogationEndEvent{TypeID: asdu.typeID, COA: asdu.coa}}
+		}
+	case CCsNa1:
+		if asdu.cot == CotActCon || asdu.cot == CotSpont {
+			ev := ClockSyncEvent{COA: asdu.coa, Negative: bool(asdu.pn)}
+			if len(asdu.Signals) > 0 && len(asdu.Signals[0].Raw) >= 7 {
+				ev.Time = parseCP56Time2a(asdu.Signals[0].Raw)
+			}
+			return []Event{ev}
+		}
+	case MEiNa1:
+		if len(asdu.Signals) > 0 {
+			coi := uint8(asdu.Signals[0].Value)
+			return []Event{EndOfInitializationEvent{
+				COA:              asdu.coa,
+				Cause:            CauseOfInitialization(coi &^ coiParameterChanged),
+				ParameterChanged: coi&coiParameterChanged != 0,
+			}}
+		}
+		return nil
+	}
+	if isResponse(asdu) {
+		ev := CommandResultEvent{TypeID: asdu.typeID, COT: asdu.cot, COA: asdu.coa, Negative: bool(asdu.pn)}
+		if len(asdu.ios) > 0 {
+			ev.IOA = asdu.ios[0].ioa
+		}
+		return []Event{ev}
+	}
+	if isControlDirection(asdu.typeID) {
+		return nil
+	}
+
+	events := make([]Event, 0, len(asdu.Signals))
+	for _, ie := range asdu.Signals {
+		header := PointHeader{
+			TypeID:  asdu.typeID,
+			COT:     asdu.cot,
+			COA:     asdu.coa,
+			IOA:     ie.Address,
+			Quality: ie.Quality,
+			Ts:      ie.Ts,
+		}
+		switch value := ie.Typed.(type) {
+		case SinglePoint:
+			events = append(events, SinglePointEvent{PointHeader: header, Value: bool(value)})
+		case DoublePoint:
+			events = append(events, DoublePointEvent{PointHeader: header, Value: value})
+		case Normalized, Scaled, Float:
+			events = append(events, MeasuredEvent{PointHeader: header, Value: value.Float64()})
+		case BinaryCounter:
+			if value.Invalid {
+				header.Quality |= IV
+			}
+			events = append(events, IntegratedTotalEvent{PointHeader: header, Counter: value})
+		}
+	}
+	return events
+}
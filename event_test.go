@@ -0,0 +1,113 @@
+package iec104
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testParseASDU(t *testing.T, asdu *ASDU) *APDU {
+	t.Helper()
+	parsed := new(ASDU)
+	if err := parsed.Parse(asdu.Data()); err != nil {
+		t.Fatalf("parse asdu: %v", err)
+	}
+	return &APDU{ASDU: parsed}
+}
+
+func Test_eventsOf(t *testing.T) {
+	ie := func(raw ...byte) *InformationElement {
+		return &InformationElement{Raw: raw}
+	}
+	command := NewASDU(CScNa1, CotAct, 1, NewInformationObject(9, ie(0x81)))
+	tests := []struct {
+		name string
+		asdu *ASDU
+		want Event
+	}{
+		{
+			"single point",
+			testSinglePoint(5, 1),
+			SinglePointEvent{PointHeader{TypeID: MSpNa1, COT: CotSpont, COA: 1, IOA: 5}, true},
+		},
+		{
+			"double point with quality",
+			NewASDU(MDpNa1, CotInrogen, 1, NewInformationObject(6, ie(byte(IV)|0x02))),
+			DoublePointEvent{PointHeader{TypeID: MDpNa1, COT: CotInrogen, COA: 1, IOA: 6, Quality: IV}, DoublePointOn},
+		},
+		{
+			"measured value",
+			NewASDU(MMeNb1, CotSpont, 2, NewInformationObject(7, ie(0x10, 0x00, 0x00))),
+			MeasuredEvent{PointHeader{TypeID: MMeNb1, COT: CotSpont, COA: 2, IOA: 7}, 16},
+		},
+		{
+			"integrated total",
+			NewASDU(MItNa1, CotReqcogen, 1, NewInformationObject(8, ie(0x10, 0x00, 0x00, 0x00, 0x80|0x20|0x03))),
+			IntegratedTotalEvent{
+				PointHeader{TypeID: MItNa1, COT: CotReqcogen, COA: 1, IOA: 8, Quality: IV},
+				BinaryCounter{Value: 16, Seq: 3, Carry: true, Invalid: true},
+			},
+		},
+		{
+			"negative command confirmation",
+			command.Mirror(CotActCon, true),
+			CommandResultEvent{TypeID: CScNa1, COT: CotActCon, COA: 1, IOA: 9, Negative: true},
+		},
+		{
+			"interrogation begin",
+			NewASDU(CIcNa1, CotActCon, 1, NewInformationObject(0, ie(0x14))),
+			InterrogationBeginEvent{TypeID: CIcNa1, COA: 1},
+		},
+		{
+			"interrogation end",
+			NewASDU(CCiNa1, CotActTerm, 1, NewInformationObject(0, ie(0x05))),
+			InterrogationEndEvent{TypeID: CCiNa1, COA: 1},
+		},
+		{
+			"end of initialization",
+			NewASDU(MEiNa1, CotInit, 3, NewInformationObject(0, ie(0x82))),
+			EndOfInitializationEvent{COA: 3, Cause: CoiRemoteReset, ParameterChanged: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := eventsOf(testParseASDU(t, tt.asdu))
+			if len(events) != 1 || !reflect.DeepEqual(events[0], tt.want) {
+				t.Errorf("eventsOf() = %+v, want %+v", events, tt.want)
+			}
+		})
+	}
+}
+
+func testEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+		return nil
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	s, address := testServer(t)
+	option, _ := NewClientOption(address, nil, time.Second)
+	c := NewClient(option)
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev, ok := testEvent(t, events).(ConnectionEvent); !ok || ev.State != ConnectionConnected {
+		t.Fatalf("expect connected event, got %+v", ev)
+	}
+	s.Send(testSinglePoint(5, 1))
+	if ev, ok := testEvent(t, events).(SinglePointEvent); !ok || ev.IOA != 5 || !ev.Value {
+		t.Fatalf("expect single point event, got %+v", ev)
+	}
+	c.Close()
+	if ev, ok := testEvent(t, events).(ConnectionEvent); !ok || ev.State != ConnectionClosed {
+		t.Fatalf("expect closed event, got %+v", ev)
+	}
+}
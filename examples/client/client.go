@@ -16,51 +16,7 @@ const (
 	serverAddress = "127.0.0.1:2404"
 )
 
-type handler struct{}
-
-func (h handler) GeneralInterrogationHandler(apdu *iec104.APDU) error {
-	for _, signal := range apdu.Signals {
-		fmt.Printf("%f ", signal.Value)
-	}
-	fmt.Println("a")
-	return nil
-}
-
-func (h handler) CounterInterrogationHandler(apdu *iec104.APDU) error {
-	for _, signal := range apdu.Signals {
-		fmt.Printf("%f ", signal.Value)
-	}
-	fmt.Println("b")
-	return nil
-}
-
-func (h handler) ReadCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("c")
-	return nil
-}
-
-func (h handler) ClockSynchronizationHandler(apdu *iec104.APDU) error {
-	fmt.Println("d")
-	return nil
-}
-
-func (h handler) TestCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("e")
-	return nil
-}
-
-func (h handler) ResetProcessCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("f")
-	return nil
-}
-
-func (h handler) DelayAcquisitionCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("g")
-	return nil
-}
-
-func (h handler) APDUHandler(apdu *iec104.APDU) error {
-	fmt.Println("h")
+func printSignals(_ *iec104.Client, apdu *iec104.APDU) error {
 	for _, signal := range apdu.Signals {
 		fmt.Printf("%f ", signal.Value)
 	}
@@ -73,10 +29,17 @@ func main() {
 	logger.SetLevel(logrus.DebugLevel)
 	iec104.SetLogger(logger)
 
-	option, err := iec104.NewClientOption(serverAddress, &handler{}, 10*time.Second)
+	mux := iec104.NewServeMux().Use(iec104.Recover, iec104.Logging(logger))
+	mux.Handle(iec104.CIcNa1, printSignals)
+	mux.Handle(iec104.CCiNa1, printSignals)
+	mux.HandleRoute(iec104.Route{COTs: []iec104.COT{iec104.CotSpont}}, iec104.HandlerFunc(printSignals))
+	mux.HandleDefault(printSignals)
+
+	option, err := iec104.NewClientOption(serverAddress, nil, 10*time.Second)
 	if err != nil {
 		panic(any(err))
 	}
+	option.SetHandler(mux)
 	client := iec104.NewClientWithCoaAddress(option, iec104.COA(1))
 	// client := iec104.NewClient(option)
 	if err := client.Connect(); err != nil {
@@ -85,7 +48,7 @@ func main() {
 	defer client.Close()
 	go func() {
 		for {
-			client.SendReadCommand(25601)
+			client.SendReadCommand(1, 25601)
 			time.Sleep(10 * time.Second)
 
 		}
@@ -94,8 +57,8 @@ func main() {
 
 	// go func() {
 	// 	for {
-	// 		// client.SendGeneralInterrogation()
-	// 		// client.SendCounterInterrogation()
+	// 		// client.SendGeneralInterrogation(iec104.GlobalCOA)
+	// 		// client.SendCounterInterrogation(iec104.GlobalCOA)
 	// 		time.Sleep(5 * time.Second)
 
 	// 	}
@@ -104,28 +67,10 @@ func main() {
 
 	// go func() {
 	// 	for {
-	// 		if client.Signals != nil {
-	// 			// 提取 map 中的所有键
-	// 			keys := make([]iec104.IOA, 0, len(client.Signals))
-	// 			for key := range client.Signals {
-	// 				keys = append(keys, key)
-	// 			}
-	// 			// 对键进行排序
-	// 			n := len(keys)
-	// 			for i := 0; i < n; i++ {
-	// 				for j := 0; j < n-i-1; j++ {
-	// 					if keys[j] > keys[j+1] {
-	// 						// 交换相邻元素
-	// 						keys[j], keys[j+1] = keys[j+1], keys[j]
-	// 					}
-	// 				}
-	// 			}
-
-	// 			for i := 0; i < n; i++ {
-	// 				fmt.Printf("地址为：%d,传输的值为：%f", keys[i], client.Signals[keys[i]])
-	// 				fmt.Println()
-	// 			}
-
+	// 		// 快照按公共地址、信息体地址排序
+	// 		for _, p := range client.ProcessImage().Snapshot() {
+	// 			fmt.Printf("公共地址为：%d,地址为：%d,传输的值为：%f,品质为：%X", p.COA, p.IOA, p.Value, p.Quality)
+	// 			fmt.Println()
 	// 		}
 	// 		time.Sleep(5 * time.Second)
 	// 	}
@@ -133,21 +78,21 @@ func main() {
 
 	// go func() {
 	// 	time.Sleep(2 * time.Second)
-	// 	client.SendCounterInterrogation()
+	// 	client.SendCounterInterrogation(iec104.GlobalCOA)
 	// }()
 
 	// go func() {
 	// 	time.Sleep(3 * time.Second)
-	// 	if err := client.SendSingleCommand(iec104.IOA(1), true /* close */); err != nil {
+	// 	if err := client.SendSingleCommand(1, iec104.IOA(1), true /* close */); err != nil {
 	// 		panic(any(err))
 	// 	}
-	// 	if err := client.SendSingleCommand(iec104.IOA(1), false /* close */); err != nil {
+	// 	if err := client.SendSingleCommand(1, iec104.IOA(1), false /* close */); err != nil {
 	// 		panic(any(err))
 	// 	}
-	// 	if err := client.SendDoubleCommand(iec104.IOA(1), true /* close */); err != nil {
+	// 	if err := client.SendDoubleCommand(1, iec104.IOA(1), true /* close */); err != nil {
 	// 		panic(any(err))
 	// 	}
-	// 	if err := client.SendDoubleCommand(iec104.IOA(1), false /* close */); err != nil {
+	// 	if err := client.SendDoubleCommand(1, iec104.IOA(1), false /* close */); err != nil {
 	// 		panic(any(err))
 	// 	}
 	// }()
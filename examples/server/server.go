@@ -7,50 +7,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-type handler struct{}
-
-func (h handler) GeneralInterrogationHandler(apdu *iec104.APDU) error {
-	for _, signal := range apdu.Signals {
-		fmt.Printf("%f ", signal.Value)
-	}
-	fmt.Println()
-	return nil
-}
-
-func (h handler) CounterInterrogationHandler(apdu *iec104.APDU) error {
-	for _, signal := range apdu.Signals {
-		fmt.Printf("%f ", signal.Value)
-	}
-	fmt.Println()
-	return nil
-}
-
-func (h handler) ReadCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("a")
-	return nil
-}
-
-func (h handler) ClockSynchronizationHandler(apdu *iec104.APDU) error {
-	fmt.Println("a")
-	return nil
-}
-
-func (h handler) TestCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("a")
-	return nil
-}
-
-func (h handler) ResetProcessCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("a")
-	return nil
-}
-
-func (h handler) DelayAcquisitionCommandHandler(apdu *iec104.APDU) error {
-	fmt.Println("a")
-	return nil
-}
-
-func (h handler) APDUHandler(apdu *iec104.APDU) error {
+func printSignals(_ *iec104.Client, apdu *iec104.APDU) error {
 	for _, signal := range apdu.Signals {
 		fmt.Printf("%f ", signal.Value)
 	}
@@ -63,8 +20,13 @@ func main() {
 	logger.SetLevel(logrus.DebugLevel)
 	iec104.SetLogger(logger)
 
+	mux := iec104.NewServeMux().Use(iec104.Recover, iec104.Logging(logger))
+	mux.Handle(iec104.CIcNa1, printSignals)
+	mux.Handle(iec104.CCiNa1, printSignals)
+	mux.HandleDefault(printSignals)
+
 	server := iec104.NewServer(":2404", nil, logger)
-	if err := server.Serve(&handler{}); err != nil {
+	if err := server.ListenAndServe(mux); err != nil {
 		panic(any(err))
 	}
 }
@@ -0,0 +1,377 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+File transfer in monitor direction, by which the controlling station retrieves the files of a controlled station, for
+example the disturbance records of a protection relay:
+
+	controlling station                            controlled station
+	FScNa1 call directory (COT 5)              ->
+	                                           <-  FDrTa1 directory (COT 5), until the entry with LFD
+	FScNa1 select file                         ->
+	                                           <-  FFrNa1 file ready
+	FScNa1 call file                           ->
+	                                           <-  FSrNa1 section ready
+	FScNa1 call section                        ->
+	                                           <-  FSgNa1 segments
+	                                           <-  FLsNa1 last segment with the checksum of the section
+	FAfNa1 acknowledge section                 ->
+	                                           <-  FSrNa1 next section ready ... or
+	                                           <-  FLsNa1 last section with the checksum of the file
+	FAfNa1 acknowledge file                    ->
+
+All ASDUs of the file transfer but the directory have COT 13 (CotFile), and they are addressed by the IOA of the file.
+*/
+
+// File is an entry of the directory of a controlled station.
+type File struct {
+	IOA    IOA
+	Name   uint16    // NOF: 1 transparent file, 2 disturbance data, 3 sequences of events, 4 sequences of analog values
+	Length uint32    // LOF, 24 bits
+	Status uint8     // SOF
+	Ts     time.Time // time of creation
+}
+
+// status of file (SOF)
+const (
+	SofLFD uint8 = 0x20 // the file is the last file of the directory
+	SofFOR uint8 = 0x40 // the name defines a subdirectory
+	SofFA  uint8 = 0x80 // the file transfer is active
+)
+
+// select and call qualifier (SCQ)
+const (
+	scqSelectFile        = 1
+	scqCallFile          = 2
+	scqDeactivateFile    = 3
+	scqSelectSection     = 5
+	scqCallSection       = 6
+	scqDeactivateSection = 7
+)
+
+// last section or segment qualifier (LSQ)
+const (
+	lsqFile    = 1 // file transfer without deactivation
+	lsqSection = 3 // section transfer without deactivation
+)
+
+// acknowledge file or section qualifier (AFQ)
+const (
+	afqFile            = 1 // positive acknowledgement of file transfer
+	afqFileNegative    = 2
+	afqSection         = 3 // positive acknowledgement of section transfer
+	afqSectionNegative = 4
+)
+
+// frqNegative is the bit of the file ready qualifier (FRQ) and section ready qualifier (SRQ) which confirms the select
+// or call negatively.
+const frqNegative = 0x80
+
+// maxSegmentLen is the maximum length of the segment in an ASDU: the maximum length of an ASDU without the data unit
+// identifier, the IOA, NOF, NOS and LOS.
+const maxSegmentLen = MaxAsduLen - AsduHeaderLen - IOALength - 4
+
+// fileElement is the information element of the file transfer, whose fields are used depending on the type.
+type fileElement struct {
+	name      uint16 // NOF
+	section   uint8  // NOS
+	length    uint32 // LOF
+	qualifier uint8  // FRQ, SRQ, SCQ, LSQ or AFQ
+	checksum  uint8  // CHS
+	segment   []byte
+	status    uint8 // SOF
+	ts        time.Time
+}
+
+func (e *fileElement) data(typeID TypeID) []byte {
+	nof := []byte{byte(e.name), byte(e.name >> 8)}
+	lof := []byte{byte(e.length), byte(e.length >> 8), byte(e.length >> 16)}
+	switch typeID {
+	case FFrNa1:
+		return append(append(nof, lof...), e.qualifier)
+	case FSrNa1:
+		return append(append(append(nof, e.section), lof...), e.qualifier)
+	case FScNa1, FAfNa1:
+		return append(nof, e.section, e.qualifier)
+	case FLsNa1:
+		return append(nof, e.section, e.qualifier, e.checksum)
+	case FSgNa1:
+		return append(append(nof, e.section, byte(len(e.segment))), e.segment...)
+	case FDrTa1:
+		return append(append(append(nof, lof...), e.status), serializeCP56Time2a(e.ts)...)
+	}
+	return nil
+}
+
+// parseFileElement parses the information element of the file transfer.
+func parseFileElement(typeID TypeID, raw []byte) (*fileElement, error) {
+	sizes := map[TypeID]int{FFrNa1: 6, FSrNa1: 7, FScNa1: 4, FLsNa1: 5, FAfNa1: 4, FSgNa1: 4, FDrTa1: 13}
+	if size, ok := sizes[typeID]; !ok || len(raw) < size {
+		return nil, fmt.Errorf("invalid information element of TypeID[%X]: % X", typeID, raw)
+	}
+	e := &fileElement{name: uint16(raw[0]) | uint16(raw[1])<<8}
+	lof := func(b []byte) uint32 { return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 }
+	switch typeID {
+	case FFrNa1:
+		e.length, e.qualifier = lof(raw[2:5]), raw[5]
+	case FSrNa1:
+		e.section, e.length, e.qualifier = raw[2], lof(raw[3:6]), raw[6]
+	case FScNa1, FAfNa1:
+		e.section, e.qualifier = raw[2], raw[3]
+	case FLsNa1:
+		e.section, e.qualifier, e.checksum = raw[2], raw[3], raw[4]
+	case FSgNa1:
+		e.section = raw[2]
+		if len(raw) < 4+int(raw[3]) {
+			return nil, fmt.Errorf("invalid segment of length %d: % X", raw[3], raw)
+		}
+		e.segment = raw[4 : 4+int(raw[3])]
+	case FDrTa1:
+		e.length, e.status, e.ts = lof(raw[2:5]), raw[5], parseCP56Time2a(raw[6:13])
+	}
+	return e, nil
+}
+
+// fileASDU returns the ASDU of the file transfer with one information element.
+func fileASDU(typeID TypeID, cot COT, coa COA, ioa IOA, e *fileElement) *ASDU {
+	return NewASDU(typeID, cot, coa, NewInformationObject(ioa, &InformationElement{Raw: e.data(typeID)}))
+}
+
+// fileChecksum is the checksum (CHS) of the data: the arithmetic sum modulo 256.
+func fileChecksum(sum uint8, data []byte) uint8 {
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+// isFileTransfer reports whether the ASDU of the type belongs to the file transfer.
+func isFileTransfer(typeID TypeID) bool {
+	return typeID >= FFrNa1 && typeID <= FScNb1
+}
+
+// transfer is a file transfer waiting for the ASDUs of a station.
+type transfer struct {
+	asdus chan *ASDU
+	done  chan struct{}
+}
+
+var errTransferBusy = errors.New("a file transfer with the station is in progress")
+
+// startTransfer registers the file transfer with the station, only one file transfer with a station is in progress at
+// a time. The returned function unregisters it.
+func (c *Client) startTransfer(coa COA) (*transfer, func(), error) {
+	t := &transfer{asdus: make(chan *ASDU, 16), done: make(chan struct{})}
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+	if _, ok := c.transfers[coa]; ok {
+		return nil, nil, errTransferBusy
+	}
+	c.transfers[coa] = t
+	return t, func() {
+		c.pendingMutex.Lock()
+		delete(c.transfers, coa)
+		c.pendingMutex.Unlock()
+		close(t.done)
+	}, nil
+}
+
+// transfer hands the ASDU of the file transfer over to the transfer waiting for it, and reports whether there is one.
+func (c *Client) transfer(ctx context.Context, asdu *ASDU) bool {
+	if !isFileTransfer(asdu.typeID) || asdu.cot == CotSpont {
+		return false
+	}
+	c.pendingMutex.Lock()
+	t, ok := c.transfers[asdu.coa]
+	c.pendingMutex.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case t.asdus <- asdu:
+	case <-t.done:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+// receiveFile waits at most t1 for the next ASDU of the file transfer.
+func (c *Client) receiveFile(ctx context.Context, t *transfer) (*ASDU, error) {
+	session, _ := c.session()
+	timer := time.NewTimer(c.t1)
+	defer timer.Stop()
+	select {
+	case asdu := <-t.asdus:
+		return asdu, nil
+	case <-timer.C:
+		return nil, &TimeoutError{Timer: "t1", Duration: c.t1, Op: "answer of the file transfer"}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-session.Done():
+		return nil, errNotConnected
+	}
+}
+
+// receiveFileElement waits for the next ASDU of the file transfer and parses its information element, the ASDU must be
+// one of the types.
+func (c *Client) receiveFileElement(ctx context.Context, t *transfer, types ...TypeID) (TypeID, *fileElement, error) {
+	asdu, err := c.receiveFile(ctx, t)
+	if err != nil {
+		return 0, nil, err
+	}
+	if bool(asdu.pn) || asdu.cot >= CotUnknownType || !containsTypeID(types, asdu.typeID) || len(asdu.Signals) == 0 {
+		return 0, nil, fmt.Errorf("unexpected TypeID[%X] with COT[%d] in the file transfer", asdu.typeID, asdu.cot)
+	}
+	e, err := parseFileElement(asdu.typeID, asdu.Signals[0].Raw)
+	return asdu.typeID, e, err
+}
+
+/*
+Directory calls the directory of the station. The directory is sent in one or more ASDUs, until the entry of the last
+file (SofLFD). An empty directory is answered by a directory ASDU without entries, or by the call confirmed positively.
+*/
+func (c *Client) Directory(ctx context.Context, coa COA) ([]File, error) {
+	if !c.IsConnected() {
+		return nil, errNotConnected
+	}
+	t, stop, err := c.startTransfer(coa)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	if err := c.SendIFrame(fileASDU(FScNa1, CotReq, coa, 0, &fileElement{})); err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for {
+		asdu, err := c.receiveFile(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if asdu.typeID == FScNa1 {
+			if bool(asdu.pn) || asdu.cot >= CotUnknownType {
+				return nil, fmt.Errorf("call of the directory rejected with COT[%d]", asdu.cot)
+			}
+			return files, nil
+		}
+		if asdu.typeID != FDrTa1 {
+			continue
+		}
+		if len(asdu.Signals) == 0 {
+			return files, nil
+		}
+		for _, ie := range asdu.Signals {
+			e, err := parseFileElement(FDrTa1, ie.Raw)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, File{IOA: ie.Address, Name: e.name, Length: e.length, Status: e.status, Ts: e.ts})
+			if e.status&SofLFD != 0 {
+				return files, nil
+			}
+		}
+	}
+}
+
+/*
+ReadFile transfers the file of the station to w, and returns the number of bytes written. The file is selected and
+called, and then each section is called: its segments are written to w after the checksum of the section is verified,
+and the section is acknowledged. The file is acknowledged after the checksum of the file is verified.
+*/
+func (c *Client) ReadFile(ctx context.Context, coa COA, ioa IOA, name uint16, w io.Writer) (int64, error) {
+	if !c.IsConnected() {
+		return 0, errNotConnected
+	}
+	t, stop, err := c.startTransfer(coa)
+	if err != nil {
+		return 0, err
+	}
+	defer stop()
+	send := func(typeID TypeID, e *fileElement) error {
+		e.name = name
+		return c.SendIFrame(fileASDU(typeID, CotFile, coa, ioa, e))
+	}
+
+	if err := send(FScNa1, &fileElement{qualifier: scqSelectFile}); err != nil {
+		return 0, err
+	}
+	_, ready, err := c.receiveFileElement(ctx, t, FFrNa1)
+	if err != nil {
+		return 0, err
+	}
+	if ready.qualifier&frqNegative != 0 {
+		return 0, fmt.Errorf("selection of file %d at IOA[%d] confirmed negatively", name, ioa)
+	}
+	if err := send(FScNa1, &fileElement{qualifier: scqCallFile}); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	var sum uint8 // checksum of the file
+	for {
+		typeID, e, err := c.receiveFileElement(ctx, t, FSrNa1, FLsNa1)
+		if err != nil {
+			return written, err
+		}
+		if typeID == FLsNa1 { // last section
+			afq := uint8(afqFile)
+			if e.checksum != sum {
+				afq = afqFileNegative
+				err = fmt.Errorf("checksum %02X of file %d at IOA[%d], want %02X", e.checksum, name, ioa, sum)
+			}
+			if sendErr := send(FAfNa1, &fileElement{qualifier: afq}); err == nil {
+				err = sendErr
+			}
+			return written, err
+		}
+		if e.qualifier&frqNegative != 0 {
+			_ = send(FScNa1, &fileElement{qualifier: scqDeactivateFile})
+			return written, fmt.Errorf("section %d of file %d at IOA[%d] isn't ready", e.section, name, ioa)
+		}
+
+		section, err := c.readSection(ctx, t, e.section, send)
+		if err != nil {
+			return written, err
+		}
+		n, err := w.Write(section)
+		written += int64(n)
+		if err != nil {
+			_ = send(FScNa1, &fileElement{section: e.section, qualifier: scqDeactivateFile})
+			return written, err
+		}
+		sum = fileChecksum(sum, section)
+	}
+}
+
+// readSection calls the section and receives its segments until the last segment, and acknowledges the section if
+// its checksum is verified.
+func (c *Client) readSection(ctx context.Context, t *transfer, nos uint8,
+	send func(TypeID, *fileElement) error) ([]byte, error) {
+	if err := send(FScNa1, &fileElement{section: nos, qualifier: scqCallSection}); err != nil {
+		return nil, err
+	}
+	var section []byte
+	for {
+		typeID, e, err := c.receiveFileElement(ctx, t, FSgNa1, FLsNa1)
+		if err != nil {
+			return nil, err
+		}
+		if typeID == FSgNa1 {
+			section = append(section, e.segment...)
+			continue
+		}
+		if sum := fileChecksum(0, section); e.checksum != sum {
+			_ = send(FAfNa1, &fileElement{section: nos, qualifier: afqSectionNegative})
+			return nil, fmt.Errorf("checksum %02X of section %d, want %02X", e.checksum, nos, sum)
+		}
+		return section, send(FAfNa1, &fileElement{section: nos, qualifier: afqSection})
+	}
+}
@@ -0,0 +1,339 @@
+package iec104
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileProvider provides the files of the controlled stations, which are transferred by FileServer.
+type FileProvider interface {
+	// Directory returns the files of the station.
+	Directory(coa COA) ([]File, error)
+	// Open opens the file of the station at the information object address.
+	Open(coa COA, ioa IOA) (io.ReadCloser, error)
+}
+
+// maxFileLen is the maximum length of a file, whose length (LOF) has 3 bytes.
+const maxFileLen = 1<<24 - 1
+
+/*
+DirFileProvider provides the regular files of a directory of the filesystem, the same to all stations. The files are
+named by the same NOF, and their IOAs are assigned in the order of their names from the base address, so a controlling
+station calls the directory again after the files are changed. The files larger than 16 MiB are left out, since their
+length doesn't fit in LOF.
+*/
+type DirFileProvider struct {
+	dir  string
+	base IOA
+	name uint16
+}
+
+func NewDirFileProvider(dir string, base IOA, name uint16) *DirFileProvider {
+	return &DirFileProvider{dir: dir, base: base, name: name}
+}
+
+// files returns the files of the directory with their paths.
+func (p *DirFileProvider) files() ([]File, []string, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []File
+	var paths []string
+	for _, entry := range entries { // sorted by name
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxFileLen {
+			continue
+		}
+		files = append(files, File{
+			IOA:    p.base + IOA(len(files)),
+			Name:   p.name,
+			Length: uint32(info.Size()),
+			Ts:     info.ModTime(),
+		})
+		paths = append(paths, filepath.Join(p.dir, entry.Name()))
+	}
+	if len(files) > 0 {
+		files[len(files)-1].Status |= SofLFD
+	}
+	return files, paths, nil
+}
+
+func (p *DirFileProvider) Directory(COA) ([]File, error) {
+	files, _, err := p.files()
+	return files, err
+}
+
+func (p *DirFileProvider) Open(_ COA, ioa IOA) (io.ReadCloser, error) {
+	_, paths, err := p.files()
+	if err != nil {
+		return nil, err
+	}
+	if ioa < p.base || int(ioa-p.base) >= len(paths) {
+		return nil, fmt.Errorf("no file at IOA[%d]", ioa)
+	}
+	return os.Open(paths[ioa-p.base])
+}
+
+const (
+	DefaultSectionSize  = 64 * 1024   // size of the sections which a file is divided into
+	DefaultFileIdleTime = time.Minute // time after which a file transfer without any call is forgotten
+)
+
+// maxSections is the maximum number of sections of a file, whose name of section (NOS) has 1 byte.
+const maxSections = 255
+
+/*
+FileServer is the handler of the file transfer in monitor direction, which answers the calls of the directory and
+transfers the files of a FileProvider. It's registered for FScNa1 and FAfNa1, for example:
+
+	mux.HandleRoute(iec104.Route{TypeIDs: []iec104.TypeID{iec104.FScNa1, iec104.FAfNa1}}, iec104.NewFileServer(p))
+
+A selected file is read into memory until its transfer is finished, the connection is closed, or the controlling
+station doesn't call anything for the idle time. At most one file is transferred to each connection and station at a
+time, and a file which is divided into more than 255 sections isn't selected.
+*/
+type FileServer struct {
+	provider    FileProvider
+	sectionSize int
+	idleTime    time.Duration
+
+	mu        sync.Mutex
+	transfers map[fileTransferKey]*fileTransfer
+}
+
+type fileTransferKey struct {
+	c   *Client
+	coa COA
+}
+
+// fileTransfer is the file selected by a controlling station.
+type fileTransfer struct {
+	ioa     IOA
+	name    uint16
+	data    []byte
+	section int // index of the section ready or being transferred
+	timer   *time.Timer
+}
+
+// sections returns the number of sections of the file.
+func (t *fileTransfer) sections(size int) int {
+	return (len(t.data) + size - 1) / size
+}
+
+func NewFileServer(provider FileProvider) *FileServer {
+	return &FileServer{
+		provider:    provider,
+		sectionSize: DefaultSectionSize,
+		idleTime:    DefaultFileIdleTime,
+		transfers:   make(map[fileTransferKey]*fileTransfer),
+	}
+}
+
+// SetSectionSize sets the size of the sections. Since a file has at most 255 sections, files larger than 255 times
+// the size are refused when they are selected.
+func (s *FileServer) SetSectionSize(size int) *FileServer {
+	if size > 0 && size <= maxFileLen {
+		s.sectionSize = size
+	}
+	return s
+}
+
+// SetIdleTime sets the time after which a file transfer is forgotten if the controlling station doesn't call anything.
+func (s *FileServer) SetIdleTime(d time.Duration) *FileServer {
+	if d > 0 {
+		s.idleTime = d
+	}
+	return s
+}
+
+func (s *FileServer) ServeAPDU(c *Client, apdu *APDU) error {
+	if len(apdu.Signals) == 0 {
+		return nil
+	}
+	e, err := parseFileElement(apdu.typeID, apdu.Signals[0].Raw)
+	if err != nil {
+		return err
+	}
+	ioa := apdu.Signals[0].Address
+	switch {
+	case apdu.typeID == FScNa1 && apdu.cot == CotReq:
+		return s.directory(c, apdu.ASDU)
+	case apdu.typeID == FScNa1 && apdu.cot == CotFile:
+		switch e.qualifier & 0x0f {
+		case scqSelectFile:
+			return s.selectFile(c, apdu.coa, ioa, e.name)
+		case scqCallFile:
+			return s.ready(c, apdu.coa, ioa)
+		case scqCallSection:
+			return s.callSection(c, apdu.coa, ioa, e.section)
+		case scqDeactivateFile:
+			s.finish(c, apdu.coa)
+		}
+	case apdu.typeID == FAfNa1 && apdu.cot == CotFile:
+		switch e.qualifier & 0x0f {
+		case afqSection:
+			s.mu.Lock()
+			if t, ok := s.transfers[fileTransferKey{c, apdu.coa}]; ok {
+				t.section++
+			}
+			s.mu.Unlock()
+			return s.ready(c, apdu.coa, ioa)
+		case afqSectionNegative:
+			return s.ready(c, apdu.coa, ioa) // the section is transferred again
+		case afqFile, afqFileNegative:
+			s.finish(c, apdu.coa)
+		}
+	}
+	return nil
+}
+
+// directory answers the call of the directory.
+func (s *FileServer) directory(c *Client, asdu *ASDU) error {
+	files, err := s.provider.Directory(asdu.coa)
+	if err != nil {
+		return c.SendIFrame(asdu.Mirror(CotReq, true))
+	}
+	if len(files) == 0 {
+		return c.SendIFrame(NewASDU(FDrTa1, CotReq, asdu.coa))
+	}
+	max := (MaxAsduLen - AsduHeaderLen) / (IOALength + 13)
+	for len(files) > 0 {
+		n := max
+		if n > len(files) {
+			n = len(files)
+		}
+		ios := make([]*InformationObject, 0, n)
+		for _, f := range files[:n] {
+			e := &fileElement{name: f.Name, length: f.Length, status: f.Status, ts: f.Ts}
+			ios = append(ios, NewInformationObject(f.IOA, &InformationElement{Raw: e.data(FDrTa1)}))
+		}
+		if err := c.SendIFrame(NewASDU(FDrTa1, CotReq, asdu.coa, ios...)); err != nil {
+			return err
+		}
+		files = files[n:]
+	}
+	return nil
+}
+
+// selectFile reads the file selected, and answers whether it's ready.
+func (s *FileServer) selectFile(c *Client, coa COA, ioa IOA, name uint16) error {
+	data, err := s.read(coa, ioa)
+	if err == nil && (len(data)+s.sectionSize-1)/s.sectionSize > maxSections {
+		err = fmt.Errorf("file at IOA[%d] has more than %d sections", ioa, maxSections)
+	}
+	if err != nil {
+		_lg.Warnf("select file: %v", err)
+		return c.SendIFrame(fileASDU(FFrNa1, CotFile, coa, ioa, &fileElement{name: name, qualifier: frqNegative}))
+	}
+	key := fileTransferKey{c, coa}
+	t := &fileTransfer{ioa: ioa, name: name, data: data}
+	s.mu.Lock()
+	s.forget(key)
+	for k := range s.transfers {
+		if !k.c.IsConnected() {
+			s.forget(k)
+		}
+	}
+	t.timer = time.AfterFunc(s.idleTime, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.transfers[key] == t {
+			s.forget(key)
+		}
+	})
+	s.transfers[key] = t
+	s.mu.Unlock()
+	return c.SendIFrame(fileASDU(FFrNa1, CotFile, coa, ioa, &fileElement{name: name, length: uint32(len(data))}))
+}
+
+func (s *FileServer) read(coa COA, ioa IOA) ([]byte, error) {
+	r, err := s.provider.Open(coa, ioa)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxFileLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileLen {
+		return nil, fmt.Errorf("file at IOA[%d] is larger than %d bytes", ioa, maxFileLen)
+	}
+	return data, nil
+}
+
+// transfer returns the file transfer of the selected file at the address.
+func (s *FileServer) transfer(c *Client, coa COA, ioa IOA) (*fileTransfer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transfers[fileTransferKey{c, coa}]
+	if !ok || t.ioa != ioa {
+		return nil, false
+	}
+	t.timer.Reset(s.idleTime)
+	return t, true
+}
+
+// ready announces the next section of the file, or the last section with the checksum of the file.
+func (s *FileServer) ready(c *Client, coa COA, ioa IOA) error {
+	t, ok := s.transfer(c, coa, ioa)
+	if !ok {
+		return c.SendIFrame(fileASDU(FFrNa1, CotFile, coa, ioa, &fileElement{qualifier: frqNegative}))
+	}
+	if t.section >= t.sections(s.sectionSize) {
+		e := &fileElement{name: t.name, qualifier: lsqFile, checksum: fileChecksum(0, t.data)}
+		return c.SendIFrame(fileASDU(FLsNa1, CotFile, coa, ioa, e))
+	}
+	e := &fileElement{name: t.name, section: uint8(t.section + 1), length: uint32(len(s.section(t, t.section)))}
+	return c.SendIFrame(fileASDU(FSrNa1, CotFile, coa, ioa, e))
+}
+
+func (s *FileServer) section(t *fileTransfer, i int) []byte {
+	end := (i + 1) * s.sectionSize
+	if end > len(t.data) {
+		end = len(t.data)
+	}
+	return t.data[i*s.sectionSize : end]
+}
+
+// callSection sends the segments of the section and the last segment with the checksum of the section.
+func (s *FileServer) callSection(c *Client, coa COA, ioa IOA, nos uint8) error {
+	t, ok := s.transfer(c, coa, ioa)
+	if !ok || int(nos) != t.section+1 {
+		return c.SendIFrame(fileASDU(FSrNa1, CotFile, coa, ioa, &fileElement{section: nos, qualifier: frqNegative}))
+	}
+	section := s.section(t, t.section)
+	for rest := section; len(rest) > 0; {
+		n := maxSegmentLen
+		if n > len(rest) {
+			n = len(rest)
+		}
+		e := &fileElement{name: t.name, section: nos, segment: rest[:n]}
+		if err := c.SendIFrame(fileASDU(FSgNa1, CotFile, coa, ioa, e)); err != nil {
+			return err
+		}
+		rest = rest[n:]
+	}
+	e := &fileElement{name: t.name, section: nos, qualifier: lsqSection, checksum: fileChecksum(0, section)}
+	return c.SendIFrame(fileASDU(FLsNa1, CotFile, coa, ioa, e))
+}
+
+// finish forgets the file transfer of the station.
+func (s *FileServer) finish(c *Client, coa COA) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(fileTransferKey{c, coa})
+}
+
+// forget forgets the file transfer. It must be called with mu held.
+func (s *FileServer) forget(key fileTransferKey) {
+	if t, ok := s.transfers[key]; ok {
+		t.timer.Stop()
+		delete(s.transfers, key)
+	}
+}
@@ -0,0 +1,140 @@
+package iec104
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_fileElement(t *testing.T) {
+	ts := time.Date(2024, time.March, 1, 10, 30, 15, 0, time.Local)
+	tests := []struct {
+		name    string
+		typeID  TypeID
+		element fileElement
+	}{
+		{"file ready", FFrNa1, fileElement{name: 2, length: 0x123456, qualifier: frqNegative}},
+		{"section ready", FSrNa1, fileElement{name: 2, section: 3, length: 1000}},
+		{"call section", FScNa1, fileElement{name: 2, section: 3, qualifier: scqCallSection}},
+		{"last segment", FLsNa1, fileElement{name: 2, section: 3, qualifier: lsqSection, checksum: 0xab}},
+		{"acknowledge file", FAfNa1, fileElement{name: 2, qualifier: afqFile}},
+		{"segment", FSgNa1, fileElement{name: 2, section: 1, segment: []byte{1, 2, 3}}},
+		{"directory", FDrTa1, fileElement{name: 2, length: 1000, status: SofLFD, ts: ts}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asdu := new(ASDU)
+			if err := asdu.Parse(fileASDU(tt.typeID, CotFile, 1, 100, &tt.element).Data()); err != nil {
+				t.Fatal(err)
+			}
+			if asdu.Signals[0].Address != 100 {
+				t.Errorf("IOA = %d, want 100", asdu.Signals[0].Address)
+			}
+			got, err := parseFileElement(tt.typeID, asdu.Signals[0].Raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ts.Equal(tt.element.ts) {
+				got.ts = tt.element.ts
+			}
+			if !reflect.DeepEqual(*got, tt.element) {
+				t.Errorf("parseFileElement() = %+v, want %+v", *got, tt.element)
+			}
+		})
+	}
+}
+
+func TestClient_ReadFile(t *testing.T) {
+	dir := t.TempDir()
+	record := make([]byte, 1300)
+	rand.New(rand.NewSource(1)).Read(record)
+	for name, data := range map[string][]byte{"a.cfg": []byte("station,1\n"), "b.dat": record} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	files := NewFileServer(NewDirFileProvider(dir, 1000, 2)).SetSectionSize(500)
+	small := NewFileServer(NewDirFileProvider(dir, 1000, 2)).SetSectionSize(5).SetIdleTime(100 * time.Millisecond)
+	empty := NewFileServer(NewDirFileProvider(t.TempDir(), 1000, 2))
+	mux := NewServeMux().
+		HandleRoute(Route{TypeIDs: []TypeID{FScNa1, FAfNa1}, COAs: []COA{1}}, files).
+		HandleRoute(Route{TypeIDs: []TypeID{FScNa1, FAfNa1}, COAs: []COA{2}}, small).
+		HandleRoute(Route{TypeIDs: []TypeID{FScNa1, FAfNa1}, COAs: []COA{3}}, empty)
+	go func() {
+		_ = s.Serve(listener, mux)
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	directory, err := c.Directory(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(directory) != 2 || directory[0].IOA != 1000 || directory[1].IOA != 1001 || directory[1].Length != 1300 ||
+		directory[1].Name != 2 || directory[1].Status&SofLFD == 0 || directory[1].Ts.IsZero() {
+		t.Fatalf("Directory() = %+v", directory)
+	}
+
+	var buf bytes.Buffer
+	n, err := c.ReadFile(ctx, 1, 1001, 2, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1300 || !bytes.Equal(buf.Bytes(), record) {
+		t.Errorf("ReadFile() = %d bytes, want the 1300 bytes of the record", n)
+	}
+
+	if _, err := c.ReadFile(ctx, 1, 1002, 2, &buf); err == nil {
+		t.Errorf("ReadFile() of an unknown file must fail")
+	}
+
+	if directory, err := c.Directory(ctx, 3); err != nil || len(directory) != 0 {
+		t.Errorf("Directory() of an empty directory = %+v, %v", directory, err)
+	}
+
+	// the record has 260 sections of 5 bytes
+	if _, err := c.ReadFile(ctx, 2, 1001, 2, &buf); err == nil {
+		t.Errorf("ReadFile() of a file of more than 255 sections must fail")
+	}
+
+	// the selected file which is never called is forgotten after the idle time
+	selectFile := fileASDU(FScNa1, CotFile, 2, 1000, &fileElement{name: 2, qualifier: scqSelectFile})
+	if err := c.SendIFrame(selectFile); err != nil {
+		t.Fatal(err)
+	}
+	transfers := func() int {
+		small.mu.Lock()
+		defer small.mu.Unlock()
+		return len(small.transfers)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for transfers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for transfers() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := transfers(); n != 0 || time.Now().After(deadline) {
+		t.Errorf("%d file transfers remain after the idle time", n)
+	}
+}
@@ -0,0 +1,419 @@
+/*
+Package gateway bridges controlling stations upstream to controlled stations downstream, as a concentrator does.
+
+A Gateway serves the upstream controlling stations with an iec104.Server, and connects to each downstream controlled
+station with an iec104.Client, called a link. The information objects are exposed upstream by a mapping Table:
+  - the monitored information received downstream spontaneously, cyclically or as return information is sent
+    upstream with the mapped addresses and types;
+  - the general and counter interrogations from upstream are answered from the process images of the links, which the
+    gateway fills by interrogating each link after it is connected, and the interrogations of a group by the objects
+    mapped to the group;
+  - the commands from upstream, with or without time tag, are sent downstream as they are, so a select and execute
+    command stays select and execute, and their confirmations and terminations are sent back to the controlling station which issued them. A
+    command which the link doesn't answer within the command time-out is confirmed negatively;
+  - the clock synchronizations from upstream are confirmed negatively, since the gateway doesn't keep the clocks of
+    the downstream stations, which are synchronized by their own means.
+*/
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultReconnectInterval = 5 * time.Second  // interval between the attempts to connect a link
+	DefaultCommandTimeout    = iec104.DefaultT1 // time-out of the answers of a link to a command, t1
+)
+
+type Gateway struct {
+	server *iec104.Server
+	table  *Table
+	lg     *logrus.Logger
+
+	mu      sync.Mutex
+	links   map[string]*iec104.Client
+	pending map[command]*pendingCommand // upstream commands waiting for their confirmations from downstream
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	reconnectInterval time.Duration
+	commandTimeout    time.Duration
+}
+
+// command identifies a command sent downstream.
+type command struct {
+	typeID iec104.TypeID
+	linkAddress
+}
+
+// pendingCommand is an upstream command sent downstream, which expires if the link doesn't answer it in time.
+type pendingCommand struct {
+	asdu      *iec104.ASDU
+	confirmed bool
+	timer     *time.Timer
+}
+
+func New(server *iec104.Server, table *Table, lg *logrus.Logger) *Gateway {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Gateway{
+		server:            server,
+		table:             table,
+		lg:                lg,
+		links:             make(map[string]*iec104.Client),
+		pending:           make(map[command]*pendingCommand),
+		ctx:               ctx,
+		cancel:            cancel,
+		reconnectInterval: DefaultReconnectInterval,
+		commandTimeout:    DefaultCommandTimeout,
+	}
+}
+
+func (g *Gateway) SetReconnectInterval(interval time.Duration) *Gateway {
+	if interval > 0 {
+		g.reconnectInterval = interval
+	}
+	return g
+}
+
+// SetCommandTimeout sets the time-out of the confirmation and of the termination of a command sent downstream, t1 of
+// the links by default.
+func (g *Gateway) SetCommandTimeout(timeout time.Duration) *Gateway {
+	if timeout > 0 {
+		g.commandTimeout = timeout
+	}
+	return g
+}
+
+/*
+AddLink adds the downstream link to a controlled station, whose information objects are mapped by the name. The handler
+and the connection handlers of the option are replaced by the gateway: after the link is connected, the gateway starts
+the data transfer and interrogates all stations of the link, and it reconnects the link when the connection is lost.
+*/
+func (g *Gateway) AddLink(name string, option *iec104.ClientOption) *iec104.Client {
+	option.SetHandler(iec104.HandlerFunc(func(c *iec104.Client, apdu *iec104.APDU) error {
+		return g.downstream(name, apdu)
+	}))
+	option.SetOnConnectHandler(func(c *iec104.Client) {
+		if err := c.StartDT(); err != nil {
+			g.lg.Errorf("start data transfer of link %s: %v", name, err)
+			return
+		}
+		if err := c.SendGeneralInterrogation(iec104.GlobalCOA); err != nil {
+			g.lg.Errorf("interrogate link %s: %v", name, err)
+		}
+	})
+	option.SetOnConnectionLostHandler(func(c *iec104.Client, err error) {
+		if g.ctx.Err() == nil {
+			go g.connect(name, c)
+		}
+	})
+	c := iec104.NewClient(option)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.links[name] = c
+	return c
+}
+
+// Link returns the client of the downstream link.
+func (g *Gateway) Link(name string) (*iec104.Client, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c, ok := g.links[name]
+	return c, ok
+}
+
+// Serve connects the downstream links, and serves the upstream controlling stations on the listener until Shutdown is
+// called. The links which can't be connected are retried in the background.
+func (g *Gateway) Serve(listener net.Listener) error {
+	g.mu.Lock()
+	links := make(map[string]*iec104.Client, len(g.links))
+	for name, c := range g.links {
+		links[name] = c
+	}
+	g.mu.Unlock()
+	for name, c := range links {
+		go g.connect(name, c)
+	}
+	return g.server.Serve(listener, g)
+}
+
+// connect connects the link, and retries until it's connected or the gateway is shut down.
+func (g *Gateway) connect(name string, c *iec104.Client) {
+	for {
+		err := c.Connect()
+		if err == nil {
+			g.lg.Infof("link %s connected", name)
+			return
+		}
+		g.lg.Warnf("connect link %s: %v, retrying in %s", name, err, g.reconnectInterval)
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-time.After(g.reconnectInterval):
+		}
+	}
+}
+
+// Shutdown closes the downstream links and shuts down the upstream server.
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.cancel()
+	g.mu.Lock()
+	links := make([]*iec104.Client, 0, len(g.links))
+	for _, c := range g.links {
+		links = append(links, c)
+	}
+	g.mu.Unlock()
+	for _, c := range links {
+		c.Close()
+	}
+	return g.server.Shutdown(ctx)
+}
+
+// ServeAPDU handles the ASDUs from the upstream controlling stations.
+func (g *Gateway) ServeAPDU(c *iec104.Client, apdu *iec104.APDU) error {
+	switch apdu.TypeID() {
+	case iec104.CIcNa1, iec104.CCiNa1:
+		if apdu.COT() != iec104.CotAct {
+			return c.SendIFrame(apdu.Mirror(iec104.CotUnknownCause, true))
+		}
+		return g.interrogate(c, apdu.ASDU)
+	case iec104.CCsNa1:
+		return c.SendIFrame(apdu.Mirror(iec104.CotActCon, true))
+	case iec104.CScNa1, iec104.CDcNa1, iec104.CRcNa1, iec104.CSeNa1, iec104.CSeNb1, iec104.CSeNc1,
+		iec104.CScTa1, iec104.CDcTa1, iec104.CSeTa1, iec104.CSeTb1, iec104.CSeTc1:
+		return g.forward(c, apdu.ASDU)
+	}
+	if apdu.COT() == iec104.CotAct || apdu.COT() == iec104.CotDeact {
+		return c.SendIFrame(apdu.Mirror(iec104.CotUnknownType, true))
+	}
+	return nil
+}
+
+// object is an information object converted for upstream.
+type object struct {
+	coa    iec104.COA
+	ioa    iec104.IOA
+	typeID iec104.TypeID
+	ie     *iec104.InformationElement
+}
+
+// interrogate answers the interrogation from the process images of the links: the general interrogation by the
+// monitored information except the integrated totals, and the counter interrogation by the integrated totals, or by
+// those mapped to the group for QOI 21-36 and RQT 1-4.
+func (g *Gateway) interrogate(c *iec104.Client, asdu *iec104.ASDU) error {
+	coa := asdu.COA()
+	if coa != iec104.GlobalCOA && !g.table.HasStation(coa) {
+		return c.SendIFrame(asdu.Mirror(iec104.CotUnknownAsduAddress, true))
+	}
+	var qualifier uint8
+	if len(asdu.Signals) > 0 && len(asdu.Signals[0].Raw) > 0 {
+		qualifier = asdu.Signals[0].Raw[0]
+	}
+	counters := asdu.TypeID() == iec104.CCiNa1
+	cot, number := iec104.COT(qualifier), uint8(0)
+	switch {
+	case !counters && cot >= iec104.CotInro1 && cot <= iec104.CotInro16:
+		number = uint8(cot - iec104.CotInrogen)
+	case counters && qualifier&0x3f >= 1 && qualifier&0x3f <= 4:
+		number = qualifier & 0x3f
+		cot = iec104.CotReqcogen + iec104.COT(number)
+	case counters:
+		cot = iec104.CotReqcogen
+	default:
+		cot = iec104.CotInrogen
+	}
+
+	var objects []object
+	g.mu.Lock()
+	for name, link := range g.links {
+		for _, p := range link.ProcessImage().Snapshot() {
+			m, ok := g.table.Upstream(name, p.COA, p.IOA)
+			if !ok || (coa != iec104.GlobalCOA && m.Upstream.COA != coa) {
+				continue
+			}
+			if (p.TypeID.Family() == iec104.MItNa1) != counters || (number != 0 && !m.inGroup(number)) {
+				continue
+			}
+			typeID := p.TypeID
+			if m.TypeID != 0 {
+				typeID = m.TypeID
+			}
+			typeID = typeID.Family() // interrogated information is sent without time tag
+			ie, err := iec104.NewInformationElement(typeID, p.Typed, p.Quality, p.Ts)
+			if err != nil {
+				g.lg.Warnf("convert IOA[%d] of COA[%d] of link %s: %v", p.IOA, p.COA, name, err)
+				continue
+			}
+			objects = append(objects, object{coa: m.Upstream.COA, ioa: m.Upstream.IOA, typeID: typeID, ie: ie})
+		}
+	}
+	g.mu.Unlock()
+	sort.Slice(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if a.coa != b.coa {
+			return a.coa < b.coa
+		}
+		if a.typeID != b.typeID {
+			return a.typeID < b.typeID
+		}
+		return a.ioa < b.ioa
+	})
+
+	if err := c.SendIFrame(asdu.Mirror(iec104.CotActCon, false)); err != nil {
+		return err
+	}
+	for _, x := range group(cot, objects) {
+		if err := c.SendIFrame(x); err != nil {
+			return err
+		}
+	}
+	return c.SendIFrame(asdu.Mirror(iec104.CotActTerm, false))
+}
+
+// group puts the consecutive information objects of the same station and type into as few ASDUs as possible.
+func group(cot iec104.COT, objects []object) []*iec104.ASDU {
+	var asdus []*iec104.ASDU
+	for i := 0; i < len(objects); {
+		first := objects[i]
+		max := (iec104.MaxAsduLen - iec104.AsduHeaderLen) / (iec104.IOALength + len(first.ie.Raw))
+		ios := []*iec104.InformationObject{iec104.NewInformationObject(first.ioa, first.ie)}
+		for i++; i < len(objects) && len(ios) < max; i++ {
+			if x := objects[i]; x.coa != first.coa || x.typeID != first.typeID {
+				break
+			}
+			ios = append(ios, iec104.NewInformationObject(objects[i].ioa, objects[i].ie))
+		}
+		asdus = append(asdus, iec104.NewASDU(first.typeID, cot, first.coa, ios...))
+	}
+	return asdus
+}
+
+// forward sends the command downstream, or rejects it if its address isn't mapped or its link isn't connected.
+func (g *Gateway) forward(c *iec104.Client, asdu *iec104.ASDU) error {
+	if len(asdu.Signals) != 1 {
+		return c.SendIFrame(asdu.Mirror(iec104.CotActCon, true))
+	}
+	ie := asdu.Signals[0]
+	m, ok := g.table.Downstream(asdu.COA(), ie.Address)
+	if !ok {
+		if !g.table.HasStation(asdu.COA()) {
+			return c.SendIFrame(asdu.Mirror(iec104.CotUnknownAsduAddress, true))
+		}
+		return c.SendIFrame(asdu.Mirror(iec104.CotUnknownObjectAddress, true))
+	}
+	link, ok := g.Link(m.Link)
+	if !ok || !link.IsConnected() {
+		return c.SendIFrame(asdu.Mirror(iec104.CotActCon, true))
+	}
+
+	key := command{typeID: asdu.TypeID(), linkAddress: linkAddress{link: m.Link, Address: m.Downstream}}
+	pc := &pendingCommand{asdu: asdu}
+	g.mu.Lock()
+	if old, ok := g.pending[key]; ok {
+		old.timer.Stop()
+	}
+	pc.timer = time.AfterFunc(g.commandTimeout, func() { g.expire(key, pc) })
+	g.pending[key] = pc
+	g.mu.Unlock()
+	down := iec104.NewASDU(asdu.TypeID(), asdu.COT(), m.Downstream.COA,
+		iec104.NewInformationObject(m.Downstream.IOA, &iec104.InformationElement{Raw: ie.Raw}))
+	if err := link.SendIFrame(down); err != nil {
+		g.mu.Lock()
+		if g.pending[key] == pc {
+			pc.timer.Stop()
+			delete(g.pending, key)
+		}
+		g.mu.Unlock()
+		return c.SendIFrame(asdu.Mirror(iec104.CotActCon, true))
+	}
+	return nil
+}
+
+// expire forgets the command which the link doesn't answer in time, and confirms it negatively if it isn't confirmed
+// yet.
+func (g *Gateway) expire(key command, pc *pendingCommand) {
+	g.mu.Lock()
+	if g.pending[key] != pc {
+		g.mu.Unlock()
+		return
+	}
+	delete(g.pending, key)
+	confirmed := pc.confirmed
+	g.mu.Unlock()
+	g.lg.Warnf("link %s doesn't answer TypeID[%X] to IOA[%d] of COA[%d] in time", key.link, key.typeID, key.IOA,
+		key.COA)
+	if !confirmed {
+		g.server.Send(pc.asdu.Mirror(iec104.CotActCon, true))
+	}
+}
+
+// downstream handles the ASDUs received from the link.
+func (g *Gateway) downstream(link string, apdu *iec104.APDU) error {
+	if len(apdu.Signals) == 0 {
+		return nil
+	}
+	switch apdu.COT() {
+	case iec104.CotActCon, iec104.CotDeactCon, iec104.CotActTerm, iec104.CotUnknownType, iec104.CotUnknownCause,
+		iec104.CotUnknownAsduAddress, iec104.CotUnknownObjectAddress:
+		g.relay(link, apdu.ASDU)
+		return nil
+	case iec104.CotPerCyc, iec104.CotBack, iec104.CotSpont, iec104.CotRetRem, iec104.CotRetLoc:
+	default:
+		return nil // interrogated information is kept in the process image of the link
+	}
+
+	var objects []object
+	for _, ie := range apdu.Signals {
+		m, ok := g.table.Upstream(link, apdu.COA(), ie.Address)
+		if !ok || ie.Typed == nil {
+			continue
+		}
+		typeID := apdu.TypeID()
+		if m.TypeID != 0 {
+			typeID = m.TypeID
+		}
+		converted, err := iec104.NewInformationElement(typeID, ie.Typed, ie.Quality, ie.Ts)
+		if err != nil {
+			return fmt.Errorf("convert IOA[%d] of COA[%d] of link %s: %w", ie.Address, apdu.COA(), link, err)
+		}
+		objects = append(objects, object{coa: m.Upstream.COA, ioa: m.Upstream.IOA, typeID: typeID, ie: converted})
+	}
+	for _, asdu := range group(apdu.COT(), objects) {
+		g.server.Send(asdu)
+	}
+	return nil
+}
+
+// relay sends the confirmation or termination of a command back to the controlling station which issued it.
+func (g *Gateway) relay(link string, asdu *iec104.ASDU) {
+	key := command{
+		typeID:      asdu.TypeID(),
+		linkAddress: linkAddress{link: link, Address: Address{COA: asdu.COA(), IOA: asdu.Signals[0].Address}},
+	}
+	g.mu.Lock()
+	pc, ok := g.pending[key]
+	if ok {
+		pc.confirmed = true
+		if asdu.COT() == iec104.CotActTerm || asdu.COT() >= iec104.CotUnknownType || asdu.Negative() {
+			pc.timer.Stop()
+			delete(g.pending, key) // the command is finished
+		} else {
+			pc.timer.Reset(g.commandTimeout) // waiting for the termination
+		}
+	}
+	g.mu.Unlock()
+	if !ok {
+		g.lg.Debugf("no command waiting for TypeID[%X] with COT[%d] from link %s", asdu.TypeID(), asdu.COT(), link)
+		return
+	}
+	g.server.Send(pc.asdu.Mirror(asdu.COT(), asdu.Negative()))
+}
@@ -0,0 +1,223 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+	"github.com/sirupsen/logrus"
+)
+
+func testListen(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func testElement(t *testing.T, typeID iec104.TypeID, value iec104.TypedValue) *iec104.InformationElement {
+	t.Helper()
+	ie, err := iec104.NewInformationElement(typeID, value, 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ie
+}
+
+// testStation serves a controlled station with the normalized value 0.5 at IOA 100 of COA 1, and confirms the single
+// commands with or without time tag, which are passed to the channel.
+func testStation(t *testing.T, commands chan<- *iec104.ASDU) (*iec104.Server, string) {
+	listener := testListen(t)
+	s := iec104.NewServer(listener.Addr().String(), nil, logrus.StandardLogger())
+	go func() {
+		_ = s.Serve(listener, iec104.HandlerFunc(func(c *iec104.Client, apdu *iec104.APDU) error {
+			switch apdu.TypeID() {
+			case iec104.CIcNa1:
+				_ = c.SendIFrame(apdu.Mirror(iec104.CotActCon, false))
+				_ = c.SendIFrame(iec104.NewASDU(iec104.MMeNa1, iec104.CotInrogen, 1,
+					iec104.NewInformationObject(100, testElement(t, iec104.MMeNa1, iec104.Normalized(16384))),
+					iec104.NewInformationObject(101, testElement(t, iec104.MMeNa1, iec104.Normalized(0)))))
+				return c.SendIFrame(apdu.Mirror(iec104.CotActTerm, false))
+			case iec104.CScNa1, iec104.CScTa1:
+				commands <- apdu.ASDU
+				_ = c.SendIFrame(apdu.Mirror(iec104.CotActCon, false))
+				if apdu.Signals[0].Raw[0]&0x80 == 0 { // execute
+					return c.SendIFrame(apdu.Mirror(iec104.CotActTerm, false))
+				}
+			}
+			return nil
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return s, listener.Addr().String()
+}
+
+func testEvent(t *testing.T, events <-chan iec104.Event) iec104.Event {
+	t.Helper()
+	for {
+		select {
+		case ev := <-events:
+			if _, ok := ev.(iec104.CommandResultEvent); ok {
+				continue // checked by the result of the command
+			}
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event")
+			return nil
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	commands := make(chan *iec104.ASDU, 4)
+	station, stationAddress := testStation(t, commands)
+
+	table, err := NewTable(
+		Mapping{Link: "rtu", Downstream: Address{1, 100}, Upstream: Address{10, 1000}, TypeID: iec104.MMeTf1,
+			Groups: []uint8{1}},
+		Mapping{Link: "rtu", Downstream: Address{1, 101}, Upstream: Address{10, 1010}},
+		Mapping{Link: "rtu", Downstream: Address{1, 200}, Upstream: Address{10, 2000}},
+		Mapping{Link: "rtu", Downstream: Address{1, 300}, Upstream: Address{10, 3000}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := testListen(t)
+	g := New(iec104.NewServer(listener.Addr().String(), nil, logrus.StandardLogger()), table, logrus.StandardLogger()).
+		SetCommandTimeout(200 * time.Millisecond)
+	option, _ := iec104.NewClientOption(stationAddress, nil, time.Second)
+	link := g.AddLink("rtu", option)
+	go func() {
+		_ = g.Serve(listener)
+	}()
+	t.Cleanup(func() { _ = g.Shutdown(context.Background()) })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for link.ProcessImage().Len() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the link is not interrogated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	upstream, _ := iec104.NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := iec104.NewClient(upstream)
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testEvent(t, events) // connected
+
+	t.Run("interrogation from cache", func(t *testing.T) {
+		if err := c.SendGeneralInterrogation(10); err != nil {
+			t.Fatal(err)
+		}
+		if ev, ok := testEvent(t, events).(iec104.InterrogationBeginEvent); !ok || ev.Negative {
+			t.Fatalf("expect positive confirmation, got %+v", ev)
+		}
+		if ev, ok := testEvent(t, events).(iec104.MeasuredEvent); !ok || ev.IOA != 1010 {
+			t.Fatalf("expect the measured value of IOA 1010, got %+v", ev)
+		}
+		ev, ok := testEvent(t, events).(iec104.MeasuredEvent)
+		if !ok || ev.TypeID != iec104.MMeNc1 || ev.COA != 10 || ev.IOA != 1000 || ev.Value != 0.5 ||
+			ev.COT != iec104.CotInrogen {
+			t.Fatalf("expect the mapped measured value, got %+v", ev)
+		}
+		if ev, ok := testEvent(t, events).(iec104.InterrogationEndEvent); !ok {
+			t.Fatalf("expect termination, got %+v", ev)
+		}
+	})
+
+	t.Run("group interrogation", func(t *testing.T) {
+		if err := c.SendGroupInterrogation(10, 1); err != nil {
+			t.Fatal(err)
+		}
+		if ev, ok := testEvent(t, events).(iec104.InterrogationBeginEvent); !ok || ev.Negative {
+			t.Fatalf("expect positive confirmation, got %+v", ev)
+		}
+		ev, ok := testEvent(t, events).(iec104.MeasuredEvent)
+		if !ok || ev.IOA != 1000 || ev.COT != iec104.CotInro1 {
+			t.Fatalf("expect the measured value of group 1 with COT 21, got %+v", ev)
+		}
+		if ev, ok := testEvent(t, events).(iec104.InterrogationEndEvent); !ok {
+			t.Fatalf("expect termination, got %+v", ev)
+		}
+	})
+
+	t.Run("clock synchronization", func(t *testing.T) {
+		if err := c.SendClockSync(10, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if ev, ok := testEvent(t, events).(iec104.ClockSyncEvent); !ok || !ev.Negative {
+			t.Fatalf("expect negative confirmation, got %+v", ev)
+		}
+	})
+
+	t.Run("spontaneous data converted", func(t *testing.T) {
+		station.Send(iec104.NewASDU(iec104.MMeNa1, iec104.CotSpont, 1,
+			iec104.NewInformationObject(100, testElement(t, iec104.MMeNa1, iec104.Normalized(-16384)))))
+		ev, ok := testEvent(t, events).(iec104.MeasuredEvent)
+		if !ok || ev.TypeID != iec104.MMeTf1 || ev.IOA != 1000 || ev.Value != -0.5 || ev.Ts.IsZero() {
+			t.Fatalf("expect the converted measured value with time tag, got %+v", ev)
+		}
+	})
+
+	t.Run("select and execute", func(t *testing.T) {
+		if err := c.SendSingleCommand(10, 2000, true); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []byte{0x81, 0x01} {
+			cmd := <-commands
+			if cmd.COA() != 1 || cmd.Signals[0].Address != 200 || cmd.Signals[0].Raw[0] != want {
+				t.Errorf("downstream receives %X to IOA[%d] of COA[%d], want %X to IOA[200] of COA[1]",
+					cmd.Signals[0].Raw, cmd.Signals[0].Address, cmd.COA(), want)
+			}
+		}
+	})
+
+	t.Run("command with time tag", func(t *testing.T) {
+		if err := c.SendCommand(context.Background(), 10, 2000, iec104.CScTa1, iec104.SinglePoint(true),
+			false); err != nil {
+			t.Fatal(err)
+		}
+		cmd := <-commands
+		if cmd.TypeID() != iec104.CScTa1 || cmd.COA() != 1 || cmd.Signals[0].Address != 200 ||
+			cmd.Signals[0].Raw[0] != 0x01 || len(cmd.Signals[0].Raw) != 8 {
+			t.Errorf("downstream receives TypeID[%X] %X to IOA[%d] of COA[%d], want C_SC_TA_1 01 with time tag to "+
+				"IOA[200] of COA[1]", cmd.TypeID(), cmd.Signals[0].Raw, cmd.Signals[0].Address, cmd.COA())
+		}
+	})
+
+	t.Run("command without answer", func(t *testing.T) {
+		if err := c.SendDoubleCommand(10, 3000, true); err == nil {
+			t.Errorf("the command which the link doesn't answer must be confirmed negatively")
+		}
+		g.mu.Lock()
+		n := len(g.pending)
+		g.mu.Unlock()
+		if n != 0 {
+			t.Errorf("%d commands still pending after the time-out", n)
+		}
+	})
+
+	t.Run("unknown address", func(t *testing.T) {
+		if err := c.SendSingleCommand(10, 4000, true); err == nil {
+			t.Errorf("the command to an address which isn't mapped must be rejected")
+		}
+	})
+}
+
+func TestNewTable(t *testing.T) {
+	_, err := NewTable(
+		Mapping{Link: "a", Downstream: Address{1, 1}, Upstream: Address{10, 1}},
+		Mapping{Link: "b", Downstream: Address{1, 1}, Upstream: Address{10, 1}},
+	)
+	if err == nil {
+		t.Errorf("NewTable() must fail when an upstream address is mapped twice")
+	}
+}
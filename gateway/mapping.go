@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+// Address is the address of an information object: the common address of its station and its information object
+// address.
+type Address struct {
+	COA iec104.COA
+	IOA iec104.IOA
+}
+
+/*
+Mapping maps an information object of a downstream station to its address upstream.
+
+The monitored information is sent upstream by TypeID, which converts the value if it differs from the downstream
+type, for example, MMeTf1 sends a normalized value MMeNa1 as a short floating point number with a CP56Time2a time
+tag. The downstream type is kept if TypeID is zero. The commands to the upstream address are sent downstream with their
+own type, so TypeID is not used by the mappings of commands. Groups are the interrogation groups of the object
+upstream, 1-16 for general and 1-4 for counter interrogation.
+*/
+type Mapping struct {
+	Link       string // name of the downstream link, see Gateway.AddLink
+	Downstream Address
+	Upstream   Address
+	TypeID     iec104.TypeID
+	Groups     []uint8
+}
+
+// inGroup reports whether the object belongs to the interrogation group.
+func (m Mapping) inGroup(group uint8) bool {
+	for _, g := range m.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+type linkAddress struct {
+	link string
+	Address
+}
+
+// Table is the mapping table of a Gateway, the information objects which are not mapped are not exposed upstream.
+type Table struct {
+	down     map[linkAddress]Mapping
+	up       map[Address]Mapping
+	stations map[iec104.COA]bool // upstream common addresses
+}
+
+// NewTable creates the mapping table. Each information object is mapped at most once in either direction.
+func NewTable(mappings ...Mapping) (*Table, error) {
+	t := &Table{
+		down:     make(map[linkAddress]Mapping, len(mappings)),
+		up:       make(map[Address]Mapping, len(mappings)),
+		stations: make(map[iec104.COA]bool),
+	}
+	for _, m := range mappings {
+		key := linkAddress{link: m.Link, Address: m.Downstream}
+		if _, ok := t.down[key]; ok {
+			return nil, fmt.Errorf("IOA[%d] of COA[%d] of link %s is mapped twice", m.Downstream.IOA, m.Downstream.COA, m.Link)
+		}
+		if _, ok := t.up[m.Upstream]; ok {
+			return nil, fmt.Errorf("upstream IOA[%d] of COA[%d] is mapped twice", m.Upstream.IOA, m.Upstream.COA)
+		}
+		t.down[key], t.up[m.Upstream] = m, m
+		t.stations[m.Upstream.COA] = true
+	}
+	return t, nil
+}
+
+// Upstream returns the mapping of the information object of the downstream link.
+func (t *Table) Upstream(link string, coa iec104.COA, ioa iec104.IOA) (Mapping, bool) {
+	m, ok := t.down[linkAddress{link: link, Address: Address{COA: coa, IOA: ioa}}]
+	return m, ok
+}
+
+// Downstream returns the mapping of the upstream information object.
+func (t *Table) Downstream(coa iec104.COA, ioa iec104.IOA) (Mapping, bool) {
+	m, ok := t.up[Address{COA: coa, IOA: ioa}]
+	return m, ok
+}
+
+// HasStation reports whether any information object is mapped to the upstream common address.
+func (t *Table) HasStation(coa iec104.COA) bool {
+	return t.stations[coa]
+}
@@ -0,0 +1,215 @@
+package iec104
+
+import (
+	"sync"
+)
+
+// Handler handles the APDUs received on a connection, c is the connection which can be used to reply.
+type Handler interface {
+	ServeAPDU(c *Client, apdu *APDU) error
+}
+
+// HandlerFunc is an adapter to use an ordinary function as a Handler.
+type HandlerFunc func(c *Client, apdu *APDU) error
+
+func (f HandlerFunc) ServeAPDU(c *Client, apdu *APDU) error {
+	return f(c, apdu)
+}
+
+/*
+Route selects the APDUs passed to a handler of ServeMux. An empty field matches any APDU, and an APDU has to match all
+fields which are not empty:
+  - TypeIDs, COTs and COAs match the type identification, the cause of transmission and the common address;
+  - IOAs matches an APDU with any information object in the range.
+*/
+type Route struct {
+	TypeIDs []TypeID
+	COTs    []COT
+	COAs    []COA
+	IOAs    *IOARange
+}
+
+// IOARange is the range of information object addresses from From to To, both inclusive.
+type IOARange struct {
+	From, To IOA
+}
+
+func (r *IOARange) Contains(ioa IOA) bool {
+	return ioa >= r.From && ioa <= r.To
+}
+
+// Match reports whether the APDU is selected by the route.
+func (r Route) Match(apdu *APDU) bool {
+	if len(r.TypeIDs) > 0 && !containsTypeID(r.TypeIDs, apdu.typeID) {
+		return false
+	}
+	if len(r.COTs) > 0 && !containsCOT(r.COTs, apdu.cot) {
+		return false
+	}
+	if len(r.COAs) > 0 && !containsCOA(r.COAs, apdu.coa) {
+		return false
+	}
+	if r.IOAs != nil {
+		for _, io := range apdu.ios {
+			if r.IOAs.Contains(io.ioa) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsCOT(cots []COT, cot COT) bool {
+	for _, x := range cots {
+		if x == cot {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ServeMux is a Handler which routes the APDUs to the handlers registered for them.
+
+  - The routes are matched in the order of registration, and only the handler of the first matching route is called.
+  - The APDUs matching no route are passed to the default handler, or they are ignored if there is none.
+  - The middlewares wrap every handler, including the default handler, in the order they are added: the first one is
+    the outermost.
+
+For example:
+
+	mux := NewServeMux()
+	mux.Use(Recover, Logging(logger))
+	mux.Handle(MMeNc1, func(c *Client, apdu *APDU) error { ... })
+	mux.HandleRoute(Route{COTs: []COT{CotSpont}, IOAs: &IOARange{From: 1000, To: 1999}}, alarms)
+	mux.HandleDefault(func(c *Client, apdu *APDU) error { ... })
+*/
+type ServeMux struct {
+	mu          sync.RWMutex
+	routes      []muxEntry
+	fallback    Handler
+	middlewares []Middleware
+}
+
+type muxEntry struct {
+	route   Route
+	handler Handler
+}
+
+func NewServeMux() *ServeMux {
+	return new(ServeMux)
+}
+
+// Handle registers the handler for the APDUs with the type identification.
+func (m *ServeMux) Handle(typeID TypeID, handler HandlerFunc) *ServeMux {
+	return m.HandleRoute(Route{TypeIDs: []TypeID{typeID}}, handler)
+}
+
+// HandleRoute registers the handler for the APDUs selected by the route.
+func (m *ServeMux) HandleRoute(route Route, handler Handler) *ServeMux {
+	if handler == nil {
+		panic("iec104: nil handler")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = append(m.routes, muxEntry{route: route, handler: handler})
+	return m
+}
+
+// HandleStation registers the handler for the APDUs of the station with the common address, so that the data of
+// each station behind a gateway is handled separately.
+func (m *ServeMux) HandleStation(coa COA, handler Handler) *ServeMux {
+	return m.HandleRoute(Route{COAs: []COA{coa}}, handler)
+}
+
+// HandleDefault registers the handler for the APDUs which match no route.
+func (m *ServeMux) HandleDefault(handler HandlerFunc) *ServeMux {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = handler
+	return m
+}
+
+// Use adds the middlewares which wrap every handler.
+func (m *ServeMux) Use(middlewares ...Middleware) *ServeMux {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middlewares = append(m.middlewares, middlewares...)
+	return m
+}
+
+// Handler returns the handler of the APDU wrapped by the middlewares, or nil if there is none.
+func (m *ServeMux) Handler(apdu *APDU) Handler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h := m.fallback
+	for _, e := range m.routes {
+		if e.route.Match(apdu) {
+			h = e.handler
+			break
+		}
+	}
+	if h == nil {
+		return nil
+	}
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		h = m.middlewares[i](h)
+	}
+	return h
+}
+
+// ServeAPDU calls the handler of the APDU. The APDU in control direction without handler is rejected with
+// UnknownTypeError by a controlled station.
+func (m *ServeMux) ServeAPDU(c *Client, apdu *APDU) error {
+	h := m.Handler(apdu)
+	if h == nil {
+		_lg.Debugf("no handler for TypeID[%X], COT[%d]", apdu.typeID, apdu.cot)
+		if c != nil && c.srv != nil {
+			return errNoHandler(apdu.ASDU) // the controlled station answers it with COT 44
+		}
+		return nil
+	}
+	return h.ServeAPDU(c, apdu)
+}
+
+// AdaptClientHandler adapts the ClientHandler to a Handler, which calls the method of the ClientHandler for the type
+// identification of the APDU.
+func AdaptClientHandler(h ClientHandler) Handler {
+	return clientHandlerAdapter{h}
+}
+
+type clientHandlerAdapter struct {
+	ClientHandler
+}
+
+func (a clientHandlerAdapter) ServeAPDU(_ *Client, apdu *APDU) error {
+	switch apdu.typeID {
+	case CIcNa1:
+		return a.GeneralInterrogationHandler(apdu)
+	case CCiNa1:
+		return a.CounterInterrogationHandler(apdu)
+	case CRdNa1:
+		return a.ReadCommandHandler(apdu)
+	case CCsNa1:
+		return a.ClockSynchronizationHandler(apdu)
+	case CTsNb1, CTsTa1:
+		return a.TestCommandHandler(apdu)
+	case CRpNc1:
+		return a.ResetProcessCommandHandler(apdu)
+	case CCdNa1:
+		return a.DelayAcquisitionCommandHandler(apdu)
+	default:
+		return a.APDUHandler(apdu)
+	}
+}
+
+// errNoHandler returns the error of the command which a controlled station has no handler for, or nil if the ASDU
+// isn't a command.
+func errNoHandler(asdu *ASDU) error {
+	if !isControlDirection(asdu.typeID) || isResponse(asdu) {
+		return nil
+	}
+	key := pendingKeyOf(asdu)
+	return &UnknownTypeError{NegativeConfirmError{TypeID: key.typeID, COT: CotUnknownType, COA: key.coa, IOA: key.ioa}}
+}
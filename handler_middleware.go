@@ -0,0 +1,96 @@
+package iec104
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware wraps a handler to do something before or after it, for example, logging.
+type Middleware func(next Handler) Handler
+
+// Recover is a middleware which turns a panic of the handler into an error.
+func Recover(next Handler) Handler {
+	return HandlerFunc(func(c *Client, apdu *APDU) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("handler panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		return next.ServeAPDU(c, apdu)
+	})
+}
+
+// Logging returns a middleware which logs every APDU with the time taken by the handler, and the error if it fails.
+func Logging(lg *logrus.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(c *Client, apdu *APDU) error {
+			start := time.Now()
+			err := next.ServeAPDU(c, apdu)
+			entry := lg.WithFields(logrus.Fields{
+				"type":     fmt.Sprintf("%X", apdu.typeID),
+				"cot":      apdu.cot,
+				"coa":      apdu.coa,
+				"objects":  len(apdu.ios),
+				"duration": time.Since(start),
+			})
+			if err != nil {
+				entry.Warnf("handle apdu: %v", err)
+			} else {
+				entry.Debug("handle apdu")
+			}
+			return err
+		})
+	}
+}
+
+// Metrics counts the APDUs handled for each type identification. Its Middleware is added to a ServeMux to collect the
+// metrics, which are then exported by the application.
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[TypeID]HandlerStats
+}
+
+// HandlerStats are the metrics of the APDUs with one type identification.
+type HandlerStats struct {
+	Handled  uint64        // number of handled APDUs
+	Failed   uint64        // number of APDUs whose handler returned an error
+	Duration time.Duration // total time taken by the handler
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{stats: make(map[TypeID]HandlerStats)}
+}
+
+func (m *Metrics) Middleware(next Handler) Handler {
+	return HandlerFunc(func(c *Client, apdu *APDU) error {
+		start := time.Now()
+		err := next.ServeAPDU(c, apdu)
+		duration := time.Since(start)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		stats := m.stats[apdu.typeID]
+		stats.Handled++
+		if err != nil {
+			stats.Failed++
+		}
+		stats.Duration += duration
+		m.stats[apdu.typeID] = stats
+		return err
+	})
+}
+
+// Snapshot returns a copy of the metrics.
+func (m *Metrics) Snapshot() map[TypeID]HandlerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[TypeID]HandlerStats, len(m.stats))
+	for typeID, stats := range m.stats {
+		snapshot[typeID] = stats
+	}
+	return snapshot
+}
@@ -0,0 +1,128 @@
+package iec104
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoute_Match(t *testing.T) {
+	apdu := &APDU{ASDU: NewASDU(MMeNc1, CotSpont, 1,
+		NewInformationObject(100), NewInformationObject(1500))}
+	tests := []struct {
+		name  string
+		route Route
+		want  bool
+	}{
+		{"empty route", Route{}, true},
+		{"type identification", Route{TypeIDs: []TypeID{MMeNa1, MMeNc1}}, true},
+		{"other type identification", Route{TypeIDs: []TypeID{MMeNa1}}, false},
+		{"cause of transmission", Route{COTs: []COT{CotSpont}}, true},
+		{"other cause of transmission", Route{COTs: []COT{CotInrogen}}, false},
+		{"common address", Route{COAs: []COA{1}}, true},
+		{"other common address", Route{COAs: []COA{2}}, false},
+		{"any object in range", Route{IOAs: &IOARange{From: 1000, To: 1999}}, true},
+		{"no object in range", Route{IOAs: &IOARange{From: 200, To: 999}}, false},
+		{"all fields", Route{TypeIDs: []TypeID{MMeNc1}, COTs: []COT{CotSpont}, COAs: []COA{2}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.Match(apdu); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMux(t *testing.T) {
+	var calls []string
+	record := func(name string) HandlerFunc {
+		return func(c *Client, apdu *APDU) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(c *Client, apdu *APDU) error {
+				calls = append(calls, name)
+				return next.ServeAPDU(c, apdu)
+			})
+		}
+	}
+
+	mux := NewServeMux()
+	mux.Handle(MSpNa1, record("single point"))
+	mux.HandleRoute(Route{COTs: []COT{CotSpont}}, record("spontaneous"))
+	tests := []struct {
+		name string
+		apdu *APDU
+		want []string
+	}{
+		{"first matching route", &APDU{ASDU: NewASDU(MSpNa1, CotSpont, 1)}, []string{"single point"}},
+		{"second route", &APDU{ASDU: NewASDU(MMeNc1, CotSpont, 1)}, []string{"spontaneous"}},
+		{"no route without default", &APDU{ASDU: NewASDU(MMeNc1, CotInrogen, 1)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			if err := mux.ServeAPDU(nil, tt.apdu); err != nil {
+				t.Fatal(err)
+			}
+			if len(calls) != len(tt.want) || (len(calls) > 0 && calls[0] != tt.want[0]) {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+
+	t.Run("default with middlewares", func(t *testing.T) {
+		mux.HandleDefault(record("default")).Use(trace("outer"), trace("inner"))
+		calls = nil
+		_ = mux.ServeAPDU(nil, &APDU{ASDU: NewASDU(MMeNc1, CotInrogen, 1)})
+		want := []string{"outer", "inner", "default"}
+		if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] || calls[2] != want[2] {
+			t.Errorf("calls = %v, want %v", calls, want)
+		}
+	})
+}
+
+func TestRecover(t *testing.T) {
+	h := Recover(HandlerFunc(func(c *Client, apdu *APDU) error {
+		panic("boom")
+	}))
+	if err := h.ServeAPDU(nil, &APDU{ASDU: NewASDU(MSpNa1, CotSpont, 1)}); err == nil {
+		t.Errorf("ServeAPDU() = nil, want the panic as error")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	errFailed := errors.New("failed")
+	h := m.Middleware(HandlerFunc(func(c *Client, apdu *APDU) error {
+		if apdu.cot == CotSpont {
+			return errFailed
+		}
+		return nil
+	}))
+	_ = h.ServeAPDU(nil, &APDU{ASDU: NewASDU(MSpNa1, CotSpont, 1)})
+	_ = h.ServeAPDU(nil, &APDU{ASDU: NewASDU(MSpNa1, CotInrogen, 1)})
+	_ = h.ServeAPDU(nil, &APDU{ASDU: NewASDU(MMeNc1, CotInrogen, 1)})
+
+	snapshot := m.Snapshot()
+	if got := snapshot[MSpNa1]; got.Handled != 2 || got.Failed != 1 {
+		t.Errorf("metrics of M_SP_NA_1 = %+v, want 2 handled and 1 failed", got)
+	}
+	if got := snapshot[MMeNc1]; got.Handled != 1 || got.Failed != 0 {
+		t.Errorf("metrics of M_ME_NC_1 = %+v, want 1 handled", got)
+	}
+}
+
+func TestAdaptClientHandler(t *testing.T) {
+	h := testHandler{apdus: make(chan *APDU, 1)}
+	apdu := &APDU{ASDU: NewASDU(CIcNa1, CotActCon, 1)}
+	if err := AdaptClientHandler(h).ServeAPDU(nil, apdu); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-h.apdus; got != apdu {
+		t.Errorf("the APDU is not passed to the ClientHandler")
+	}
+}
@@ -0,0 +1,185 @@
+package iec101
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+// ErrServed is returned by Serve if the station is served more than once.
+var ErrServed = errors.New("iec101: balanced station already served")
+
+/*
+Balanced is a station of balanced transmission, which is the primary station of the frames it sends and the secondary
+station of the frames sent by the other station. The controlling station sets DIR, the controlled station doesn't.
+Serve must be running for the transactions of the primary station, since it dispatches their responses, and it's
+called only once.
+*/
+type Balanced struct {
+	*link
+	address uint16
+	dir     bool
+
+	mu        sync.Mutex // one transaction at a time
+	fcb       bool
+	responses chan *Frame // responses of the other station, closed when Serve stops
+	requests  chan *Frame // requests of the other station
+	state     secondary
+	served    int32 // set by the first Serve
+}
+
+func NewBalanced(rw io.ReadWriter, cfg Config, address uint16, controlling bool) *Balanced {
+	return &Balanced{
+		link:      newLink(rw, cfg.defaults()),
+		address:   address,
+		dir:       controlling,
+		responses: make(chan *Frame, 1),
+		requests:  make(chan *Frame, 16),
+	}
+}
+
+// request sends the request to the other station and returns its response.
+func (b *Balanced) request(ctx context.Context, function Function, fcv bool, asdu []byte) (*Frame, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	req := &Frame{DIR: b.dir, PRM: true, FCV: fcv, FCB: fcv && b.fcb, Function: function, Address: b.address,
+		ASDU: asdu}
+	rsp, err := b.transact(ctx, b.responses, req, func(f *Frame) bool {
+		return f.Single || f.Address == b.address
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fcv {
+		b.fcb = !req.FCB
+	}
+	if rsp.Function == FuncNack && !rsp.Single {
+		return nil, fmt.Errorf("iec101: function %d not accepted by link address %d", function, b.address)
+	}
+	return rsp, nil
+}
+
+// ResetLink resets the link of the other station, which is required before the frames with FCV are accepted.
+func (b *Balanced) ResetLink(ctx context.Context) error {
+	if _, err := b.request(ctx, FuncResetLink, false, nil); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.fcb = true // the first frame with FCV after the reset has FCB set
+	b.mu.Unlock()
+	return nil
+}
+
+// TestLink tests the link to the other station.
+func (b *Balanced) TestLink(ctx context.Context) error {
+	_, err := b.request(ctx, FuncTestLink, true, nil)
+	return err
+}
+
+// Send sends the ASDU to the other station and waits for the acknowledgement.
+func (b *Balanced) Send(ctx context.Context, asdu *iec104.ASDU) error {
+	data, err := b.userData(asdu)
+	if err != nil {
+		return err
+	}
+	_, err = b.request(ctx, FuncUserDataConfirm, true, data)
+	return err
+}
+
+/*
+Serve answers the requests of the other station and dispatches the responses to the requests of this station until
+ctx is done or the link is closed. The ASDUs sent by the other station are passed to the handler, which may send ASDUs
+itself, and they are acknowledged negatively if the handler fails. The requests are answered by NACK (link busy)
+while the handler is stalled and the requests waiting for it are queued up. The transactions fail once Serve stops,
+and Serve returns ErrServed if it's called again.
+*/
+func (b *Balanced) Serve(ctx context.Context, handler Handler) error {
+	if !atomic.CompareAndSwapInt32(&b.served, 0, 1) {
+		return ErrServed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- b.answering(ctx, handler)
+	}()
+
+	defer close(b.responses)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case f, ok := <-b.frames:
+			if !ok {
+				return b.closed()
+			}
+			switch {
+			case f.Single || !f.PRM:
+				select {
+				case b.responses <- f:
+				default: // no transaction waits for it
+				}
+			case f.DIR != b.dir && f.Address == b.address:
+				select {
+				case b.requests <- f:
+				default: // the handler is stalled, the other station repeats the request
+					if f.Function != FuncUserDataNoReply {
+						if err := b.write(&Frame{DIR: b.dir, Function: FuncNack, Address: b.address}); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// answering answers the requests of the other station.
+func (b *Balanced) answering(ctx context.Context, handler Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case f := <-b.requests:
+			if rsp := b.respond(f, handler); rsp != nil {
+				if err := b.write(rsp); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// respond processes the request and returns its response, or nil if the request isn't answered.
+func (b *Balanced) respond(f *Frame, handler Handler) *Frame {
+	if rsp, ok := b.state.repeated(f); ok {
+		return rsp
+	}
+	rsp := &Frame{DIR: b.dir, Function: FuncAck, Address: b.address}
+	switch f.Function {
+	case FuncResetLink:
+		b.state.reset()
+	case FuncTestLink:
+	case FuncRequestStatus:
+		rsp.Function = FuncStatus
+	case FuncUserDataConfirm, FuncUserDataNoReply:
+		err := b.handleUserData(f, handler)
+		if f.Function == FuncUserDataNoReply {
+			return nil
+		}
+		if err != nil {
+			rsp.Function = FuncNack
+		}
+	default:
+		rsp.Function = FuncNack
+	}
+	b.state.accept(f, rsp)
+	return rsp
+}
@@ -0,0 +1,197 @@
+/*
+Package iec101 implements the link layer of IEC 60870-5-101 (aka IEC 101), the frame format FT1.2 of IEC 60870-5-1
+with the link transmission procedures of IEC 60870-5-2, over any io.ReadWriter such as a serial port.
+
+The user data of the frames are the ASDUs of package iec104, so the same codec serves both protocols:
+  - Master and Slave are the primary and the secondary station of unbalanced transmission, where the master polls the
+    user data of class 1 and class 2 from the slaves;
+  - Balanced is a station of balanced transmission, where both stations are primary and secondary at the same time.
+
+FT1.2 frames:
+
+	  fixed length      variable length           single character
+	| 0x10      |     | 0x68             |      | 0xE5 |
+	| C         |     | L                |
+	| A         |     | L                |
+	| CS        |     | 0x68             |
+	| 0x16      |     | C                |
+	                  | A                |
+	                  | ASDU             |
+	                  | CS               |
+	                  | 0x16             |
+
+L is the length of C, A and the ASDU, A is the link address of 0, 1 or 2 bytes, and CS is the arithmetic sum of C, A
+and the ASDU modulo 256.
+*/
+package iec101
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	startFixed    = 0x10
+	startVariable = 0x68
+	stopByte      = 0x16
+	singleACK     = 0xe5 // single character which acknowledges, or answers no data is available
+
+	maxFrameLen = 255 // maximum of L
+)
+
+// Function is the function code of the control field.
+type Function byte
+
+const (
+	// function codes of the primary station
+	FuncResetLink       Function = 0  // reset of remote link
+	FuncResetProcess    Function = 1  // reset of user process
+	FuncTestLink        Function = 2  // test function for link, balanced transmission only
+	FuncUserDataConfirm Function = 3  // user data, confirmed
+	FuncUserDataNoReply Function = 4  // user data, unconfirmed
+	FuncRequestStatus   Function = 9  // request status of link
+	FuncRequestClass1   Function = 10 // request user data class 1, unbalanced transmission only
+	FuncRequestClass2   Function = 11 // request user data class 2, unbalanced transmission only
+
+	// function codes of the secondary station
+	FuncAck      Function = 0  // positive acknowledgement
+	FuncNack     Function = 1  // message not accepted, link busy
+	FuncUserData Function = 8  // user data responding a request
+	FuncNoData   Function = 9  // requested data not available
+	FuncStatus   Function = 11 // status of link or access demand
+)
+
+/*
+Frame is a frame of FT1.2. The control field is:
+
+	| RES/DIR | PRM | FCB/ACD | FCV/DFC | Function |
+	| 1 bit   | 1   | 1       | 1       | 4 bits   |
+
+The meaning of the bits 5 and 4 depends on PRM: FCB and FCV of a frame from the primary station, ACD and DFC of a frame
+from the secondary station.
+*/
+type Frame struct {
+	DIR      bool // direction of balanced transmission: set by the controlling station
+	PRM      bool // the frame is from the primary station
+	FCB      bool // frame count bit of the primary station, or ACD (access demand) of the secondary station
+	FCV      bool // frame count bit valid of the primary station, or DFC (data flow control) of the secondary station
+	Function Function
+	Address  uint16
+	ASDU     []byte // user data of a frame of variable length, nil for a frame of fixed length
+	Single   bool   // the frame is the single character 0xE5
+}
+
+// ACD reports whether the secondary station has user data of class 1 available.
+func (f *Frame) ACD() bool { return !f.PRM && f.FCB }
+
+// DFC reports whether further messages may cause an overflow of the secondary station.
+func (f *Frame) DFC() bool { return !f.PRM && f.FCV }
+
+func (f *Frame) control() byte {
+	c := byte(f.Function & 0x0f)
+	for bit, set := range []bool{f.FCV, f.FCB, f.PRM, f.DIR} {
+		if set {
+			c |= 1 << (4 + bit)
+		}
+	}
+	return c
+}
+
+func (f *Frame) setControl(c byte) {
+	f.Function = Function(c & 0x0f)
+	f.FCV = c&0x10 != 0
+	f.FCB = c&0x20 != 0
+	f.PRM = c&0x40 != 0
+	f.DIR = c&0x80 != 0
+}
+
+// encode serializes the frame with the link address of addressSize bytes.
+func (f *Frame) encode(addressSize int) []byte {
+	if f.Single {
+		return []byte{singleACK}
+	}
+	body := make([]byte, 0, 1+addressSize+len(f.ASDU))
+	body = append(body, f.control())
+	for i := 0; i < addressSize; i++ {
+		body = append(body, byte(f.Address>>(8*i)))
+	}
+	body = append(body, f.ASDU...)
+
+	var data []byte
+	if f.ASDU == nil {
+		data = append([]byte{startFixed}, body...)
+	} else {
+		data = append([]byte{startVariable, byte(len(body)), byte(len(body)), startVariable}, body...)
+	}
+	return append(data, checksum(body), stopByte)
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+var (
+	errChecksum = errors.New("iec101: checksum error")
+	errFraming  = errors.New("iec101: framing error")
+)
+
+// readFrame reads the next frame. It fails with errFraming or errChecksum if the frame is corrupted, the reader is
+// then positioned after the corrupted frame.
+func readFrame(r *bufio.Reader, addressSize int) (*Frame, error) {
+	start, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	switch start {
+	case singleACK:
+		return &Frame{Function: FuncAck, Single: true}, nil
+	case startFixed:
+		body = make([]byte, 1+addressSize)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+	case startVariable:
+		header := make([]byte, 3)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		n := int(header[0])
+		if header[1] != header[0] || header[2] != startVariable || n < 1+addressSize {
+			return nil, fmt.Errorf("%w: invalid header % X", errFraming, header)
+		}
+		body = make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: invalid start character %X", errFraming, start)
+	}
+
+	trailer := make([]byte, 2)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return nil, err
+	}
+	if trailer[1] != stopByte {
+		return nil, fmt.Errorf("%w: invalid stop character %X", errFraming, trailer[1])
+	}
+	if trailer[0] != checksum(body) {
+		return nil, errChecksum
+	}
+
+	f := new(Frame)
+	f.setControl(body[0])
+	for i := 0; i < addressSize; i++ {
+		f.Address |= uint16(body[1+i]) << (8 * i)
+	}
+	if start == startVariable {
+		f.ASDU = body[1+addressSize:]
+	}
+	return f, nil
+}
@@ -0,0 +1,63 @@
+package iec101
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFrame_encode(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       Frame
+		addressSize int
+		want        []byte
+	}{
+		{"single character", Frame{Single: true, Function: FuncAck}, 1, []byte{0xe5}},
+		{"reset link", Frame{PRM: true, Function: FuncResetLink, Address: 1}, 1,
+			[]byte{0x10, 0x40, 0x01, 0x41, 0x16}},
+		{"request class 1 with fcb", Frame{PRM: true, FCB: true, FCV: true, Function: FuncRequestClass1,
+			Address: 0x0102}, 2, []byte{0x10, 0x7a, 0x02, 0x01, 0x7d, 0x16}},
+		{"user data", Frame{Function: FuncUserData, FCB: true, Address: 3, ASDU: []byte{0x01, 0x02}}, 1,
+			[]byte{0x68, 0x04, 0x04, 0x68, 0x28, 0x03, 0x01, 0x02, 0x2e, 0x16}},
+		{"balanced with dir", Frame{DIR: true, PRM: true, FCV: true, Function: FuncTestLink, Address: 1}, 1,
+			[]byte{0x10, 0xd2, 0x01, 0xd3, 0x16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.frame.encode(tt.addressSize)
+			if !bytes.Equal(data, tt.want) {
+				t.Fatalf("encode() = % X, want % X", data, tt.want)
+			}
+			got, err := readFrame(bufio.NewReader(bytes.NewReader(data)), tt.addressSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.frame) {
+				t.Errorf("readFrame() = %+v, want %+v", *got, tt.frame)
+			}
+		})
+	}
+}
+
+func Test_readFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"checksum", []byte{0x10, 0x40, 0x01, 0x42, 0x16}, errChecksum},
+		{"stop character", []byte{0x10, 0x40, 0x01, 0x41, 0x17}, errFraming},
+		{"length mismatch", []byte{0x68, 0x04, 0x05, 0x68}, errFraming},
+		{"start character", []byte{0x11}, errFraming},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readFrame(bufio.NewReader(bytes.NewReader(tt.data)), 1); !errors.Is(err, tt.want) {
+				t.Errorf("readFrame() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
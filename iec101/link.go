@@ -0,0 +1,204 @@
+package iec101
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+const (
+	DefaultAddressSize = 1
+	DefaultTimeout     = time.Second // time to wait for the response of the secondary station
+	DefaultRetries     = 3           // retransmissions of a frame which isn't answered in time
+)
+
+var (
+	ErrClosed     = errors.New("iec101: link closed")
+	errNoResponse = errors.New("iec101: no response")
+)
+
+// Config is the configuration of the link layer, the zero fields are set to the default values.
+type Config struct {
+	AddressSize int // size of the link address: 1 or 2 bytes
+	Timeout     time.Duration
+	Retries     int
+	Profile     Profile // length of the fields of the ASDU, DefaultProfile if it's invalid
+}
+
+func (c Config) defaults() Config {
+	if c.AddressSize <= 0 || c.AddressSize > 2 {
+		c.AddressSize = DefaultAddressSize
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Retries <= 0 {
+		c.Retries = DefaultRetries
+	}
+	if !c.Profile.valid() {
+		c.Profile = DefaultProfile
+	}
+	return c
+}
+
+// link reads the frames from the ReadWriter in its own goroutine, so that the primary station waits for the response
+// of a request with a timeout on any ReadWriter.
+type link struct {
+	Config
+	rw     io.ReadWriter
+	wMutex sync.Mutex
+	frames chan *Frame // closed when reading fails
+	err    error       // the error which stops reading, set before frames is closed
+}
+
+func newLink(rw io.ReadWriter, cfg Config) *link {
+	l := &link{Config: cfg, rw: rw, frames: make(chan *Frame, 16)}
+	go l.reading()
+	return l
+}
+
+func (l *link) reading() {
+	defer close(l.frames)
+	r := bufio.NewReader(l.rw)
+	for {
+		f, err := readFrame(r, l.AddressSize)
+		if errors.Is(err, errFraming) || errors.Is(err, errChecksum) {
+			continue // the frame is discarded, and the primary station retransmits it after its timeout
+		}
+		if err != nil {
+			l.err = err
+			return
+		}
+		l.frames <- f
+	}
+}
+
+func (l *link) write(f *Frame) error {
+	l.wMutex.Lock()
+	defer l.wMutex.Unlock()
+	_, err := l.rw.Write(f.encode(l.AddressSize))
+	return err
+}
+
+// closed returns the error which stops reading.
+func (l *link) closed() error {
+	if l.err == nil || errors.Is(l.err, io.EOF) {
+		return ErrClosed
+	}
+	return fmt.Errorf("%w: %v", ErrClosed, l.err)
+}
+
+// Close closes the ReadWriter if it's an io.Closer, which stops reading.
+func (l *link) Close() error {
+	if c, ok := l.rw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// transact sends the request of the primary station and waits for the response read from responses, retransmitting
+// the request if it isn't answered within the timeout. accept selects the response from the frames received.
+func (l *link) transact(ctx context.Context, responses <-chan *Frame, req *Frame, accept func(*Frame) bool) (
+	*Frame, error) {
+	for attempt := 0; attempt <= l.Retries; attempt++ {
+		if err := l.write(req); err != nil {
+			return nil, err
+		}
+		timer := time.NewTimer(l.Timeout)
+	waiting:
+		for {
+			select {
+			case f, ok := <-responses:
+				if !ok {
+					timer.Stop()
+					return nil, l.closed()
+				}
+				if accept(f) {
+					timer.Stop()
+					return f, nil
+				}
+			case <-timer.C:
+				break waiting
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w to function %d of link address %d after %d retries", errNoResponse, req.Function,
+		req.Address, l.Retries)
+}
+
+// secondary is the state of the secondary station to detect the retransmissions of the primary station.
+type secondary struct {
+	valid bool // a frame with FCV is received after the link is reset
+	fcb   bool // FCB of the latest frame with FCV
+	last  *Frame
+}
+
+// repeated returns the latest response if the frame is the retransmission of the latest frame with FCV, whose
+// response is lost.
+func (s *secondary) repeated(f *Frame) (*Frame, bool) {
+	if !f.FCV || !s.valid || f.FCB != s.fcb || s.last == nil {
+		return nil, false
+	}
+	return s.last, true
+}
+
+// accept records the frame with FCV and its response.
+func (s *secondary) accept(f, rsp *Frame) {
+	if f.FCV {
+		s.valid, s.fcb, s.last = true, f.FCB, rsp
+	}
+}
+
+func (s *secondary) reset() {
+	*s = secondary{}
+}
+
+// parseASDU parses the user data of the frame, which is widened from the profile.
+func (l *link) parseASDU(f *Frame) (asdu *iec104.ASDU, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			asdu, err = nil, fmt.Errorf("iec101: invalid asdu % X: %v", f.ASDU, r)
+		}
+	}()
+	data, err := l.Profile.Widen(f.ASDU)
+	if err != nil {
+		return nil, err
+	}
+	asdu = new(iec104.ASDU)
+	if err := asdu.Parse(data); err != nil {
+		return nil, err
+	}
+	return asdu, nil
+}
+
+// userData returns the ASDU as the user data of a frame, which is narrowed to the profile.
+func (l *link) userData(asdu *iec104.ASDU) ([]byte, error) {
+	return l.Profile.Narrow(asdu.Data())
+}
+
+// Handler handles the ASDU received from the primary station.
+type Handler func(asdu *iec104.ASDU) error
+
+// handleUserData passes the user data of the frame to the handler.
+func (l *link) handleUserData(f *Frame, handler Handler) error {
+	if f.ASDU == nil {
+		return fmt.Errorf("iec101: no user data in function %d", f.Function)
+	}
+	asdu, err := l.parseASDU(f)
+	if err != nil {
+		return err
+	}
+	if handler == nil {
+		return nil
+	}
+	return handler(asdu)
+}
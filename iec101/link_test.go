@@ -0,0 +1,188 @@
+package iec101
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+func testASDU(t *testing.T, ioa iec104.IOA, value float64) *iec104.ASDU {
+	t.Helper()
+	ie, err := iec104.NewInformationElement(iec104.MMeNc1, iec104.Float(value), 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iec104.NewASDU(iec104.MMeNc1, iec104.CotSpont, 1, iec104.NewInformationObject(ioa, ie))
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestMaster(t *testing.T) {
+	a, b := net.Pipe()
+	cfg := Config{Timeout: 100 * time.Millisecond}
+	m := NewMaster(a, cfg)
+	s := NewSlave(b, cfg, 3)
+	defer m.Close()
+	defer s.Close()
+
+	received := make(chan *iec104.ASDU, 1)
+	ctx := testContext(t)
+	go func() {
+		_ = s.Serve(ctx, func(asdu *iec104.ASDU) error {
+			received <- asdu
+			return nil
+		})
+	}()
+
+	if err := m.ResetLink(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.RequestStatus(ctx, 4); err == nil {
+		t.Errorf("RequestStatus() to a missing slave must fail")
+	}
+
+	t.Run("send", func(t *testing.T) {
+		if err := m.Send(ctx, 3, testASDU(t, 100, 1.5)); err != nil {
+			t.Fatal(err)
+		}
+		if asdu := <-received; asdu.TypeID() != iec104.MMeNc1 || asdu.Signals[0].Address != 100 {
+			t.Errorf("the slave receives %+v", asdu)
+		}
+	})
+
+	t.Run("poll", func(t *testing.T) {
+		if err := s.Enqueue(Class2, testASDU(t, 200, 2)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Enqueue(Class1, testASDU(t, 100, 1)); err != nil {
+			t.Fatal(err)
+		}
+		asdu, acd, err := m.Poll(ctx, 3, Class2)
+		if err != nil || asdu == nil || asdu.Signals[0].Address != 200 || !acd {
+			t.Fatalf("Poll(Class2) = %+v, %v, %v, want IOA 200 with ACD", asdu, acd, err)
+		}
+		asdu, acd, err = m.Poll(ctx, 3, Class1)
+		if err != nil || asdu == nil || asdu.Signals[0].Value != 1 || acd {
+			t.Fatalf("Poll(Class1) = %+v, %v, %v, want IOA 100 without ACD", asdu, acd, err)
+		}
+		if asdu, _, err = m.Poll(ctx, 3, Class1); err != nil || asdu != nil {
+			t.Errorf("Poll() without data = %+v, %v", asdu, err)
+		}
+	})
+}
+
+func TestSlave_repeated(t *testing.T) {
+	s := &Slave{link: &link{Config: Config{}.defaults()}, address: 1}
+	for _, asdu := range []*iec104.ASDU{testASDU(t, 100, 1), testASDU(t, 101, 2)} {
+		if err := s.Enqueue(Class1, asdu); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := &Frame{PRM: true, FCV: true, FCB: true, Function: FuncRequestClass1, Address: 1}
+	first := s.respond(req, nil)
+	if again := s.respond(req, nil); again != first {
+		t.Errorf("the retransmission must be answered by the same response")
+	}
+	req = &Frame{PRM: true, FCV: true, FCB: false, Function: FuncRequestClass1, Address: 1}
+	next := s.respond(req, nil)
+	if next == first || next.Function != FuncUserData || len(s.class1) != 0 {
+		t.Errorf("the next frame must be answered with the next data, got %+v", next)
+	}
+
+	s.respond(&Frame{PRM: true, Function: FuncResetLink, Address: 1}, nil)
+	if rsp := s.respond(req, nil); rsp == next || rsp.Function != FuncNoData {
+		t.Errorf("the frame after reset must not be a retransmission, got %+v", rsp)
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	a, b := net.Pipe()
+	cfg := Config{Timeout: 100 * time.Millisecond}
+	controlling := NewBalanced(a, cfg, 1, true)
+	controlled := NewBalanced(b, cfg, 1, false)
+	defer controlling.Close()
+	defer controlled.Close()
+
+	ctx := testContext(t)
+	up, down := make(chan *iec104.ASDU, 1), make(chan *iec104.ASDU, 1)
+	go func() {
+		_ = controlling.Serve(ctx, func(asdu *iec104.ASDU) error {
+			up <- asdu
+			return nil
+		})
+	}()
+	go func() {
+		_ = controlled.Serve(ctx, func(asdu *iec104.ASDU) error {
+			down <- asdu
+			return controlled.Send(ctx, asdu.Mirror(iec104.CotActCon, false)) // answers within the handler
+		})
+	}()
+
+	for _, station := range []*Balanced{controlling, controlled} {
+		if err := station.ResetLink(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := station.TestLink(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := controlling.Send(ctx, testASDU(t, 100, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if asdu := <-down; asdu.Signals[0].Address != 100 {
+		t.Errorf("the controlled station receives %+v", asdu)
+	}
+	if asdu := <-up; asdu.COT() != iec104.CotActCon {
+		t.Errorf("the controlling station receives %+v", asdu)
+	}
+	if err := controlling.Serve(ctx, nil); !errors.Is(err, ErrServed) {
+		t.Errorf("serve again: %v, want %v", err, ErrServed)
+	}
+}
+
+func TestBalanced_busy(t *testing.T) {
+	a, b := net.Pipe()
+	cfg := Config{Timeout: 100 * time.Millisecond}
+	controlled := NewBalanced(b, cfg, 1, false)
+	defer controlled.Close()
+	defer a.Close()
+
+	ctx := testContext(t)
+	stalled := make(chan struct{})
+	defer close(stalled)
+	go func() {
+		_ = controlled.Serve(ctx, func(asdu *iec104.ASDU) error {
+			<-stalled
+			return nil
+		})
+	}()
+
+	data, err := controlled.userData(testASDU(t, 100, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { // the handler stalls on the user data, and the test functions are queued up
+		_, _ = a.Write((&Frame{DIR: true, PRM: true, Function: FuncUserDataConfirm, Address: 1, ASDU: data}).encode(1))
+		for i := 0; i <= cap(controlled.requests); i++ {
+			_, _ = a.Write((&Frame{DIR: true, PRM: true, Function: FuncTestLink, Address: 1}).encode(1))
+		}
+	}()
+	_ = a.SetReadDeadline(time.Now().Add(time.Second))
+	f, err := readFrame(bufio.NewReader(a), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Function != FuncNack || f.PRM {
+		t.Errorf("expect NACK while the handler is stalled, got %+v", f)
+	}
+}
@@ -0,0 +1,109 @@
+package iec101
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+var (
+	ErrCommonAddress = errors.New("iec101: common address out of range of the profile")
+	ErrObjectAddress = errors.New("iec101: information object address out of range of the profile")
+)
+
+/*
+Profile is the length of the fields of the data unit identifier and of the information object address, which are
+system parameters of IEC 101, while IEC 104 fixes them to 2 bytes of COT (with ORG), 2 bytes of COA and 3 bytes of IOA.
+
+The ASDUs received are widened to the layout of IEC 104 before they are parsed by iec104.ASDU, and the ASDUs sent are
+narrowed from it, so the ORG of a profile with 1-byte COT is lost and the addresses must fit in the fields.
+*/
+type Profile struct {
+	COTSize int // 1 or 2 bytes
+	COASize int // 1 or 2 bytes
+	IOASize int // 1, 2 or 3 bytes
+}
+
+// DefaultProfile is the usual profile of IEC 101: 1-byte COT, 1-byte COA and 2-byte IOA.
+var DefaultProfile = Profile{COTSize: 1, COASize: 1, IOASize: 2}
+
+// iec104Profile is the layout of iec104.ASDU.
+var iec104Profile = Profile{COTSize: 2, COASize: 2, IOASize: iec104.IOALength}
+
+func (p Profile) valid() bool {
+	return p.COTSize >= 1 && p.COTSize <= 2 && p.COASize >= 1 && p.COASize <= 2 && p.IOASize >= 1 && p.IOASize <= 3
+}
+
+func (p Profile) headerLen() int { return 2 + p.COTSize + p.COASize }
+
+// Widen converts the ASDU of the profile to the layout of IEC 104.
+func (p Profile) Widen(data []byte) ([]byte, error) {
+	return convert(data, p, iec104Profile)
+}
+
+// Narrow converts the ASDU of the layout of IEC 104 to the profile, it fails with ErrCommonAddress or ErrObjectAddress
+// if an address doesn't fit in the profile.
+func (p Profile) Narrow(data []byte) ([]byte, error) {
+	return convert(data, iec104Profile, p)
+}
+
+// convert converts the ASDU from a profile to another. The information elements are kept as they are: the length of
+// each information object is derived from the length of the ASDU and the number of objects.
+func convert(data []byte, from, to Profile) ([]byte, error) {
+	if len(data) < from.headerLen() {
+		return nil, fmt.Errorf("iec101: invalid asdu header % X", data)
+	}
+	out := make([]byte, 0, len(data)+to.headerLen()-from.headerLen())
+	out = append(out, data[0], data[1], data[2])
+	if to.COTSize == 2 {
+		org := byte(0)
+		if from.COTSize == 2 {
+			org = data[3]
+		}
+		out = append(out, org)
+	}
+	coa, err := field(data[2+from.COTSize:from.headerLen()], to.COASize, ErrCommonAddress)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, coa...)
+
+	body := data[from.headerLen():]
+	n, sq := int(data[1]&0x7f), data[1]&0x80 != 0
+	if n == 0 {
+		return append(out, body...), nil
+	}
+	objects, size := n, len(body)/n
+	if sq {
+		objects, size = 1, len(body) // only the first element has its address
+	}
+	if size < from.IOASize || len(body) != objects*size {
+		return nil, fmt.Errorf("iec101: invalid information objects of asdu % X", data)
+	}
+	for i := 0; i < objects; i++ {
+		object := body[i*size : (i+1)*size]
+		ioa, err := field(object[:from.IOASize], to.IOASize, ErrObjectAddress)
+		if err != nil {
+			return nil, err
+		}
+		out = append(append(out, ioa...), object[from.IOASize:]...)
+	}
+	return out, nil
+}
+
+// field converts the little-endian field to size bytes, it fails with errRange if the value doesn't fit.
+func field(data []byte, size int, errRange error) ([]byte, error) {
+	var value uint32
+	for i, b := range data {
+		value |= uint32(b) << (8 * i)
+	}
+	if size < 4 && value >= 1<<(8*size) {
+		return nil, fmt.Errorf("%w: %d in %d bytes", errRange, value, size)
+	}
+	out := make([]byte, size)
+	for i := range out {
+		out[i] = byte(value >> (8 * i))
+	}
+	return out, nil
+}
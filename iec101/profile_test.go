@@ -0,0 +1,62 @@
+package iec101
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		data    []byte // ASDU of the profile
+		wide    []byte // ASDU of IEC 104
+	}{
+		{"single object", DefaultProfile,
+			[]byte{0x01, 0x01, 0x03, 0x05, 0x10, 0x00, 0x01},
+			[]byte{0x01, 0x01, 0x03, 0x00, 0x05, 0x00, 0x10, 0x00, 0x00, 0x01}},
+		{"objects", DefaultProfile,
+			[]byte{0x01, 0x02, 0x14, 0x05, 0x10, 0x00, 0x01, 0x11, 0x00, 0x00},
+			[]byte{0x01, 0x02, 0x14, 0x00, 0x05, 0x00, 0x10, 0x00, 0x00, 0x01, 0x11, 0x00, 0x00, 0x00}},
+		{"sequence", DefaultProfile,
+			[]byte{0x01, 0x82, 0x14, 0x05, 0x10, 0x00, 0x01, 0x00},
+			[]byte{0x01, 0x82, 0x14, 0x00, 0x05, 0x00, 0x10, 0x00, 0x00, 0x01, 0x00}},
+		{"no object", DefaultProfile,
+			[]byte{0x64, 0x00, 0x06, 0x05},
+			[]byte{0x64, 0x00, 0x06, 0x00, 0x05, 0x00}},
+		{"originator and 2-byte common address", Profile{COTSize: 2, COASize: 2, IOASize: 1},
+			[]byte{0x01, 0x01, 0x03, 0x07, 0x05, 0x01, 0x10, 0x01},
+			[]byte{0x01, 0x01, 0x03, 0x07, 0x05, 0x01, 0x10, 0x00, 0x00, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wide, err := tt.profile.Widen(tt.data)
+			if err != nil || !bytes.Equal(wide, tt.wide) {
+				t.Fatalf("Widen() = % X, %v, want % X", wide, err, tt.wide)
+			}
+			data, err := tt.profile.Narrow(wide)
+			if err != nil || !bytes.Equal(data, tt.data) {
+				t.Errorf("Narrow() = % X, %v, want % X", data, err, tt.data)
+			}
+		})
+	}
+}
+
+func TestProfile_Narrow(t *testing.T) {
+	tests := []struct {
+		name string
+		wide []byte
+		want error
+	}{
+		{"common address", []byte{0x01, 0x01, 0x03, 0x00, 0x00, 0x01, 0x10, 0x00, 0x00, 0x01}, ErrCommonAddress},
+		{"object address", []byte{0x01, 0x01, 0x03, 0x00, 0x05, 0x00, 0x10, 0x00, 0x01, 0x01}, ErrObjectAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DefaultProfile.Narrow(tt.wide); !errors.Is(err, tt.want) {
+				t.Errorf("Narrow() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package iec101
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/github-of-lyj/iec104"
+)
+
+/*
+Master is the primary station of unbalanced transmission, which controls the link: the slaves only answer its
+requests. The slaves are addressed by their link addresses, and the transactions are performed one after another.
+*/
+type Master struct {
+	*link
+	mu  sync.Mutex      // one transaction at a time
+	fcb map[uint16]bool // FCB of the next frame with FCV to each slave
+}
+
+func NewMaster(rw io.ReadWriter, cfg Config) *Master {
+	return &Master{link: newLink(rw, cfg.defaults()), fcb: make(map[uint16]bool)}
+}
+
+// request sends the request to the slave and returns its response. FCB is toggled after each transaction with FCV,
+// and kept if the request has to be retransmitted.
+func (m *Master) request(ctx context.Context, address uint16, function Function, fcv bool, asdu []byte) (*Frame,
+	error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req := &Frame{PRM: true, FCV: fcv, Function: function, Address: address, ASDU: asdu}
+	if fcv {
+		req.FCB = m.fcb[address]
+	}
+	rsp, err := m.transact(ctx, m.frames, req, func(f *Frame) bool {
+		return f.Single || (!f.PRM && f.Address == address)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fcv {
+		m.fcb[address] = !req.FCB
+	}
+	if rsp.Function == FuncNack && !rsp.Single {
+		return nil, fmt.Errorf("iec101: function %d not accepted by link address %d", function, address)
+	}
+	return rsp, nil
+}
+
+// ResetLink resets the link of the slave, which is required before the frames with FCV are accepted.
+func (m *Master) ResetLink(ctx context.Context, address uint16) error {
+	if _, err := m.request(ctx, address, FuncResetLink, false, nil); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.fcb[address] = true // the first frame with FCV after the reset has FCB set
+	m.mu.Unlock()
+	return nil
+}
+
+// RequestStatus requests the status of the link of the slave, the response tells whether the slave has data of class
+// 1 (ACD) and whether it's busy (DFC).
+func (m *Master) RequestStatus(ctx context.Context, address uint16) (*Frame, error) {
+	return m.request(ctx, address, FuncRequestStatus, false, nil)
+}
+
+// Send sends the ASDU to the slave and waits for the acknowledgement.
+func (m *Master) Send(ctx context.Context, address uint16, asdu *iec104.ASDU) error {
+	data, err := m.userData(asdu)
+	if err != nil {
+		return err
+	}
+	_, err = m.request(ctx, address, FuncUserDataConfirm, true, data)
+	return err
+}
+
+// Class is the class of the user data of a slave: class 1 is the high-priority data such as the spontaneous events,
+// and class 2 is the low-priority data such as the cyclic measured values.
+type Class int
+
+const (
+	Class1 Class = 1
+	Class2 Class = 2
+)
+
+/*
+Poll requests the user data of the class from the slave. It returns a nil ASDU if the slave has no data of the class,
+and whether the slave has data of class 1 (ACD), which is then polled by the master with priority.
+*/
+func (m *Master) Poll(ctx context.Context, address uint16, class Class) (asdu *iec104.ASDU, acd bool, err error) {
+	function := FuncRequestClass2
+	if class == Class1 {
+		function = FuncRequestClass1
+	}
+	rsp, err := m.request(ctx, address, function, true, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if rsp.Function != FuncUserData || rsp.ASDU == nil {
+		return nil, rsp.ACD(), nil
+	}
+	asdu, err = m.parseASDU(rsp)
+	return asdu, rsp.ACD(), err
+}
+
+/*
+Slave is the secondary station of unbalanced transmission, which answers the requests of the master addressed to its
+link address. The user data of class 1 and class 2 are queued by Enqueue until the master polls them.
+*/
+type Slave struct {
+	*link
+	address uint16
+
+	mu     sync.Mutex
+	class1 [][]byte // user data narrowed to the profile
+	class2 [][]byte
+	state  secondary
+}
+
+func NewSlave(rw io.ReadWriter, cfg Config, address uint16) *Slave {
+	return &Slave{link: newLink(rw, cfg.defaults()), address: address}
+}
+
+// Enqueue queues the ASDU as user data of the class until the master polls it.
+func (s *Slave) Enqueue(class Class, asdu *iec104.ASDU) error {
+	data, err := s.userData(asdu)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if class == Class1 {
+		s.class1 = append(s.class1, data)
+	} else {
+		s.class2 = append(s.class2, data)
+	}
+	return nil
+}
+
+// Serve answers the requests of the master until ctx is done or the link is closed. The ASDUs sent by the master are
+// passed to the handler, and they are acknowledged negatively if the handler fails.
+func (s *Slave) Serve(ctx context.Context, handler Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case f, ok := <-s.frames:
+			if !ok {
+				return s.closed()
+			}
+			if !f.PRM || f.Single || f.Address != s.address {
+				continue
+			}
+			if rsp := s.respond(f, handler); rsp != nil {
+				if err := s.write(rsp); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// respond processes the request and returns its response, or nil if the request isn't answered.
+func (s *Slave) respond(f *Frame, handler Handler) *Frame {
+	s.mu.Lock()
+	rsp, ok := s.state.repeated(f)
+	s.mu.Unlock()
+	if ok {
+		return rsp
+	}
+
+	rsp = &Frame{Function: FuncAck, Address: s.address}
+	if f.Function == FuncUserDataConfirm || f.Function == FuncUserDataNoReply {
+		if err := s.handleUserData(f, handler); err != nil {
+			rsp.Function = FuncNack
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch f.Function {
+	case FuncResetLink:
+		s.state.reset()
+	case FuncResetProcess:
+		s.state.reset()
+		s.class1, s.class2 = nil, nil
+	case FuncRequestStatus:
+		rsp.Function = FuncStatus
+	case FuncUserDataConfirm:
+	case FuncUserDataNoReply:
+		return nil
+	case FuncRequestClass1, FuncRequestClass2:
+		queue := &s.class2
+		if f.Function == FuncRequestClass1 {
+			queue = &s.class1
+		}
+		if len(*queue) == 0 {
+			rsp.Function = FuncNoData
+		} else {
+			rsp.Function, rsp.ASDU = FuncUserData, (*queue)[0]
+			*queue = (*queue)[1:]
+		}
+	default:
+		rsp.Function = FuncNack
+	}
+	rsp.FCB = len(s.class1) > 0 // ACD
+	s.state.accept(f, rsp)
+	return rsp
+}
@@ -0,0 +1,97 @@
+package iec104
+
+import "time"
+
+// CauseOfInitialization is the cause of initialization (COI) of the end of initialization (MEiNa1).
+type CauseOfInitialization uint8
+
+const (
+	CoiLocalPowerOn CauseOfInitialization = 0 // local power switch on
+	CoiLocalReset   CauseOfInitialization = 1 // local manual reset
+	CoiRemoteReset  CauseOfInitialization = 2 // remote reset, for example by the reset process command
+)
+
+// coiParameterChanged is the bit of the COI set when the station is initialized after change of local parameters.
+const coiParameterChanged = 0x80
+
+// newEndOfInitialization returns the end of initialization of the station.
+func newEndOfInitialization(coa COA, cause CauseOfInitialization) *ASDU {
+	return NewASDU(MEiNa1, CotInit, coa, NewInformationObject(0, &InformationElement{
+		Format: InformationElementFormat{COI},
+		Raw:    []byte{byte(cause)},
+	}))
+}
+
+/*
+SetEndOfInitialization makes the stations announce the end of their initialization with the cause after the server is
+started: the end of initialization is sent to each controlling station, that is, to each redundancy group or to each
+IP address of the controlling stations which don't belong to a group, once its first connection starts data transfer.
+*/
+func (s *Server) SetEndOfInitialization(cause CauseOfInitialization, coas ...COA) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialization = nil
+	for _, coa := range coas {
+		s.initialization = append(s.initialization, newEndOfInitialization(coa, cause))
+	}
+	s.initialized = make(map[string]bool)
+	return s
+}
+
+// SendEndOfInitialization sends the end of initialization of the station to every redundancy group, for example,
+// after the station is reset by the reset process command.
+func (s *Server) SendEndOfInitialization(coa COA, cause CauseOfInitialization) {
+	s.Send(newEndOfInitialization(coa, cause))
+}
+
+// announceInitialization sends the end of initialization set by SetEndOfInitialization on the connection which starts
+// data transfer, unless it has been sent to the controlling station.
+func (s *Server) announceInitialization(c *Client) {
+	if s == nil {
+		return
+	}
+	station := c.group.name
+	if c.group.implicit {
+		if ip := remoteIP(c.conn); ip != nil {
+			station = ip.String()
+		}
+	}
+	s.mu.Lock()
+	if len(s.initialization) == 0 || s.initialized[station] {
+		s.mu.Unlock()
+		return
+	}
+	s.initialized[station] = true
+	asdus := s.initialization
+	s.mu.Unlock()
+
+	for _, asdu := range asdus {
+		c.group.send(asdu)
+	}
+}
+
+// reinitialize synchronizes the clock of the station and interrogates it after its end of initialization, as set by
+// ClientOption.SetInitializationActions.
+func (c *Client) reinitialize(coa COA) {
+	if c.syncClockOnInit {
+		if err := c.SendClockSync(coa, time.Now()); err != nil {
+			_lg.Warnf("synchronize clock of COA[%d] after initialization: %v", coa, err)
+		}
+	}
+	if c.interrogateOnInit {
+		if err := c.SendGeneralInterrogation(coa); err != nil {
+			_lg.Warnf("interrogate COA[%d] after initialization: %v", coa, err)
+		}
+	}
+}
+
+// initializedStations returns the stations set by SetEndOfInitialization.
+func (s *Server) initializedStations() []COA {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coas := make([]COA, 0, len(s.initialization))
+	for _, asdu := range s.initialization {
+		coas = append(coas, asdu.coa)
+	}
+	return coas
+}
@@ -0,0 +1,71 @@
+package iec104
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_SetEndOfInitialization(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg).SetEndOfInitialization(CoiLocalPowerOn, 1, 2)
+	commands := make(chan *ASDU, 8)
+	go func() {
+		_ = s.Serve(listener, HandlerFunc(func(c *Client, apdu *APDU) error {
+			commands <- apdu.ASDU
+			return nil
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	connect := func() (*Client, <-chan Event) {
+		option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+		c := NewClient(option.SetInitializationActions(true, true))
+		events := c.Events()
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		testEvent(t, events) // connected
+		return c, events
+	}
+	c, events := connect()
+	for _, coa := range []COA{1, 2} {
+		ev, ok := testEvent(t, events).(EndOfInitializationEvent)
+		if !ok || ev.COA != coa || ev.Cause != CoiLocalPowerOn {
+			t.Fatalf("expect the end of initialization of COA[%d], got %+v", coa, ev)
+		}
+	}
+	for _, want := range []TypeID{CCsNa1, CIcNa1, CCsNa1, CIcNa1} {
+		select {
+		case command := <-commands:
+			if command.typeID != want {
+				t.Errorf("command TypeID[%X] after the end of initialization, want %X", command.typeID, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no TypeID[%X] after the end of initialization", want)
+		}
+	}
+	c.Close()
+
+	c, events = connect()
+	defer c.Close()
+	select {
+	case ev := <-events:
+		t.Errorf("the end of initialization must be announced once, got %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestProcessImage_endOfInitialization(t *testing.T) {
+	pi := newProcessImage(0)
+	now := time.Now()
+	pi.update(testParseASDU(t, testSinglePoint(5, 1)).ASDU, now)
+	pi.update(testParseASDU(t, newEndOfInitialization(1, CoiRemoteReset)).ASDU, now)
+	if p, _ := pi.Point(1, 5, MSpNa1); p.Quality&NT == 0 {
+		t.Errorf("the point of the reinitialized station must be not topical, got %+v", p)
+	}
+}
@@ -0,0 +1,392 @@
+package iec104
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+)
+
+/*
+Parameters of measured values (P_ME_NA_1, P_ME_NB_1 and P_ME_NC_1) are addressed by the IOA of the measured value,
+and the qualifier of parameter of measured values (QPM) tells which parameter is loaded:
+
+	| POP | LPC |             KPA               |
+	  POP: 1 parameter not in operation
+	  LPC: 1 local parameter change
+	  KPA: 1 threshold value, 2 smoothing factor, 3 low limit, 4 high limit
+
+The parameters are loaded with COT Act, and read with COT Req which the controlled station answers with the value
+of the parameter of the kind in the QPM. The value is encoded like the measured value of the same family, for example,
+the threshold of a normalized value is a normalized value. Parameter activation (P_AC_NA_1) switches the loaded
+parameters of a station (QPA 1, IOA 0) or of an information object (QPA 2) in or out of operation.
+*/
+
+// ParameterKind is the kind of parameter (KPA) of the QPM.
+type ParameterKind uint8
+
+const (
+	ParameterThreshold ParameterKind = 1 // deadband of the spontaneous transmission
+	ParameterSmoothing ParameterKind = 2 // smoothing factor (filter time constant) of the measured value, 0-1
+	ParameterLowLimit  ParameterKind = 3 // low limit for transmission of the measured value
+	ParameterHighLimit ParameterKind = 4 // high limit for transmission of the measured value
+)
+
+func (k ParameterKind) valid() bool {
+	return k >= ParameterThreshold && k <= ParameterHighLimit
+}
+
+// the bits of the QPM besides the kind of parameter
+const (
+	qpmKind = 0x3f
+	qpmLPC  = 0x40 // local parameter change
+	qpmPOP  = 0x80 // parameter not in operation
+)
+
+// ParameterActivation is the qualifier of parameter activation (QPA).
+type ParameterActivation uint8
+
+const (
+	ActivateLoaded ParameterActivation = 1 // the previously loaded parameters of the station, addressed by IOA 0
+	ActivateObject ParameterActivation = 2 // the parameter of the addressed information object
+	ActivateCyclic ParameterActivation = 3 // the persistent cyclic or periodic transmission of the object
+)
+
+// isParameter reports whether the type is a parameter of measured values.
+func isParameter(typeID TypeID) bool {
+	return typeID >= PMeNa1 && typeID <= PMeNc1
+}
+
+// newParameterElement encodes the value of the parameter as the type, followed by the QPM.
+func newParameterElement(typeID TypeID, value float64, qpm byte) *InformationElement {
+	ie := &InformationElement{TypeID: typeID, Value: value}
+	switch typeID {
+	case PMeNa1:
+		ie.Format = InformationElementFormat{NVA, QPM}
+		ie.Raw = serializeLittleEndianUint16(uint16(toNormalized(Float(value))))
+	case PMeNb1:
+		ie.Format = InformationElementFormat{SVA, QPM}
+		ie.Raw = serializeLittleEndianUint16(uint16(toScaled(Float(value))))
+	case PMeNc1:
+		ie.Format = InformationElementFormat{IEEE754STD, QPM}
+		ie.Raw = serializeLittleEndianUint32(math.Float32bits(float32(value)))
+	}
+	ie.Raw = append(ie.Raw, qpm)
+	return ie
+}
+
+// parameterOf returns the kind in the QPM of the parsed parameter, which is the last byte of the element.
+func parameterOf(ie *InformationElement) (ParameterKind, byte) {
+	if len(ie.Raw) == 0 {
+		return 0, 0
+	}
+	qpm := ie.Raw[len(ie.Raw)-1]
+	return ParameterKind(qpm & qpmKind), qpm
+}
+
+func checkParameter(typeID TypeID, kind ParameterKind) error {
+	if !isParameter(typeID) {
+		return fmt.Errorf("TypeID[%X] is not a parameter of measured values", typeID)
+	}
+	if !kind.valid() {
+		return fmt.Errorf("invalid kind of parameter %d", kind)
+	}
+	return nil
+}
+
+// LoadParameter loads the parameter of the kind of the measured value at ioa, encoded as typeID which is PMeNa1,
+// PMeNb1 or PMeNc1 for a normalized, scaled or short floating point measured value. It waits for the confirmation.
+func (c *Client) LoadParameter(ctx context.Context, coa COA, ioa IOA, typeID TypeID, kind ParameterKind,
+	value float64) error {
+	if err := checkParameter(typeID, kind); err != nil {
+		return err
+	}
+	_, err := c.exchange(ctx, NewASDU(typeID, CotAct, coa, NewInformationObject(ioa,
+		newParameterElement(typeID, value, byte(kind)))))
+	return err
+}
+
+// ReadParameter reads the parameter of the kind of the measured value at ioa, see LoadParameter.
+func (c *Client) ReadParameter(ctx context.Context, coa COA, ioa IOA, typeID TypeID, kind ParameterKind) (
+	float64, error) {
+	if err := checkParameter(typeID, kind); err != nil {
+		return 0, err
+	}
+	rsp, err := c.exchange(ctx, NewASDU(typeID, CotReq, coa, NewInformationObject(ioa,
+		newParameterElement(typeID, 0, byte(kind)))))
+	if err != nil {
+		return 0, err
+	}
+	if len(rsp.Signals) == 0 {
+		return 0, fmt.Errorf("no parameter of TypeID[%X] at IOA[%d]", typeID, ioa)
+	}
+	if got, _ := parameterOf(rsp.Signals[0]); got != kind {
+		return 0, fmt.Errorf("read parameter of kind %d at IOA[%d], want %d", got, ioa, kind)
+	}
+	return rsp.Signals[0].Value, nil
+}
+
+// ActivateParameter activates or deactivates the parameters selected by qpa. The loaded parameters of the station
+// are addressed by IOA 0.
+func (c *Client) ActivateParameter(ctx context.Context, coa COA, ioa IOA, qpa ParameterActivation,
+	activate bool) error {
+	cot := CotDeact
+	if activate {
+		cot = CotAct
+	}
+	_, err := c.exchange(ctx, NewASDU(PAcNa1, cot, coa, NewInformationObject(ioa, &InformationElement{
+		Format: InformationElementFormat{QPA},
+		Raw:    []byte{byte(qpa)},
+	})))
+	return err
+}
+
+/*
+Parameters stores the parameters of the measured values of a controlled station, and applies them to the spontaneous
+transmission of the measured values sent by Server.Send once it's set by Server.SetParameters:
+  - the value is smoothed by the smoothing factor s, that is, the smoothed value is the previous one plus s times the
+    change, and the value isn't smoothed if s is 0 or not loaded. The smoothed value is the one transmitted;
+  - the measured value is transmitted if the smoothed value differs from the one last transmitted by the threshold
+    or more;
+  - the value is always transmitted when it crosses the low or the high limit, or its quality changes.
+
+It answers the parameters loaded, read and activated by the controlling stations when it's routed the types 110-113,
+for example, by ServeMux.HandleRoute. The parameters of an information object are in operation once loaded, unless the
+QPM has POP set, and until they are deactivated.
+*/
+type Parameters struct {
+	mu       sync.Mutex
+	objects  map[parameterKey]*parameterObject
+	inactive map[COA]bool // stations whose loaded parameters are deactivated
+}
+
+type parameterKey struct {
+	coa COA
+	ioa IOA
+}
+
+type parameterObject struct {
+	values   map[ParameterKind]float64
+	inactive bool
+
+	sent     bool // whether a value has been transmitted
+	last     float64
+	smoothed float64
+	quality  QualityDescriptor
+}
+
+func NewParameters() *Parameters {
+	return &Parameters{
+		objects:  make(map[parameterKey]*parameterObject),
+		inactive: make(map[COA]bool),
+	}
+}
+
+// SetParameter sets the parameter of the measured value locally, for example, the initial threshold.
+func (p *Parameters) SetParameter(coa COA, ioa IOA, kind ParameterKind, value float64) *Parameters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.object(coa, ioa).values[kind] = value
+	return p
+}
+
+// Parameter returns the parameter of the measured value, and whether it's loaded.
+func (p *Parameters) Parameter(coa COA, ioa IOA, kind ParameterKind) (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if o, ok := p.objects[parameterKey{coa, ioa}]; ok {
+		value, ok := o.values[kind]
+		return value, ok
+	}
+	return 0, false
+}
+
+// object returns the parameters of the information object, p.mu is held by the caller.
+func (p *Parameters) object(coa COA, ioa IOA) *parameterObject {
+	key := parameterKey{coa, ioa}
+	o, ok := p.objects[key]
+	if !ok {
+		o = &parameterObject{values: make(map[ParameterKind]float64)}
+		p.objects[key] = o
+	}
+	return o
+}
+
+func (p *Parameters) ServeAPDU(c *Client, apdu *APDU) error {
+	asdu := apdu.ASDU
+	if len(asdu.Signals) == 0 {
+		return nil
+	}
+	ie := asdu.Signals[0]
+	switch {
+	case isParameter(asdu.typeID) && asdu.cot == CotAct:
+		kind, qpm := parameterOf(ie)
+		if !kind.valid() {
+			return c.SendIFrame(asdu.Mirror(CotActCon, true))
+		}
+		p.mu.Lock()
+		o := p.object(asdu.coa, ie.Address)
+		o.values[kind], o.inactive = ie.Value, qpm&qpmPOP != 0
+		p.mu.Unlock()
+		return c.SendIFrame(asdu.Mirror(CotActCon, false))
+	case isParameter(asdu.typeID) && asdu.cot == CotReq:
+		kind, _ := parameterOf(ie)
+		value, ok := p.Parameter(asdu.coa, ie.Address, kind)
+		if !ok {
+			return c.SendIFrame(asdu.Mirror(CotUnknownObjectAddress, true))
+		}
+		rsp := asdu.Mirror(CotReq, false)
+		rsp.ios = []*InformationObject{NewInformationObject(ie.Address, newParameterElement(asdu.typeID, value,
+			byte(kind)))}
+		return c.SendIFrame(rsp)
+	case asdu.typeID == PAcNa1 && (asdu.cot == CotAct || asdu.cot == CotDeact):
+		con := CotActCon
+		if asdu.cot == CotDeact {
+			con = CotDeactCon
+		}
+		inactive := asdu.cot == CotDeact
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		switch ParameterActivation(ie.Value) {
+		case ActivateLoaded:
+			p.inactive[asdu.coa] = inactive
+		case ActivateObject:
+			o, ok := p.objects[parameterKey{asdu.coa, ie.Address}]
+			if !ok {
+				return c.SendIFrame(asdu.Mirror(CotUnknownObjectAddress, true))
+			}
+			o.inactive = inactive
+		default:
+			return c.SendIFrame(asdu.Mirror(con, true))
+		}
+		return c.SendIFrame(asdu.Mirror(con, false))
+	}
+	return c.SendIFrame(asdu.Mirror(CotUnknownCause, true))
+}
+
+// filter drops the spontaneous measured values of the ASDU which the parameters hold back, and returns the ASDUs of
+// the values left, which are smoothed if the smoothing factor is loaded. The elements of an ASDU with SQ are split
+// into an ASDU of each sequence of consecutive elements which are left. The other ASDUs are returned as they are.
+func (p *Parameters) filter(asdu *ASDU) []*ASDU {
+	switch asdu.typeID.Family() {
+	case MMeNa1, MMeNb1, MMeNc1:
+	default:
+		return []*ASDU{asdu}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if asdu.sq {
+		return p.filterSequence(asdu)
+	}
+	ios := make([]*InformationObject, 0, len(asdu.ios))
+	changed := false
+	for _, io := range asdu.ios {
+		if len(io.ies) == 0 {
+			ios = append(ios, io)
+			continue
+		}
+		ie, ok := p.transmit(asdu, io.ioa, io.ies[0])
+		switch {
+		case !ok:
+			changed = true
+		case ie != io.ies[0]:
+			ios, changed = append(ios, NewInformationObject(io.ioa, append([]*InformationElement{ie},
+				io.ies[1:]...)...)), true
+		default:
+			ios = append(ios, io)
+		}
+	}
+	if len(ios) == 0 {
+		return nil
+	}
+	if !changed {
+		return []*ASDU{asdu}
+	}
+	filtered := *asdu
+	filtered.ios, filtered.nObjs, filtered.Signals = ios, NOO(len(ios)), nil
+	for _, io := range ios {
+		filtered.Signals = append(filtered.Signals, io.ies...)
+	}
+	return []*ASDU{&filtered}
+}
+
+// filterSequence filters the elements of the ASDU with SQ, p.mu is held by the caller.
+func (p *Parameters) filterSequence(asdu *ASDU) []*ASDU {
+	if len(asdu.ios) != 1 {
+		return []*ASDU{asdu}
+	}
+	var (
+		asdus   []*ASDU
+		run     []*InformationElement
+		changed bool
+	)
+	end := func() {
+		if len(run) > 0 {
+			filtered := *asdu
+			filtered.ios = []*InformationObject{NewInformationObject(run[0].Address, run...)}
+			filtered.nObjs, filtered.Signals = NOO(len(run)), run
+			asdus, run = append(asdus, &filtered), nil
+		}
+	}
+	for i, ie := range asdu.ios[0].ies {
+		kept, ok := p.transmit(asdu, asdu.ios[0].ioa+IOA(i), ie)
+		if !ok {
+			end()
+			changed = true
+			continue
+		}
+		changed = changed || kept != ie
+		run = append(run, kept)
+	}
+	if !changed {
+		return []*ASDU{asdu}
+	}
+	end()
+	return asdus
+}
+
+// transmit applies the parameters of the information object at ioa to its measured value, and returns the element
+// which is transmitted, and whether it's transmitted. The element carries the smoothed value if it's smoothed. p.mu
+// is held by the caller.
+func (p *Parameters) transmit(asdu *ASDU, ioa IOA, ie *InformationElement) (*InformationElement, bool) {
+	o, ok := p.objects[parameterKey{asdu.coa, ioa}]
+	if !ok || o.inactive || p.inactive[asdu.coa] {
+		return ie, true
+	}
+	value, send := o.transmit(ie, asdu.cot != CotSpont)
+	if !send || value == ie.Value {
+		return ie, send
+	}
+	smoothed, err := NewInformationElement(asdu.typeID, NewTypedValue(asdu.typeID, value), ie.Quality, ie.Ts)
+	if err != nil {
+		return ie, true
+	}
+	smoothed.Address = ie.Address
+	return smoothed, true
+}
+
+// transmit updates the smoothed value by the measured value, and returns the value which is transmitted, and whether
+// it's transmitted. The value is always transmitted if forced, for example, when it's interrogated.
+func (o *parameterObject) transmit(ie *InformationElement, forced bool) (float64, bool) {
+	value := ie.Value
+	if s, ok := o.values[ParameterSmoothing]; ok && s > 0 && s < 1 && o.sent {
+		value = o.smoothed + s*(ie.Value-o.smoothed)
+	}
+	o.smoothed = value
+
+	send := forced || !o.sent || ie.Quality != o.quality
+	if threshold, ok := o.values[ParameterThreshold]; !ok || math.Abs(value-o.last) >= threshold {
+		send = true
+	}
+	if low, ok := o.values[ParameterLowLimit]; ok && (value < low) != (o.last < low) {
+		send = true
+	}
+	if high, ok := o.values[ParameterHighLimit]; ok && (value > high) != (o.last > high) {
+		send = true
+	}
+	if send {
+		o.sent, o.last, o.quality = true, value, ie.Quality
+	}
+	return value, send
+}
@@ -0,0 +1,206 @@
+package iec104
+
+import (
+	"context"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_parameters(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	parameters := NewParameters()
+	go func() {
+		_ = s.Serve(listener, NewServeMux().HandleRoute(Route{TypeIDs: []TypeID{PMeNa1, PMeNb1, PMeNc1, PAcNa1}},
+			parameters))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		typeID TypeID
+		ioa    IOA
+		kind   ParameterKind
+		value  float64
+	}{
+		{PMeNa1, 100, ParameterThreshold, 0.25},
+		{PMeNb1, 200, ParameterLowLimit, -120},
+		{PMeNc1, 300, ParameterSmoothing, 0.5},
+		{PMeNc1, 300, ParameterHighLimit, 400.5},
+	}
+	for _, tt := range tests {
+		if err := c.LoadParameter(ctx, 1, tt.ioa, tt.typeID, tt.kind, tt.value); err != nil {
+			t.Fatalf("LoadParameter(%X, %d, %d) error = %v", tt.typeID, tt.ioa, tt.kind, err)
+		}
+		if got, ok := parameters.Parameter(1, tt.ioa, tt.kind); !ok || got != tt.value {
+			t.Errorf("Parameter(%d, %d) = %v, %v, want %v", tt.ioa, tt.kind, got, ok, tt.value)
+		}
+		got, err := c.ReadParameter(ctx, 1, tt.ioa, tt.typeID, tt.kind)
+		if err != nil || got != tt.value {
+			t.Errorf("ReadParameter(%X, %d, %d) = %v, %v, want %v", tt.typeID, tt.ioa, tt.kind, got, err, tt.value)
+		}
+	}
+
+	if _, err := c.ReadParameter(ctx, 1, 100, PMeNa1, ParameterHighLimit); err == nil {
+		t.Errorf("ReadParameter() of a parameter not loaded must fail")
+	}
+	if err := c.ActivateParameter(ctx, 1, 100, ActivateObject, false); err != nil {
+		t.Errorf("ActivateParameter() error = %v", err)
+	}
+	if err := c.ActivateParameter(ctx, 1, 0, ActivateLoaded, true); err != nil {
+		t.Errorf("ActivateParameter() error = %v", err)
+	}
+	if err := c.ActivateParameter(ctx, 1, 100, ActivateCyclic, true); err == nil {
+		t.Errorf("ActivateParameter() of cyclic transmission must be confirmed negatively")
+	}
+	if err := c.ActivateParameter(ctx, 1, 999, ActivateObject, true); err == nil {
+		t.Errorf("ActivateParameter() of an unknown object must fail")
+	}
+}
+
+func TestParameters_filter(t *testing.T) {
+	measured := func(ioa IOA, cot COT, value float64, quality QualityDescriptor) *ASDU {
+		ie, _ := NewInformationElement(MMeNc1, Float(value), quality, time.Time{})
+		return NewASDU(MMeNc1, cot, 1, NewInformationObject(ioa, ie))
+	}
+	p := NewParameters().
+		SetParameter(1, 10, ParameterThreshold, 1).
+		SetParameter(1, 10, ParameterHighLimit, 100).
+		SetParameter(1, 20, ParameterThreshold, 1).
+		SetParameter(1, 20, ParameterSmoothing, 0.5)
+
+	tests := []struct {
+		name string
+		asdu *ASDU
+		want bool
+	}{
+		{"first value", measured(10, CotSpont, 50, 0), true},
+		{"within the threshold", measured(10, CotSpont, 50.5, 0), false},
+		{"beyond the threshold", measured(10, CotSpont, 51.5, 0), true},
+		{"quality changed", measured(10, CotSpont, 51.5, IV), true},
+		{"interrogated", measured(10, CotInrogen, 51.5, IV), true},
+		{"above the high limit", measured(10, CotSpont, 100.2, 0), true},
+		{"still above the high limit", measured(10, CotSpont, 100.4, 0), false},
+		{"below the high limit again", measured(10, CotSpont, 99.9, 0), true},
+		{"without parameters", measured(30, CotSpont, 1, 0), true},
+		{"first smoothed value", measured(20, CotSpont, 10, 0), true},
+		{"smoothed within the threshold", measured(20, CotSpont, 11.5, 0), false},
+		{"smoothed beyond the threshold", measured(20, CotSpont, 11.5, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.filter(tt.asdu) != nil; got != tt.want {
+				t.Errorf("filter() transmits %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	ie, _ := NewInformationElement(MMeNc1, Float(100), 0, time.Time{})
+	other, _ := NewInformationElement(MMeNc1, Float(7), 0, time.Time{})
+	asdu := NewASDU(MMeNc1, CotSpont, 1, NewInformationObject(10, ie), NewInformationObject(30, other))
+	if got := p.filter(asdu); len(got) != 1 || got[0].nObjs != 1 || got[0].ios[0].ioa != 30 {
+		t.Errorf("filter() must keep only the object without parameters, got %+v", got)
+	}
+
+	smoothed := p.filter(measured(20, CotSpont, 16, 0))
+	if len(smoothed) != 1 || smoothed[0].Signals[0].Value != 13.5625 {
+		t.Fatalf("filter() must transmit the smoothed value 13.5625, got %+v", smoothed)
+	}
+	if got := testParseASDU(t, smoothed[0]).Signals[0]; got.Address != 20 || got.Value != 13.5625 {
+		t.Errorf("filter() encodes %+v, want the smoothed value 13.5625 at IOA 20", got)
+	}
+
+	p.SetParameter(1, 40, ParameterSmoothing, 0.5)
+	normalized := func(value Normalized) *ASDU {
+		ie, _ := NewInformationElement(MMeNa1, value, 0, time.Time{})
+		return NewASDU(MMeNa1, CotSpont, 1, NewInformationObject(40, ie))
+	}
+	p.filter(normalized(0))
+	smoothed = p.filter(normalized(16384))
+	if len(smoothed) != 1 || !reflect.DeepEqual(smoothed[0].Signals[0].Typed, Normalized(8192)) {
+		t.Fatalf("filter() must transmit the smoothed normalized value 8192, got %+v", smoothed)
+	}
+	if got := testParseASDU(t, smoothed[0]).Signals[0]; !reflect.DeepEqual(got.Typed, Normalized(8192)) {
+		t.Errorf("filter() encodes %#v, want Normalized(8192)", got.Typed)
+	}
+
+	p.object(1, 10).inactive = true
+	if p.filter(measured(10, CotSpont, 100.25, 0)) == nil {
+		t.Errorf("filter() must not apply the parameters out of operation")
+	}
+}
+
+func TestParameters_filterSequence(t *testing.T) {
+	p := NewParameters().
+		SetParameter(1, 11, ParameterThreshold, 1).
+		SetParameter(1, 13, ParameterThreshold, 1)
+	sequence := func(values ...int16) *ASDU {
+		data := []byte{byte(MMeNb1), 0x80 | byte(len(values)), byte(CotSpont), 0, 1, 0, 10, 0, 0}
+		for _, v := range values {
+			data = append(data, byte(v), byte(v>>8), 0)
+		}
+		asdu := new(ASDU)
+		if err := asdu.Parse(data); err != nil {
+			t.Fatal(err)
+		}
+		return asdu
+	}
+
+	if got := p.filter(sequence(1, 2, 3, 4, 5)); len(got) != 1 || got[0].nObjs != 5 {
+		t.Fatalf("filter() must transmit the first values as they are, got %+v", got)
+	}
+	got := p.filter(sequence(1, 2, 3, 4, 5)) // IOA 11 and 13 are within the threshold
+	want := []IOA{10, 12, 14}
+	if len(got) != len(want) {
+		t.Fatalf("filter() returns %d ASDUs, want %d", len(got), len(want))
+	}
+	for i, asdu := range got {
+		parsed := testParseASDU(t, asdu)
+		if !bool(parsed.sq) || parsed.nObjs != 1 || parsed.Signals[0].Address != want[i] {
+			t.Errorf("ASDU %d: got %+v, want the sequence at IOA %d", i, parsed.ASDU, want[i])
+		}
+	}
+}
+
+func Test_newParameterElement(t *testing.T) {
+	tests := []struct {
+		typeID TypeID
+		value  float64
+		raw    []byte
+	}{
+		{PMeNa1, 0.5, []byte{0x00, 0x40, 0x01}},
+		{PMeNb1, -2, []byte{0xfe, 0xff, 0x03}},
+		{PMeNc1, 1, []byte{0x00, 0x00, 0x80, 0x3f, 0x81}},
+	}
+	for _, tt := range tests {
+		qpm := tt.raw[len(tt.raw)-1]
+		ie := newParameterElement(tt.typeID, tt.value, qpm)
+		if string(ie.Raw) != string(tt.raw) {
+			t.Errorf("newParameterElement(%X, %v) = % X, want % X", tt.typeID, tt.value, ie.Raw, tt.raw)
+		}
+
+		asdu := &ASDU{}
+		if err := asdu.Parse(NewASDU(tt.typeID, CotAct, 1, NewInformationObject(5, ie)).Data()); err != nil {
+			t.Fatal(err)
+		}
+		kind, got := parameterOf(asdu.Signals[0])
+		if math.Abs(asdu.Signals[0].Value-tt.value) > 1e-6 || got != qpm || kind != ParameterKind(qpm&qpmKind) {
+			t.Errorf("parsed %X = %v with QPM %X, want %v with %X", tt.typeID, asdu.Signals[0].Value, got, tt.value,
+				qpm)
+		}
+	}
+}
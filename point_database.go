@@ -0,0 +1,249 @@
+package iec104
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+PointDatabase is the state of the information objects in monitor direction of the stations a Server serves, which
+answers the controlling stations when it's routed the types:
+  - CIcNa1, the general interrogation of a station or of all stations, by all the points except the integrated totals,
+    or by the points of a group for QOI 21-36;
+  - CCiNa1, the counter interrogation, by the integrated totals, or by those of a group for RQT 1-4;
+  - CRdNa1, the read command, by the point read.
+
+The interrogated points are sent without time tag, and the rejections are answered by the Server with the unknown
+causes. Update changes a point and returns the ASDU of the change, which the station sends by Server.Send.
+
+A point is keyed by its station and its information object address only, so an object has one type, unlike a
+ProcessImage which keys the points by the type family too. The answers are built from copies of the points taken under
+the read lock, which is released before they are sent, so a slow controlling station doesn't block Update. Update
+holds the write lock while it encodes the information element of the change, so that the ASDU returned and the point
+stored agree even if the point is updated concurrently; the ASDUs are sent by the caller after the lock is released.
+*/
+type PointDatabase struct {
+	mu     sync.RWMutex
+	points map[pointAddress]*databasePoint
+}
+
+type pointAddress struct {
+	coa COA
+	ioa IOA
+}
+
+type databasePoint struct {
+	Point
+	groups []uint8 // the interrogation groups, 1-16 for general and 1-4 for counter interrogation
+}
+
+func NewPointDatabase() *PointDatabase {
+	return &PointDatabase{points: make(map[pointAddress]*databasePoint)}
+}
+
+// Add adds the point, whose TypeID is the type of its changes, for example, MMeTf1 for a measured value sent with time
+// tag, and which belongs to the interrogation groups. The point replaces the point of the same address, and its Typed
+// is converted from Value by NewTypedValue if it's nil.
+func (db *PointDatabase) Add(p Point, groups ...uint8) *PointDatabase {
+	if p.Typed == nil {
+		p.Typed = NewTypedValue(p.TypeID, p.Value)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.points[pointAddress{p.COA, p.IOA}] = &databasePoint{Point: p, groups: groups}
+	return db
+}
+
+// Point returns the point of the information object of the station.
+func (db *PointDatabase) Point(coa COA, ioa IOA) (Point, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	p, ok := db.points[pointAddress{coa, ioa}]
+	if !ok {
+		return Point{}, false
+	}
+	return p.Point, true
+}
+
+// Points returns the points sorted by the common address and the information object address.
+func (db *PointDatabase) Points() []Point {
+	db.mu.RLock()
+	points := make([]Point, 0, len(db.points))
+	for _, p := range db.points {
+		points = append(points, p.Point)
+	}
+	db.mu.RUnlock()
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].COA != points[j].COA {
+			return points[i].COA < points[j].COA
+		}
+		return points[i].IOA < points[j].IOA
+	})
+	return points
+}
+
+// Update changes the value and the quality of the point, and returns the ASDU of the change with the cause of
+// transmission, such as CotSpont or CotRetRem. The database is locked while the information element is built, see
+// PointDatabase.
+func (db *PointDatabase) Update(cot COT, coa COA, ioa IOA, value TypedValue, quality QualityDescriptor) (*ASDU,
+	error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	p, ok := db.points[pointAddress{coa, ioa}]
+	if !ok {
+		return nil, &UnknownObjectAddressError{NegativeConfirmError{COA: coa, IOA: ioa}}
+	}
+	ie, err := NewInformationElement(p.TypeID, value, quality, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	p.Value, p.Typed, p.Quality, p.Ts, p.COT = ie.Value, value, quality, ie.Ts, cot
+	return NewASDU(p.TypeID, cot, coa, NewInformationObject(ioa, ie)), nil
+}
+
+func (db *PointDatabase) ServeAPDU(c *Client, apdu *APDU) error {
+	switch apdu.typeID {
+	case CIcNa1, CCiNa1:
+		return db.interrogate(c, apdu.ASDU)
+	case CRdNa1:
+		return db.read(c, apdu.ASDU)
+	}
+	return errNoHandler(apdu.ASDU)
+}
+
+// interrogate answers the general or the counter interrogation.
+func (db *PointDatabase) interrogate(c *Client, asdu *ASDU) error {
+	if asdu.cot == CotDeact {
+		return c.SendIFrame(asdu.Mirror(CotDeactCon, false))
+	}
+	var qualifier uint8
+	if len(asdu.Signals) > 0 && len(asdu.Signals[0].Raw) > 0 {
+		qualifier = asdu.Signals[0].Raw[0]
+	}
+	counters := asdu.typeID == CCiNa1
+	cot, group := COT(qualifier), uint8(0)
+	switch {
+	case !counters && cot >= CotInro1 && cot <= CotInro16:
+		group = uint8(cot - CotInrogen)
+	case counters && qualifier&0x3f >= 1 && qualifier&0x3f <= 4:
+		group = qualifier & 0x3f
+		cot = CotReqcogen + COT(group)
+	case counters:
+		cot = CotReqcogen
+	default:
+		cot = CotInrogen
+	}
+
+	points, known := db.interrogated(asdu.coa, counters, group)
+	if !known {
+		return &UnknownCommonAddressError{NegativeConfirmError{TypeID: asdu.typeID, COA: asdu.coa}}
+	}
+	if err := c.SendIFrame(asdu.Mirror(CotActCon, false)); err != nil {
+		return err
+	}
+	for _, x := range groupPoints(cot, points) {
+		if err := c.SendIFrame(x); err != nil {
+			return err
+		}
+	}
+	return c.SendIFrame(asdu.Mirror(CotActTerm, false))
+}
+
+// interrogated returns the points of the station, or of all stations for GlobalCOA, which are interrogated, and
+// whether the station is known.
+func (db *PointDatabase) interrogated(coa COA, counters bool, group uint8) ([]Point, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	known := coa == GlobalCOA
+	var points []Point
+	for _, p := range db.points {
+		if coa != GlobalCOA && p.COA != coa {
+			continue
+		}
+		known = true
+		if (p.TypeID.Family() == MItNa1) != counters || (group != 0 && !containsGroup(p.groups, group)) {
+			continue
+		}
+		points = append(points, p.Point)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		a, b := points[i], points[j]
+		if a.COA != b.COA {
+			return a.COA < b.COA
+		}
+		if a.TypeID.Family() != b.TypeID.Family() {
+			return a.TypeID.Family() < b.TypeID.Family()
+		}
+		return a.IOA < b.IOA
+	})
+	return points, known
+}
+
+func containsGroup(groups []uint8, group uint8) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// groupPoints puts the consecutive points of the same station and type family into as few ASDUs without time tag as
+// possible.
+func groupPoints(cot COT, points []Point) []*ASDU {
+	var asdus []*ASDU
+	for i := 0; i < len(points); {
+		first := points[i]
+		typeID := first.TypeID.Family()
+		var ios []*InformationObject
+		for ; i < len(points); i++ {
+			p := points[i]
+			if p.COA != first.COA || p.TypeID.Family() != typeID {
+				break
+			}
+			ie, err := NewInformationElement(typeID, p.Typed, p.Quality, p.Ts)
+			if err != nil {
+				_lg.Warnf("interrogate IOA[%d] of COA[%d]: %v", p.IOA, p.COA, err)
+				continue
+			}
+			if len(ios) == (MaxAsduLen-AsduHeaderLen)/(IOALength+len(ie.Raw)) {
+				break
+			}
+			ios = append(ios, NewInformationObject(p.IOA, ie))
+		}
+		if len(ios) > 0 {
+			asdus = append(asdus, NewASDU(typeID, cot, first.COA, ios...))
+		}
+	}
+	return asdus
+}
+
+// read answers the read command by the point read.
+func (db *PointDatabase) read(c *Client, asdu *ASDU) error {
+	key := pendingKeyOf(asdu)
+	p, ok := db.Point(key.coa, key.ioa)
+	if !ok {
+		neg := NegativeConfirmError{TypeID: CRdNa1, COA: key.coa, IOA: key.ioa}
+		if !db.hasStation(key.coa) {
+			return &UnknownCommonAddressError{neg}
+		}
+		return &UnknownObjectAddressError{neg}
+	}
+	ie, err := NewInformationElement(p.TypeID, p.Typed, p.Quality, p.Ts)
+	if err != nil {
+		return err
+	}
+	return c.SendIFrame(NewASDU(p.TypeID, CotReq, p.COA, NewInformationObject(p.IOA, ie)))
+}
+
+func (db *PointDatabase) hasStation(coa COA) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for address := range db.points {
+		if address.coa == coa {
+			return true
+		}
+	}
+	return false
+}
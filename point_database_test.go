@@ -0,0 +1,140 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPointDatabase(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	db := NewPointDatabase().
+		Add(Point{COA: 1, IOA: 1, TypeID: MSpTb1, Value: 1}).
+		Add(Point{COA: 1, IOA: 2, TypeID: MDpNa1, Value: 2}).
+		Add(Point{COA: 1, IOA: 100, TypeID: MMeNc1, Value: 12.5, Quality: OV}).
+		Add(Point{COA: 1, IOA: 101, TypeID: MMeNb1, Value: -40}, 2).
+		Add(Point{COA: 2, IOA: 100, TypeID: MMeTf1, Value: 3}).
+		Add(Point{COA: 1, IOA: 200, TypeID: MItNa1, Value: 12.34})
+	go func() {
+		_ = s.Serve(listener, db)
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testEvent(t, events) // connected
+	interrogate := func(send func(COA) error, coa COA) {
+		t.Helper()
+		if err := send(coa); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			if _, ok := testEvent(t, events).(InterrogationEndEvent); ok {
+				return
+			}
+		}
+	}
+
+	interrogate(c.SendGeneralInterrogation, 1)
+	tests := []struct {
+		ioa    IOA
+		typeID TypeID
+		value  float64
+	}{
+		{1, MSpNa1, 1},
+		{2, MDpNa1, 2},
+		{100, MMeNc1, 12.5},
+		{101, MMeNb1, -40},
+	}
+	for _, tt := range tests {
+		p, ok := c.ProcessImage().Point(1, tt.ioa, tt.typeID)
+		if !ok || p.TypeID != tt.typeID || p.COT != CotInrogen || p.Value != tt.value {
+			t.Errorf("interrogated IOA[%d] = %+v, %v, want %X of %v", tt.ioa, p, ok, tt.typeID, tt.value)
+		}
+	}
+	if _, ok := c.ProcessImage().Point(1, 200, MItNa1); ok {
+		t.Errorf("the general interrogation must not answer the integrated totals")
+	}
+	if _, ok := c.ProcessImage().Point(2, 100, MMeNc1); ok {
+		t.Errorf("the general interrogation of a station must not answer the other stations")
+	}
+	interrogate(func(coa COA) error { return c.SendGroupInterrogation(coa, 2) }, 1)
+	if p, _ := c.ProcessImage().Point(1, 101, MMeNb1); p.COT != CotInro2 {
+		t.Errorf("group interrogated COT = %d, want %d", p.COT, CotInro2)
+	}
+	if p, _ := c.ProcessImage().Point(1, 100, MMeNc1); p.COT != CotInrogen {
+		t.Errorf("the group interrogation must only answer the points of the group, got COT %d", p.COT)
+	}
+	if err := c.SendGroupInterrogation(1, 17); err == nil {
+		t.Errorf("SendGroupInterrogation() of group 17 must fail")
+	}
+	interrogate(c.SendCounterInterrogation, 1)
+	if p, ok := c.ProcessImage().Point(1, 200, MItNa1); !ok || p.COT != CotReqcogen || p.Typed.Float64() != 1234 {
+		t.Errorf("counter interrogated = %+v, %v", p, ok)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if p, err := c.Read(ctx, 2, 100); err != nil || p.TypeID != MMeTf1 || p.Value != 3 {
+		t.Errorf("Read() = %+v, %v", p, err)
+	}
+	if _, err := c.Read(ctx, 1, 300); !errors.Is(err, &UnknownObjectAddressError{}) {
+		t.Errorf("Read() of an unknown object error = %v", err)
+	}
+	if _, err := c.Read(ctx, 3, 100); !errors.Is(err, &UnknownCommonAddressError{}) {
+		t.Errorf("Read() of an unknown station error = %v", err)
+	}
+
+	asdu, err := db.Update(CotSpont, 1, 100, Float(13), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Send(asdu)
+	if p, err := c.Read(ctx, 1, 100); err != nil || p.Value != 13 || p.Quality != 0 {
+		t.Errorf("Read() after Update() = %+v, %v", p, err)
+	}
+	if _, err := db.Update(CotSpont, 1, 300, Float(1), 0); !errors.Is(err, &UnknownObjectAddressError{}) {
+		t.Errorf("Update() of an unknown object error = %v", err)
+	}
+}
+
+func Test_groupPoints(t *testing.T) {
+	var points []Point
+	for ioa := IOA(1); ioa <= 40; ioa++ {
+		points = append(points, Point{COA: 1, IOA: ioa, TypeID: MMeTf1, Typed: Float(ioa)})
+	}
+	points = append(points, Point{COA: 1, IOA: 41, TypeID: MSpNa1, Typed: SinglePoint(true)},
+		Point{COA: 2, IOA: 1, TypeID: MSpNa1, Typed: SinglePoint(false)})
+
+	asdus := groupPoints(CotInrogen, points)
+	want := []struct {
+		typeID TypeID
+		coa    COA
+		n      int
+	}{
+		{MMeNc1, 1, 30}, // (249-6)/(3+5) information objects at most
+		{MMeNc1, 1, 10},
+		{MSpNa1, 1, 1},
+		{MSpNa1, 2, 1},
+	}
+	if len(asdus) != len(want) {
+		t.Fatalf("groupPoints() = %d ASDUs, want %d", len(asdus), len(want))
+	}
+	for i, w := range want {
+		if asdus[i].typeID != w.typeID || asdus[i].coa != w.coa || len(asdus[i].ios) != w.n {
+			t.Errorf("ASDU %d = TypeID[%X] COA[%d] with %d objects, want %+v", i, asdus[i].typeID, asdus[i].coa,
+				len(asdus[i].ios), w)
+		}
+	}
+}
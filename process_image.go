@@ -0,0 +1,190 @@
+package iec104
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// families maps the types with time tag to the type without time tag of the same information.
+var families = map[TypeID]TypeID{
+	MSpTa1: MSpNa1, MSpTb1: MSpNa1,
+	MDpTa1: MDpNa1, MDpTb1: MDpNa1,
+	MMeTa1: MMeNa1, MMeTd1: MMeNa1, MMeNd1: MMeNa1,
+	MMeTb1: MMeNb1, MMeTe1: MMeNb1,
+	MMeTc1: MMeNc1, MMeTf1: MMeNc1,
+	MItTa1: MItNa1, MItTb1: MItNa1,
+}
+
+// Family returns the type without time tag of the same information, for example, MSpNa1 for MSpTb1. The types of a
+// family update the same point of a process image.
+func (t TypeID) Family() TypeID {
+	if family, ok := families[t]; ok {
+		return family
+	}
+	return t
+}
+
+// PointKey identifies a point of a process image. Family is the type without time tag, see TypeID.Family, so that
+// the same information object of a station is one point whether it is transmitted with or without time tag.
+type PointKey struct {
+	COA    COA
+	IOA    IOA
+	Family TypeID
+}
+
+// Point is the latest state of an information object received from a controlled station.
+type Point struct {
+	COA      COA
+	IOA      IOA
+	TypeID   TypeID // type of the latest update
+	COT      COT    // cause of transmission of the latest update
+	Value    float64
+	Typed    TypedValue
+	Quality  QualityDescriptor
+	Ts       time.Time // time tag of the latest update, zero if its type has no time tag
+	Received time.Time // time when the latest update is received
+}
+
+func (p Point) Key() PointKey {
+	return PointKey{COA: p.COA, IOA: p.IOA, Family: p.TypeID.Family()}
+}
+
+/*
+ProcessImage is the latest state of the points of all the controlled stations a Client receives from, keyed by the
+common address, the information object address and the type family.
+
+A point which is not updated for the stale period is returned with the quality NT (not topical). When the connection
+is closed, all points are marked IV (invalid) until they are updated again, for example by a general interrogation.
+The methods are safe to be called concurrently with the updates.
+*/
+type ProcessImage struct {
+	mu     sync.RWMutex
+	points map[PointKey]Point
+	stale  time.Duration // zero if the points never become stale
+}
+
+func newProcessImage(stale time.Duration) *ProcessImage {
+	return &ProcessImage{points: make(map[PointKey]Point), stale: stale}
+}
+
+// Point returns the point of the information object of the station with the type family of typeID.
+func (pi *ProcessImage) Point(coa COA, ioa IOA, typeID TypeID) (Point, bool) {
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+	p, ok := pi.points[PointKey{COA: coa, IOA: ioa, Family: typeID.Family()}]
+	return pi.aged(p, time.Now()), ok
+}
+
+func (pi *ProcessImage) Len() int {
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+	return len(pi.points)
+}
+
+// Snapshot returns a copy of all the points, sorted by common address, information object address and type family.
+func (pi *ProcessImage) Snapshot() []Point {
+	now := time.Now()
+	pi.mu.RLock()
+	points := make([]Point, 0, len(pi.points))
+	for _, p := range pi.points {
+		points = append(points, pi.aged(p, now))
+	}
+	pi.mu.RUnlock()
+
+	sort.Slice(points, func(i, j int) bool {
+		a, b := points[i].Key(), points[j].Key()
+		if a.COA != b.COA {
+			return a.COA < b.COA
+		}
+		if a.IOA != b.IOA {
+			return a.IOA < b.IOA
+		}
+		return a.Family < b.Family
+	})
+	return points
+}
+
+// Station returns a copy of the points of the station with the common address, sorted like Snapshot.
+func (pi *ProcessImage) Station(coa COA) []Point {
+	points := pi.Snapshot()
+	i := sort.Search(len(points), func(i int) bool { return points[i].COA >= coa })
+	j := sort.Search(len(points), func(i int) bool { return points[i].COA > coa })
+	return points[i:j]
+}
+
+// Range calls fn for each point in no particular order until fn returns false. The process image is not updated
+// while fn is called, so fn must not block.
+func (pi *ProcessImage) Range(fn func(p Point) bool) {
+	now := time.Now()
+	pi.mu.RLock()
+	defer pi.mu.RUnlock()
+	for _, p := range pi.points {
+		if !fn(pi.aged(p, now)) {
+			return
+		}
+	}
+}
+
+// aged marks the point not topical if it is not updated for the stale period.
+func (pi *ProcessImage) aged(p Point, now time.Time) Point {
+	if pi.stale > 0 && now.Sub(p.Received) > pi.stale {
+		p.Quality |= NT
+	}
+	return p
+}
+
+// update updates the points with the information objects of the ASDU in monitor direction.
+func (pi *ProcessImage) update(asdu *ASDU, now time.Time) {
+	if isControlDirection(asdu.typeID) {
+		return
+	}
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+	if asdu.typeID == MEiNa1 {
+		// the points of the reinitialized station are not topical until they are updated again
+		for key, p := range pi.points {
+			if p.COA == asdu.coa {
+				p.Quality |= NT
+				pi.points[key] = p
+			}
+		}
+		return
+	}
+	for _, ie := range asdu.Signals {
+		if ie.Typed == nil {
+			continue
+		}
+		p := pointOf(asdu, ie, now)
+		pi.points[p.Key()] = p
+	}
+}
+
+// pointOf returns the point of the information element received at now.
+func pointOf(asdu *ASDU, ie *InformationElement, now time.Time) Point {
+	p := Point{
+		COA:      asdu.coa,
+		IOA:      ie.Address,
+		TypeID:   asdu.typeID,
+		COT:      asdu.cot,
+		Value:    ie.Value,
+		Typed:    ie.Typed,
+		Quality:  ie.Quality,
+		Ts:       ie.Ts,
+		Received: now,
+	}
+	if counter, ok := ie.Typed.(BinaryCounter); ok && counter.Invalid {
+		p.Quality |= IV
+	}
+	return p
+}
+
+// invalidate marks all points invalid when the connection is closed.
+func (pi *ProcessImage) invalidate() {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+	for key, p := range pi.points {
+		p.Quality |= IV
+		pi.points[key] = p
+	}
+}
@@ -0,0 +1,89 @@
+package iec104
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessImage_update(t *testing.T) {
+	ie := func(raw ...byte) *InformationElement {
+		return &InformationElement{Raw: raw}
+	}
+	cp56 := []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x18}
+	pi := newProcessImage(0)
+	now := time.Now()
+	for _, asdu := range []*ASDU{
+		NewASDU(MSpNa1, CotInrogen, 1, NewInformationObject(5, ie(0x00))),
+		NewASDU(MSpNa1, CotInrogen, 2, NewInformationObject(5, ie(0x01))),
+		NewASDU(MSpTb1, CotSpont, 1, NewInformationObject(5, ie(append([]byte{0x01 | byte(SB)}, cp56...)...))),
+		NewASDU(MMeNb1, CotSpont, 1, NewInformationObject(5, ie(0x10, 0x00, 0x00))),
+		NewASDU(MItNa1, CotReqcogen, 1, NewInformationObject(6, ie(0x01, 0x00, 0x00, 0x00, 0x80))),
+		NewASDU(CScNa1, CotActCon, 1, NewInformationObject(7, ie(0x01))),
+	} {
+		pi.update(testParseASDU(t, asdu).ASDU, now)
+	}
+
+	tests := []struct {
+		name    string
+		key     PointKey
+		want    float64
+		quality QualityDescriptor
+		typeID  TypeID
+	}{
+		{"time tagged update of the same family", PointKey{1, 5, MSpNa1}, 1, SB, MSpTb1},
+		{"same address of another station", PointKey{2, 5, MSpNa1}, 1, 0, MSpNa1},
+		{"same address of another family", PointKey{1, 5, MMeNb1}, 16, 0, MMeNb1},
+		{"invalid counter", PointKey{1, 6, MItTb1}, 0.01, IV, MItNa1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := pi.Point(tt.key.COA, tt.key.IOA, tt.key.Family)
+			if !ok {
+				t.Fatalf("no point %+v", tt.key)
+			}
+			if p.Value != tt.want || p.Quality != tt.quality || p.TypeID != tt.typeID || !p.Received.Equal(now) {
+				t.Errorf("Point() = %+v, want value %v, quality %X and type %X", p, tt.want, tt.quality, tt.typeID)
+			}
+		})
+	}
+	if _, ok := pi.Point(1, 7, CScNa1); ok {
+		t.Errorf("commands are not points of the process image")
+	}
+	if snapshot := pi.Snapshot(); len(snapshot) != 4 || snapshot[3].COA != 2 || snapshot[0].Key() != (PointKey{1, 5, MSpNa1}) {
+		t.Errorf("Snapshot() = %+v, want 4 points sorted by address", snapshot)
+	}
+	if station := pi.Station(2); len(station) != 1 || station[0].COA != 2 {
+		t.Errorf("Station(2) = %+v, want the point of the station 2", station)
+	}
+}
+
+func TestProcessImage_stale(t *testing.T) {
+	pi := newProcessImage(time.Minute)
+	asdu := testParseASDU(t, testSinglePoint(1, 1)).ASDU
+	pi.update(asdu, time.Now().Add(-2*time.Minute))
+	pi.update(testParseASDU(t, testSinglePoint(2, 1)).ASDU, time.Now())
+
+	if p, _ := pi.Point(1, 1, MSpNa1); p.Quality != NT {
+		t.Errorf("quality of the stale point = %X, want NT", p.Quality)
+	}
+	if p, _ := pi.Point(1, 2, MSpNa1); p.Quality != 0 {
+		t.Errorf("quality of the updated point = %X, want 0", p.Quality)
+	}
+
+	pi.invalidate()
+	n := 0
+	pi.Range(func(p Point) bool {
+		n++
+		if p.Quality&IV == 0 {
+			t.Errorf("point %d is not invalid after the connection is closed", p.IOA)
+		}
+		return true
+	})
+	if n != 2 {
+		t.Errorf("Range() visits %d points, want 2", n)
+	}
+	pi.update(asdu, time.Now())
+	if p, _ := pi.Point(1, 1, MSpTa1); p.Quality != 0 {
+		t.Errorf("quality of the point updated again = %X, want 0", p.Quality)
+	}
+}
@@ -0,0 +1,73 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_Read(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	go func() {
+		_ = s.Serve(listener, NewServeMux().Handle(CRdNa1, func(c *Client, apdu *APDU) error {
+			switch ioa := apdu.ios[0].ioa; ioa {
+			case 5:
+				ie, _ := NewInformationElement(MMeNc1, Float(12.5), OV, time.Time{})
+				s.Send(NewASDU(MMeNc1, CotReq, apdu.coa, NewInformationObject(ioa, ie)))
+				return nil
+			case 6:
+				return c.SendIFrame(apdu.Mirror(CotUnknownType, true))
+			default:
+				return c.SendIFrame(apdu.Mirror(CotUnknownObjectAddress, true))
+			}
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	connect := func() (*Client, <-chan Event) {
+		option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+		c := NewClient(option)
+		events := c.Events()
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		testEvent(t, events) // connected
+		return c, events
+	}
+	c, _ := connect()
+	_, others := connect()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := c.Read(ctx, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.COA != 1 || p.IOA != 5 || p.TypeID != MMeNc1 || p.COT != CotReq || p.Typed != Float(12.5) || p.Quality != OV {
+		t.Errorf("Read() = %+v", p)
+	}
+	if got, ok := c.ProcessImage().Point(1, 5, MMeNc1); !ok || got.Value != 12.5 {
+		t.Errorf("the point read must be updated in the process image, got %+v", got)
+	}
+	select {
+	case ev := <-others:
+		t.Errorf("the answer of the read command must be sent only to the reader, got %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	var unknownType *UnknownTypeError
+	if _, err := c.Read(ctx, 1, 6); !errors.As(err, &unknownType) || unknownType.IOA != 6 {
+		t.Errorf("Read() of an unsupported type error = %v, want UnknownTypeError", err)
+	}
+	var unknownObject *UnknownObjectAddressError
+	if _, err := c.Read(ctx, 1, 7); !errors.As(err, &unknownObject) || unknownObject.IOA != 7 {
+		t.Errorf("Read() of an unknown object error = %v, want UnknownObjectAddressError", err)
+	}
+}
@@ -3,7 +3,9 @@ package iec104
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -19,69 +21,311 @@ func NewServer(address string, tc *tls.Config, lg *logrus.Logger) *Server {
 
 // Server in IEC 104 is also called as slave or controlled station.
 type Server struct {
-	address  string
-	tc       *tls.Config
-	listener net.Listener
+	address    string
+	tc         *tls.Config
+	tlsProfile *TLSProfile
+	listener   net.Listener
+	closed     bool
+	wg         sync.WaitGroup // goroutines serving connections
+
+	groups   []*RedundancyGroup
+	mu       sync.Mutex
+	sessions map[*Client]*RedundancyGroup
+	commands map[pendingKey]originator // connection which issued each command
+	origins  map[COA]originator        // connection which issued the latest command to each station
+
+	allowList       []*net.IPNet
+	maxConns        int
+	policies        []*clientPolicy
+	onAcceptHandler OnAcceptHandler
+	coas            []COA // common addresses of the stations, empty if any
+
+	parameters *Parameters
+
+	initialization []*ASDU               // end of initialization of the stations announced after the server is started
+	initialized    map[string]bool       // controlling stations which the end of initialization has been announced to
+	delays         map[COA]time.Duration // transmission delays sent by the controlling stations
 
 	lg *logrus.Logger
 }
 
-func (s *Server) Serve(handler ClientHandler) error {
-	if err := s.listen(); err != nil {
+// AddRedundancyGroup adds a redundancy group. The connections from controlling stations which don't belong to any
+// redundancy group are served independently from each other.
+func (s *Server) AddRedundancyGroup(g *RedundancyGroup) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = append(s.groups, g)
+	return s
+}
+
+// SetParameters applies the parameters of measured values to the measured values sent by Send, see Parameters.
+func (s *Server) SetParameters(p *Parameters) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parameters = p
+	return s
+}
+
+// Send sends the ASDU to every redundancy group, that is, to the started connection of each group. The answers of a
+// command are sent only to the connection which issued the command. The measured values held back by the parameters
+// set by SetParameters aren't sent.
+func (s *Server) Send(asdu *ASDU) {
+	s.mu.Lock()
+	parameters := s.parameters
+	s.mu.Unlock()
+	if parameters != nil {
+		for _, filtered := range parameters.filter(asdu) {
+			s.send(filtered)
+		}
+		return
+	}
+	s.send(asdu)
+}
+
+// send sends the ASDU to the connection which issued the command, or to every redundancy group.
+func (s *Server) send(asdu *ASDU) {
+	if c := s.originOf(asdu); c != nil {
+		if err := c.sendASDU(asdu, nil); err != nil {
+			s.lg.Warnf("send TypeID[%X] with COT[%d] to ORG[%d]: %v", asdu.typeID, asdu.cot, asdu.org, err)
+		}
+		return
+	}
+
+	for _, g := range s.redundancyGroups() {
+		g.send(asdu)
+	}
+}
+
+// redundancyGroups returns the configured redundancy groups and the implicit groups of the connections.
+func (s *Server) redundancyGroups() []*RedundancyGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]*RedundancyGroup, 0, len(s.groups)+len(s.sessions))
+	groups = append(groups, s.groups...)
+	for _, g := range s.sessions {
+		if g.implicit {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// groupOf returns the configured redundancy group of the connection, or creates an implicit one for it.
+func (s *Server) groupOf(conn net.Conn) *RedundancyGroup {
+	if ip := remoteIP(conn); ip != nil {
+		for _, g := range s.groups {
+			if g.Contains(ip) {
+				return g
+			}
+		}
+	}
+	g := newRedundancyGroup(conn.RemoteAddr().String())
+	g.implicit = true
+	return g
+}
+
+func (s *Server) addSession(c *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.maxConns > 0 && len(s.sessions) >= s.maxConns {
+		return errTooManyConnections
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[*Client]*RedundancyGroup)
+	}
+	g := s.groupOf(c.conn)
+	g.attach(c)
+	s.sessions[c] = g
+	return nil
+}
+
+func (s *Server) removeSession(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, c)
+	s.forget(c)
+}
+
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to Shutdown.
+var ErrServerClosed = errors.New("iec104: server closed")
+
+// ListenAndServe listens on the address of the server, with TLS if it's configured, and serves the connections.
+func (s *Server) ListenAndServe(handler Handler) error {
+	listener, err := s.listen()
+	if err != nil {
 		return err
 	}
-	defer s.listener.Close()
+	return s.Serve(listener, handler)
+}
+
+// Serve serves the connections accepted by the listener until Shutdown is called. The listener is used as it is, so it
+// must be a TLS listener if the connections should be secured.
+//
+// Serve replaces Serve(handler ClientHandler), which listened on the address of the server, call
+// ListenAndServe(AdaptClientHandler(handler)) instead.
+func (s *Server) Serve(listener net.Listener, handler Handler) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+	defer listener.Close()
+
+	var delay time.Duration
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			s.lg.Errorf("accept conn with %s", conn.RemoteAddr())
-			continue
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				s.lg.Errorf("accept conn: %v, retrying in %s", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
 		}
+		delay = 0
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(&Conn{
+				conn,
+			}, handler)
+		}()
+	}
+}
+
+// Addr returns the address of the listener, which is useful when the server listens on an ephemeral port.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+/*
+Shutdown shuts down the server gracefully:
+  - it stops accepting new connections, and Serve returns ErrServerClosed;
+  - it closes all connections, a controlled station is not allowed to send STOPDT, so the connections are closed
+    without it;
+  - it waits for the handlers to finish.
+
+If ctx expires before the handlers finish, Shutdown returns the error of ctx.
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	listener := s.listener
+	sessions := make([]*Client, 0, len(s.sessions))
+	for c := range s.sessions {
+		sessions = append(sessions, c)
+	}
+	s.mu.Unlock()
+
+	if listener != nil {
+		_ = listener.Close()
+	}
+	for _, c := range sessions {
+		c.terminate()
+	}
 
-		go s.serve(&Conn{
-			conn,
-		}, handler)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
-func (s *Server) listen() error {
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) listen() (net.Listener, error) {
 	if s.tc != nil {
 		listener, err := tls.Listen("tcp", s.address, s.tc)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		s.lg.Debugf("IEC104 server serve at %s with security: %+v", s.address, s.tc)
-		s.listener = listener
-	} else {
-		listener, err := net.Listen("tcp", s.address)
-		if err != nil {
-			return err
-		}
-		s.lg.Debugf("IEC104 server serve at %s no security", s.address)
-		s.listener = listener
+		return listener, nil
 	}
-	return nil
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+	s.lg.Debugf("IEC104 server serve at %s no security", s.address)
+	return listener, nil
 }
-func (s *Server) serve(conn *Conn, handler ClientHandler) {
+func (s *Server) serve(conn *Conn, handler Handler) {
 	s.lg.Debugf("serve connection from %s", conn.RemoteAddr())
+	policy, err := s.admit(conn)
+	if err == nil {
+		if tc, ok := conn.Conn.(*tls.Conn); ok {
+			policy, err = s.handshake(tc, policy)
+		}
+	}
+	if err != nil {
+		s.lg.Warnf("reject connection from %s: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
 	// TODO
-	option, _ := NewClientOption(s.address, handler, 10*time.Second)
-	client := NewClient(option)
-	ctx, cancel := context.WithCancel(context.Background())
-	client.cancel = cancel
+	option, _ := NewClientOption(s.address, nil, 10*time.Second)
+	client := NewClient(option.SetHandler(handler))
 	client.conn = conn
-	//用于发送数据
-	go client.writingToSocket(ctx)
-	//用于接收数据
-	go client.readingFromSocket(ctx)
-
-	// var readData = []byte{}
-	// for {
-	// 	conn.Read(readData)
-	// 	s.lg.Printf("读取到的数据：" + string(readData))
-	// 	readData = nil
-	// 	time.Sleep(2 * time.Second)
-	// }
+	client.srv = s
+	client.policy = policy
+	if err := s.addSession(client); err != nil {
+		s.lg.Warnf("reject connection from %s: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	//用于发送、接收数据
+	ctx := client.start(conn)
+	if s.isClosed() {
+		client.terminate() // Shutdown has been called before the connection was started
+	}
+	//用于更新会话密钥
+	if s.tlsProfile != nil && s.tlsProfile.RenegotiationInterval > 0 {
+		go client.expiringSession(ctx, s.tlsProfile.RenegotiationInterval)
+	}
+	//用于处理数据，直到连接关闭
+	client.handlingData(ctx)
+}
 
+// expiringSession closes the TLS session after the interval, so that the controlling station establishes a new one
+// with fresh keys.
+func (c *Client) expiringSession(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+		c.lost(ctx, errors.New("tls session expired, new session required for key refresh"))
+	}
 }
 
 type Conn struct {
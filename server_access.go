@@ -0,0 +1,246 @@
+package iec104
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+/*
+ClientPolicy restricts what a controlling station may do on the controlled station.
+  - COAs is the list of common addresses (stations) which the controlling station may address in control direction.
+    An empty list allows all common addresses, including the global address 65535, which is otherwise not allowed
+    since it addresses every station.
+  - Commands is the list of type identifications in control direction which the controlling station may send, such as
+    CScNa1 or CIcNa1, including the types of the file transfer such as FScNa1. An empty list allows all types.
+
+The ASDUs in control direction which are not allowed by the policy are answered with a negative confirmation, and the
+ASDUs of the file transfer with the negative ASDU of the same cause.
+*/
+type ClientPolicy struct {
+	COAs     []COA
+	Commands []TypeID
+}
+
+type clientPolicy struct {
+	network *net.IPNet
+	policy  *ClientPolicy
+}
+
+// Allows reports whether the controlling station may send the ASDU of the type to the common address.
+func (p *ClientPolicy) Allows(typeID TypeID, coa COA) bool {
+	if p == nil {
+		return true
+	}
+	if len(p.Commands) > 0 && !containsTypeID(p.Commands, typeID) {
+		return false
+	}
+	if len(p.COAs) > 0 && !containsCOA(p.COAs, coa) {
+		return false
+	}
+	return true
+}
+
+func containsTypeID(ids []TypeID, id TypeID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCOA(coas []COA, coa COA) bool {
+	for _, x := range coas {
+		if x == coa {
+			return true
+		}
+	}
+	return false
+}
+
+// OnAcceptHandler is called for every accepted connection, and the connection is closed if it returns an error.
+type OnAcceptHandler func(conn net.Conn) error
+
+// SetAllowList accepts only the controlling stations whose address is one of the clients. Each client is either an
+// IP address or a network in CIDR notation. All controlling stations are accepted if the list is empty.
+func (s *Server) SetAllowList(clients ...string) error {
+	networks := make([]*net.IPNet, 0, len(clients))
+	for _, client := range clients {
+		network, err := parseIPNet(client)
+		if err != nil {
+			return err
+		}
+		networks = append(networks, network)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowList = networks
+	return nil
+}
+
+// SetMaxConnections limits the number of connections served at the same time, zero means no limit.
+func (s *Server) SetMaxConnections(n int) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n >= 0 {
+		s.maxConns = n
+	}
+	return s
+}
+
+// SetClientPolicy sets the policy of the controlling stations whose address is the client, which is either an IP
+// address or a network in CIDR notation. The policy set first is used if several policies match a controlling station.
+func (s *Server) SetClientPolicy(client string, policy *ClientPolicy) error {
+	network, err := parseIPNet(client)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies = append(s.policies, &clientPolicy{network: network, policy: policy})
+	return nil
+}
+
+func (s *Server) SetOnAcceptHandler(handler OnAcceptHandler) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onAcceptHandler = handler
+	return s
+}
+
+// admit checks whether the connection is accepted, and returns the policy of the controlling station.
+func (s *Server) admit(conn net.Conn) (*ClientPolicy, error) {
+	ip := remoteIP(conn)
+
+	s.mu.Lock()
+	allowList, policies, onAccept := s.allowList, s.policies, s.onAcceptHandler
+	s.mu.Unlock()
+
+	if len(allowList) > 0 {
+		allowed := false
+		for _, network := range allowList {
+			if ip != nil && network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%s is not in the allow list", conn.RemoteAddr())
+		}
+	}
+	if onAccept != nil {
+		if err := onAccept(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range policies {
+		if ip != nil && p.network.Contains(ip) {
+			return p.policy, nil
+		}
+	}
+	return nil, nil
+}
+
+// authorize checks the ASDU received from the controlling station against its policy, and answers the ASDU in control
+// direction or of the file transfer which is not allowed with a negative confirmation.
+func (s *Server) authorize(c *Client, asdu *ASDU) bool {
+	if !isControlDirection(asdu.typeID) && !isFileTransfer(asdu.typeID) || c.policy.Allows(asdu.typeID, asdu.coa) {
+		return true
+	}
+	s.lg.Warnf("reject TypeID[%X] to COA[%d] from %s", asdu.typeID, asdu.coa, c.remoteAddr())
+	switch {
+	case isFileTransfer(asdu.typeID):
+		_ = c.sendASDU(asdu.Mirror(asdu.cot, true), nil)
+	case asdu.cot == CotAct:
+		_ = c.sendASDU(asdu.Mirror(CotActCon, true), nil)
+	case asdu.cot == CotDeact:
+		_ = c.sendASDU(asdu.Mirror(CotDeactCon, true), nil)
+	case asdu.cot == CotReq:
+		_ = c.sendASDU(asdu.Mirror(CotReq, true), nil)
+	}
+	return false
+}
+
+// SetCommonAddresses sets the common addresses of the stations of the server. The ASDUs addressed to other stations
+// are answered with COT 46 (unknown common address). All common addresses are accepted if none is set.
+func (s *Server) SetCommonAddresses(coas ...COA) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.coas = coas
+	return s
+}
+
+/*
+accept checks the ASDU received from the controlling station before it's handled, and answers the ASDU which the
+server can't handle with the unknown cause:
+  - COT 44 if the type isn't sent in control direction and doesn't belong to the file transfer;
+  - COT 45 if the cause of transmission isn't valid for the type;
+  - COT 46 if the common address isn't one of SetCommonAddresses.
+*/
+func (s *Server) accept(c *Client, asdu *ASDU) bool {
+	s.mu.Lock()
+	coas := s.coas
+	s.mu.Unlock()
+
+	cot := COT(0)
+	switch {
+	case !isControlDirection(asdu.typeID) && !isFileTransfer(asdu.typeID):
+		cot = CotUnknownType
+	case !validCause(asdu.typeID, asdu.cot):
+		cot = CotUnknownCause
+	case len(coas) > 0 && asdu.coa != GlobalCOA && !containsCOA(coas, asdu.coa):
+		cot = CotUnknownAsduAddress
+	default:
+		return true
+	}
+	s.lg.Debugf("reject TypeID[%X] with COT[%d] to COA[%d] from %s with COT[%d]", asdu.typeID, asdu.cot, asdu.coa,
+		c.remoteAddr(), cot)
+	_ = c.sendASDU(asdu.Mirror(cot, true), nil)
+	return false
+}
+
+// validCause reports whether the cause of transmission is valid for the type in control direction or of the file
+// transfer.
+func validCause(typeID TypeID, cot COT) bool {
+	if isFileTransfer(typeID) {
+		return cot == CotFile || (cot == CotReq && (typeID == FScNa1 || typeID == FScNb1))
+	}
+	switch cot {
+	case CotAct, CotDeact:
+		return typeID != CRdNa1
+	case CotReq:
+		return typeID == CRdNa1 || isParameter(typeID)
+	case CotSpont:
+		return typeID == CCdNa1
+	}
+	return false
+}
+
+// reject answers the ASDU with the cause of the rejection error returned by its handler, and reports whether the ASDU
+// is rejected.
+func (s *Server) reject(c *Client, asdu *ASDU, err error) bool {
+	cot, ok := rejectionCOT(err)
+	if !ok {
+		return false
+	}
+	s.lg.Debugf("reject TypeID[%X] to COA[%d] from %s: %v", asdu.typeID, asdu.coa, c.remoteAddr(), err)
+	_ = c.sendASDU(asdu.Mirror(cot, true), nil)
+	return true
+}
+
+var errTooManyConnections = errors.New("too many connections")
+
+// controlDirection is the set of the types sent by the controlling station to be confirmed.
+var controlDirection = map[TypeID]bool{
+	CScNa1: true, CDcNa1: true, CRcNa1: true, CSeNa1: true, CSeNb1: true, CSeNc1: true,
+	CScTa1: true, CDcTa1: true, CSeTa1: true, CSeTb1: true, CSeTc1: true,
+	CIcNa1: true, CCiNa1: true, CRdNa1: true, CCsNa1: true, CTsNb1: true, CRpNc1: true, CCdNa1: true, CTsTa1: true,
+	PMeNa1: true, PMeNb1: true, PMeNc1: true, PAcNa1: true,
+}
+
+// isControlDirection reports whether the ASDU of the type is sent by the controlling station to be confirmed.
+func isControlDirection(typeID TypeID) bool {
+	return controlDirection[typeID]
+}
@@ -0,0 +1,182 @@
+package iec104
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientPolicy_Allows(t *testing.T) {
+	p := &ClientPolicy{
+		COAs:     []COA{1, 2},
+		Commands: []TypeID{CIcNa1, CScNa1},
+	}
+	tests := []struct {
+		name   string
+		policy *ClientPolicy
+		typeID TypeID
+		coa    COA
+		want   bool
+	}{
+		{"no policy", nil, CDcNa1, 9, true},
+		{"empty policy", &ClientPolicy{}, CDcNa1, 9, true},
+		{"allowed", p, CScNa1, 2, true},
+		{"global address", p, CIcNa1, GlobalCOA, false},
+		{"global address without common addresses", &ClientPolicy{Commands: []TypeID{CIcNa1}}, CIcNa1, GlobalCOA, true},
+		{"type not allowed", p, CDcNa1, 1, false},
+		{"common address not allowed", p, CScNa1, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.typeID, tt.coa); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testDial(t *testing.T, address string) net.Conn {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func testClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Errorf("expect the connection to be closed, got %v", err)
+	}
+}
+
+func TestServer_negativeConfirmation(t *testing.T) {
+	s, address := testServer(t)
+	if err := s.SetClientPolicy("127.0.0.1", &ClientPolicy{COAs: []COA{1}, Commands: []TypeID{CScNa1}}); err != nil {
+		t.Fatal(err)
+	}
+	conn := testDial(t, address)
+
+	command := NewASDU(CDcNa1, CotAct, 1, NewInformationObject(5, &InformationElement{Raw: []byte{0x82}}))
+	testWrite(t, conn, append((&IFrame{}).Data(), command.Data()...))
+	apdu := testReadAPDU(t, conn)
+	if apdu.ASDU == nil || apdu.typeID != CDcNa1 || apdu.cot != CotActCon || !apdu.pn {
+		t.Fatalf("expect negative activation confirmation, got %+v", apdu.ASDU)
+	}
+	if got := apdu.ios[0].ioa; got != 5 {
+		t.Errorf("mirrored IOA = %d, want 5", got)
+	}
+
+	read := NewASDU(CRdNa1, CotReq, 1, NewInformationObject(5))
+	testWrite(t, conn, append((&IFrame{SendSN: 1}).Data(), read.Data()...))
+	if apdu := testReadAPDU(t, conn); apdu.ASDU == nil || apdu.typeID != CRdNa1 || apdu.cot != CotReq || !apdu.pn {
+		t.Fatalf("expect negative answer of the read command, got %+v", apdu.ASDU)
+	}
+
+	broadcast := NewASDU(CScNa1, CotAct, GlobalCOA, NewInformationObject(5, &InformationElement{Raw: []byte{0x81}}))
+	testWrite(t, conn, append((&IFrame{SendSN: 2}).Data(), broadcast.Data()...))
+	if apdu := testReadAPDU(t, conn); apdu.ASDU == nil || apdu.coa != GlobalCOA || apdu.cot != CotActCon || !apdu.pn {
+		t.Fatalf("expect negative confirmation of the broadcast, got %+v", apdu.ASDU)
+	}
+}
+
+func Test_isControlDirection(t *testing.T) {
+	tests := []struct {
+		typeID TypeID
+		want   bool
+	}{
+		{CScNa1, true},
+		{CSeNc1, true},
+		{51, false}, // bitstring of 32 bit, not supported
+		{55, false}, // undefined
+		{CScTa1, true},
+		{60, false}, // undefined
+		{67, false}, // undefined
+		{MEiNa1, false},
+		{99, false}, // undefined
+		{CIcNa1, true},
+		{CTsTa1, true},
+		{108, false}, // undefined
+		{PMeNa1, true},
+		{PAcNa1, true},
+		{FFrNa1, false},
+	}
+	for _, tt := range tests {
+		if got := isControlDirection(tt.typeID); got != tt.want {
+			t.Errorf("isControlDirection(%d) = %v, want %v", tt.typeID, got, tt.want)
+		}
+	}
+}
+
+func TestServer_unknownType(t *testing.T) {
+	_, address := testServer(t)
+	conn := testDial(t, address)
+
+	undefined := NewASDU(55, CotAct, 1, NewInformationObject(5, &InformationElement{Raw: []byte{0x01}}))
+	testWrite(t, conn, append((&IFrame{}).Data(), undefined.Data()...))
+	apdu := testReadAPDU(t, conn)
+	if apdu.ASDU == nil || apdu.typeID != 55 || apdu.cot != CotUnknownType || !apdu.pn {
+		t.Fatalf("expect negative confirmation of unknown type, got %+v", apdu.ASDU)
+	}
+}
+
+func TestServer_fileAccess(t *testing.T) {
+	s, address := testServer(t)
+	s.SetCommonAddresses(1, 2)
+	if err := s.SetClientPolicy("127.0.0.1", &ClientPolicy{COAs: []COA{1}}); err != nil {
+		t.Fatal(err)
+	}
+	conn := testDial(t, address)
+
+	tests := []struct {
+		name string
+		asdu *ASDU
+		cot  COT
+	}{
+		{"unknown common address", fileASDU(FScNa1, CotReq, 3, 0, &fileElement{}), CotUnknownAsduAddress},
+		{"invalid cause", fileASDU(FScNa1, CotAct, 1, 0, &fileElement{}), CotUnknownCause},
+		{"directory not allowed", fileASDU(FScNa1, CotReq, 2, 0, &fileElement{}), CotReq},
+		{"selection not allowed", fileASDU(FScNa1, CotFile, 2, 1000, &fileElement{name: 2, qualifier: scqSelectFile}),
+			CotFile},
+		{"acknowledgement not allowed", fileASDU(FAfNa1, CotFile, 2, 1000, &fileElement{name: 2, qualifier: afqFile}),
+			CotFile},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testWrite(t, conn, append((&IFrame{SendSN: uint16(i)}).Data(), tt.asdu.Data()...))
+			apdu := testReadAPDU(t, conn)
+			if apdu.ASDU == nil || apdu.typeID != tt.asdu.typeID || apdu.cot != tt.cot || !apdu.pn {
+				t.Fatalf("expect negative TypeID[%X] with COT[%d], got %+v", tt.asdu.typeID, tt.cot, apdu.ASDU)
+			}
+		})
+	}
+}
+
+func TestServer_admit(t *testing.T) {
+	t.Run("max connections", func(t *testing.T) {
+		s, address := testServer(t)
+		s.SetMaxConnections(1)
+		first := testDial(t, address)
+		testWrite(t, first, UFrameFunctionTestFA)
+		testReadAPDU(t, first) // the first connection is served
+		testClosed(t, testDial(t, address))
+	})
+	t.Run("allow list", func(t *testing.T) {
+		s, address := testServer(t)
+		if err := s.SetAllowList("10.0.0.0/8"); err != nil {
+			t.Fatal(err)
+		}
+		testClosed(t, testDial(t, address))
+	})
+	t.Run("on accept handler", func(t *testing.T) {
+		s, address := testServer(t)
+		s.SetOnAcceptHandler(func(conn net.Conn) error {
+			return errors.New("maintenance")
+		})
+		testClosed(t, testDial(t, address))
+	})
+}
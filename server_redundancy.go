@@ -0,0 +1,233 @@
+package iec104
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultRedundancyQueueSize = 1024
+)
+
+/*
+RedundancyGroup is a group of connections of controlling stations to the controlled station defined by IEC 60870-5-104
+Edition 2.
+
+  - Several connections of one redundancy group may be established at the same time, but only the one which has been
+    started by STARTDT is used for user data. The other connections of the group are kept as standby and are only
+    supervised by TESTFR.
+  - When another connection of the group is started, the previous started connection becomes a standby connection,
+    and the events which have not been acknowledged on it are sent again on the newly started connection.
+  - Events produced while no connection of the group is started are buffered up to the size of the queue.
+
+The connections are assigned to a group by the IP address of the controlling station.
+*/
+type RedundancyGroup struct {
+	name      string
+	networks  []*net.IPNet
+	queueSize int
+	implicit  bool // groups created for connections which don't belong to any configured group
+
+	mu       sync.Mutex
+	sessions map[*Client]struct{}
+	active   *Client        // the started connection
+	queue    []*queuedEvent // events not acknowledged by the controlling station yet
+}
+
+type queuedEvent struct {
+	asdu *ASDU
+	sent bool
+	ssn  uint16 // send sequence number of the I-frame carrying the event on the started connection
+}
+
+// NewRedundancyGroup creates a redundancy group which accepts the controlling stations whose address is one of the
+// clients. Each client is either an IP address ("192.168.1.10") or a network in CIDR notation ("192.168.1.0/24").
+func NewRedundancyGroup(name string, clients ...string) (*RedundancyGroup, error) {
+	g := newRedundancyGroup(name)
+	for _, client := range clients {
+		network, err := parseIPNet(client)
+		if err != nil {
+			return nil, err
+		}
+		g.networks = append(g.networks, network)
+	}
+	return g, nil
+}
+func newRedundancyGroup(name string) *RedundancyGroup {
+	return &RedundancyGroup{
+		name:      name,
+		queueSize: DefaultRedundancyQueueSize,
+		sessions:  make(map[*Client]struct{}),
+	}
+}
+
+// parseIPNet parses an IP address or a network in CIDR notation.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address: %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// remoteIP returns the IP address of the remote end of the connection, or nil if it is not an IP connection.
+func remoteIP(conn net.Conn) net.IP {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// SetQueueSize sets the maximum number of buffered events. The oldest events are dropped when the queue is full.
+func (g *RedundancyGroup) SetQueueSize(size int) *RedundancyGroup {
+	if size > 0 {
+		g.queueSize = size
+	}
+	return g
+}
+
+func (g *RedundancyGroup) Name() string {
+	return g.name
+}
+
+// Contains reports whether the controlling station with the IP address belongs to the group.
+func (g *RedundancyGroup) Contains(ip net.IP) bool {
+	for _, network := range g.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns the number of events which have not been acknowledged by the controlling station yet.
+func (g *RedundancyGroup) Pending() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.queue)
+}
+
+// clear drops the events which have not been acknowledged by the controlling station.
+func (g *RedundancyGroup) clear() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.queue = nil
+}
+
+func (g *RedundancyGroup) attach(c *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sessions[c] = struct{}{}
+	c.group = g
+}
+
+func (g *RedundancyGroup) detach(c *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.sessions, c)
+	if g.active == c {
+		g.deactivate()
+	}
+}
+
+// start makes the connection the started connection of the group, and sends the unacknowledged events on it. A
+// repeated STARTDT on the started connection changes nothing, since its events are already sent.
+func (g *RedundancyGroup) start(c *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active == c {
+		return
+	}
+	if g.active != nil {
+		_lg.Infof("redundancy group %s: switch over from %s to %s", g.name,
+			g.active.remoteAddr(), c.remoteAddr())
+	}
+	g.active = c
+	for _, e := range g.queue {
+		e.sent = false
+		g.transmit(c, e)
+	}
+}
+
+// transmit hands the event over to the started connection. The event is sent once the send window of the connection
+// allows, and only then it may be acknowledged.
+func (g *RedundancyGroup) transmit(c *Client, e *queuedEvent) {
+	_ = c.sendASDU(e.asdu, func(ssn uint16) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.active == c {
+			e.ssn, e.sent = ssn, true
+		}
+	})
+}
+
+func (g *RedundancyGroup) stop(c *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active == c {
+		g.deactivate()
+	}
+}
+
+// deactivate must be called with g.mu held.
+func (g *RedundancyGroup) deactivate() {
+	g.active = nil
+	for _, e := range g.queue {
+		e.sent = false
+	}
+	if g.implicit {
+		g.queue = nil
+	}
+}
+
+// ack drops the events acknowledged by the receive sequence number from the started connection.
+func (g *RedundancyGroup) ack(c *Client, recvSN uint16) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active != c {
+		return
+	}
+	n := 0
+	for _, e := range g.queue {
+		if !e.sent || !seqAcked(e.ssn, recvSN) {
+			break
+		}
+		n++
+	}
+	g.queue = g.queue[n:]
+}
+
+// seqAcked reports whether the I-frame with the send sequence number ssn is acknowledged by the receive sequence
+// number recvSN, which acknowledges all I-frames with a send sequence number less than it (modulo 2^15).
+func seqAcked(ssn, recvSN uint16) bool {
+	distance := (recvSN - ssn) & 0x7fff
+	return distance > 0 && distance < 1<<14
+}
+
+// send sends the event on the started connection, and keeps it until the controlling station acknowledges it.
+func (g *RedundancyGroup) send(asdu *ASDU) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.implicit && g.active == nil {
+		return
+	}
+	e := &queuedEvent{asdu: asdu}
+	if g.active != nil {
+		g.transmit(g.active, e)
+	}
+	g.queue = append(g.queue, e)
+	if len(g.queue) > g.queueSize {
+		_lg.Warnf("redundancy group %s: queue is full, drop the oldest event", g.name)
+		g.queue = g.queue[len(g.queue)-g.queueSize:]
+	}
+}
@@ -0,0 +1,152 @@
+package iec104
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRedundancyGroup_Contains(t *testing.T) {
+	g, err := NewRedundancyGroup("scada", "192.168.1.10", "10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"single address", "192.168.1.10", true},
+		{"other address", "192.168.1.11", false},
+		{"address in network", "10.1.2.3", true},
+		{"address out of network", "11.1.2.3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.Contains(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewRedundancyGroup("scada", "not an address"); err == nil {
+		t.Errorf("NewRedundancyGroup() with invalid address should fail")
+	}
+}
+
+func Test_seqAcked(t *testing.T) {
+	tests := []struct {
+		name   string
+		ssn    uint16
+		recvSN uint16
+		want   bool
+	}{
+		{"not acknowledged", 3, 3, false},
+		{"acknowledged", 3, 4, true},
+		{"acknowledged after wraparound", 1<<15 - 1, 0, true},
+		{"not acknowledged before wraparound", 0, 1<<15 - 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := seqAcked(tt.ssn, tt.recvSN); got != tt.want {
+				t.Errorf("seqAcked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testSession serves one end of a pipe as a connection of the controlled station, and returns the other end.
+func testSession(t *testing.T, g *RedundancyGroup) net.Conn {
+	master, slave := net.Pipe()
+	option, _ := NewClientOption("127.0.0.1:2404", nil, time.Second)
+	c := NewClient(option)
+	g.attach(c)
+	go c.handlingData(c.start(slave))
+	t.Cleanup(func() {
+		c.terminate()
+		_ = master.Close()
+	})
+	return master
+}
+
+func testReadAPDU(t *testing.T, conn net.Conn) *APDU {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("read apdu header: %v", err)
+	}
+	body := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatalf("read apdu body: %v", err)
+	}
+	apdu := new(APDU)
+	if err := apdu.Parse(body); err != nil {
+		t.Fatalf("parse apdu: %v", err)
+	}
+	return apdu
+}
+
+func testWrite(t *testing.T, conn net.Conn, data []byte) {
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	frame := append([]byte{startByte, byte(len(data))}, data...)
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+}
+
+func testSinglePoint(ioa IOA, on byte) *ASDU {
+	return NewASDU(MSpNa1, CotSpont, 1, NewInformationObject(ioa, &InformationElement{Raw: []byte{on}}))
+}
+
+func TestRedundancyGroup_switchover(t *testing.T) {
+	g, _ := NewRedundancyGroup("scada", "10.0.0.0/8")
+	a, b := testSession(t, g), testSession(t, g)
+
+	// Events are buffered while no connection is started.
+	g.send(testSinglePoint(1, 1))
+
+	testWrite(t, a, UFrameFunctionStartDTA)
+	if apdu := testReadAPDU(t, a); apdu.frame.Type() != FrameTypeU || apdu.frame.Data()[0] != UFrameFunctionStartDTC[0] {
+		t.Fatalf("expect StartDTC, got % X", apdu.frame.Data())
+	}
+	if apdu := testReadAPDU(t, a); apdu.ASDU == nil || apdu.ASDU.ios[0].ioa != 1 {
+		t.Fatalf("expect the buffered event on the started connection")
+	}
+	g.send(testSinglePoint(2, 1))
+	if apdu := testReadAPDU(t, a); apdu.frame.(*IFrame).SendSN != 1 || apdu.ASDU.ios[0].ioa != 2 {
+		t.Fatalf("expect the second event with N(S)=1")
+	}
+
+	// Acknowledge the first event only.
+	testWrite(t, a, (&SFrame{RecvSN: 1}).Data())
+	deadline := time.Now().Add(time.Second)
+	for g.Pending() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Pending() = %d, want 1", g.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Switch over to the standby connection: the unacknowledged event is sent again.
+	testWrite(t, b, UFrameFunctionStartDTA)
+	if apdu := testReadAPDU(t, b); apdu.frame.Data()[0] != UFrameFunctionStartDTC[0] {
+		t.Fatalf("expect StartDTC, got % X", apdu.frame.Data())
+	}
+	if apdu := testReadAPDU(t, b); apdu.frame.(*IFrame).SendSN != 0 || apdu.ASDU.ios[0].ioa != 2 {
+		t.Fatalf("expect the unacknowledged event on the newly started connection")
+	}
+	g.send(testSinglePoint(3, 0))
+	if apdu := testReadAPDU(t, b); apdu.ASDU.ios[0].ioa != 3 {
+		t.Fatalf("expect new events on the newly started connection")
+	}
+	// A repeated STARTDT on the started connection doesn't send the unacknowledged events again.
+	testWrite(t, b, UFrameFunctionStartDTA)
+	if apdu := testReadAPDU(t, b); apdu.frame.Data()[0] != UFrameFunctionStartDTC[0] {
+		t.Fatalf("expect StartDTC, got % X", apdu.frame.Data())
+	}
+	g.send(testSinglePoint(4, 1))
+	if apdu := testReadAPDU(t, b); apdu.frame.(*IFrame).SendSN != 2 || apdu.ASDU.ios[0].ioa != 4 {
+		t.Fatalf("expect the next event with N(S)=2 and no duplicate, got %+v", apdu.ASDU)
+	}
+}
@@ -0,0 +1,76 @@
+package iec104
+
+/*
+The controlling stations connected to the server are identified by their originator addresses (ORG). The server
+records which connection issued each command, and routes the answers sent by Server.Send only to that connection:
+  - the confirmations and terminations of the command, that is, the command mirrored with COT ActCon, DeactCon,
+    ActTerm or one of the unknown causes 44-47, and the parameters of measured values read with COT Req;
+  - the return information caused by a remote command (COT RetRem), which is routed to the connection which issued
+    the latest command to the station, with the originator address of that command;
+  - the information object requested by a read command (COT Req).
+
+The other ASDUs, such as spontaneous data, are sent to all redundancy groups.
+*/
+
+// originator is the connection which issued a command.
+type originator struct {
+	c   *Client
+	org ORG
+}
+
+// record records the connection which issued the command.
+func (s *Server) record(c *Client, asdu *ASDU) {
+	read := asdu.typeID == CRdNa1 && asdu.cot == CotReq
+	if !isControlDirection(asdu.typeID) || (asdu.cot != CotAct && asdu.cot != CotDeact && !isResponse(asdu) && !read) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commands == nil {
+		s.commands = make(map[pendingKey]originator)
+		s.origins = make(map[COA]originator)
+	}
+	o := originator{c: c, org: asdu.org}
+	s.commands[pendingKeyOf(asdu)] = o
+	s.origins[asdu.coa] = o
+}
+
+// originOf returns the connection which the ASDU answers, or nil if the ASDU is sent to all redundancy groups.
+func (s *Server) originOf(asdu *ASDU) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var o originator
+	switch {
+	case asdu.cot == CotRetRem:
+		o = s.origins[asdu.coa]
+	case isResponse(asdu):
+		o = s.commands[pendingKeyOf(asdu)]
+	case asdu.cot == CotReq && len(asdu.ios) > 0:
+		read := pendingKey{typeID: CRdNa1, coa: asdu.coa, ioa: asdu.ios[0].ioa}
+		if o = s.commands[read]; o.c != nil {
+			delete(s.commands, read) // the read command is answered
+		}
+	}
+	if o.c == nil {
+		return nil
+	}
+	if isResponse(asdu) && (asdu.cot == CotActTerm || asdu.cot >= CotUnknownType || bool(asdu.pn)) {
+		delete(s.commands, pendingKeyOf(asdu)) // the command is finished
+	}
+	asdu.org = o.org
+	return o.c
+}
+
+// forget drops the commands issued by the closed connection, s.mu is held by the caller.
+func (s *Server) forget(c *Client) {
+	for key, o := range s.commands {
+		if o.c == c {
+			delete(s.commands, key)
+		}
+	}
+	for coa, o := range s.origins {
+		if o.c == c {
+			delete(s.origins, coa)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package iec104
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_routing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	commands := make(chan *ASDU, 4)
+	go func() {
+		_ = s.Serve(listener, HandlerFunc(func(c *Client, apdu *APDU) error {
+			commands <- apdu.ASDU
+			return nil
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	connect := func(org ORG) (*Client, <-chan Event) {
+		option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+		c := NewClient(option.SetOriginatorAddress(org))
+		events := c.Events()
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(c.Close)
+		testEvent(t, events) // connected
+		return c, events
+	}
+	a, eventsA := connect(1)
+	_, eventsB := connect(2)
+
+	_ = a.SendIFrame(NewASDU(CScNa1, CotAct, 1, NewInformationObject(5, &InformationElement{Raw: []byte{0x01}})))
+	var command *ASDU
+	select {
+	case command = <-commands:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server receives no command")
+	}
+	if command.org != 1 {
+		t.Fatalf("command with ORG[%d], want 1", command.org)
+	}
+	s.Send(command.Mirror(CotActCon, false))
+	s.Send(NewASDU(MSpNa1, CotRetRem, 1, NewInformationObject(6, &InformationElement{Raw: []byte{0x01}})))
+	s.Send(testSinglePoint(7, 1))
+
+	if ev, ok := testEvent(t, eventsA).(CommandResultEvent); !ok || ev.IOA != 5 || ev.COT != CotActCon {
+		t.Errorf("expect the confirmation by the originator, got %+v", ev)
+	}
+	if ev, ok := testEvent(t, eventsA).(SinglePointEvent); !ok || ev.IOA != 6 {
+		t.Errorf("expect the return information by the originator, got %+v", ev)
+	}
+	if ev := testEvent(t, eventsA); ev.(SinglePointEvent).IOA != 7 {
+		t.Errorf("expect the spontaneous data by the originator, got %+v", ev)
+	}
+	if ev := testEvent(t, eventsB); ev.(SinglePointEvent).IOA != 7 {
+		t.Errorf("expect only the spontaneous data by the other controlling station, got %+v", ev)
+	}
+}
+
+func TestClient_ignoreOtherOriginator(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	go func() {
+		_ = s.Serve(listener, HandlerFunc(func(c *Client, apdu *APDU) error {
+			other := apdu.Mirror(CotActCon, false)
+			other.org = 9
+			_ = c.SendIFrame(other)
+			return c.SendIFrame(apdu.Mirror(CotActCon, false))
+		}))
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option.SetOriginatorAddress(3))
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testEvent(t, events) // connected
+
+	if err := c.SendGeneralInterrogation(1); err != nil {
+		t.Fatal(err)
+	}
+	if ev, ok := testEvent(t, events).(InterrogationBeginEvent); !ok {
+		t.Errorf("expect the confirmation with ORG[3] only, got %+v", ev)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
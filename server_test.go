@@ -0,0 +1,75 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type blockingHandler struct {
+	testHandler
+	release chan struct{}
+}
+
+func (h blockingHandler) GeneralInterrogationHandler(apdu *APDU) error {
+	h.apdus <- apdu
+	<-h.release
+	return nil
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("127.0.0.1:0", nil, _lg)
+	h := blockingHandler{testHandler{make(chan *APDU, 1)}, make(chan struct{})}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(listener, AdaptClientHandler(h))
+	}()
+
+	conn := testDial(t, listener.Addr().String())
+	interrogation := NewASDU(CIcNa1, CotAct, 1, NewInformationObject(0, &InformationElement{Raw: []byte{0x14}}))
+	testWrite(t, conn, append((&IFrame{}).Data(), interrogation.Data()...))
+	select {
+	case <-h.apdus:
+	case <-time.After(time.Second):
+		t.Fatal("handler is not called")
+	}
+
+	// The handler is still running.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Serve() = %v, want %v", err, ErrServerClosed)
+	}
+	testClosed(t, conn)
+
+	close(h.release)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v, want nil", err)
+	}
+	if err := s.Serve(listener, AdaptClientHandler(h)); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Serve() after Shutdown() = %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestServer_Addr(t *testing.T) {
+	s, address := testServer(t)
+	deadline := time.Now().Add(time.Second)
+	for s.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Addr() = nil")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := s.Addr().String(); got != address {
+		t.Errorf("Addr() = %s, want %s", got, address)
+	}
+}
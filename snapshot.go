@@ -0,0 +1,430 @@
+package iec104
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qualityNames are the names of the flags of the quality descriptor, in the order they are formatted.
+var qualityNames = []struct {
+	flag QualityDescriptor
+	name string
+}{
+	{IV, "IV"},
+	{NT, "NT"},
+	{SB, "SB"},
+	{BL, "BL"},
+	{OV, "OV"},
+}
+
+// Names returns the names of the flags set, IV, NT, SB, BL and OV in this order, or nil if none is set.
+func (q QualityDescriptor) Names() []string {
+	var names []string
+	for _, f := range qualityNames {
+		if q&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// ParseQuality parses the names of the flags of the quality descriptor separated by "|", such as "IV|NT", in any
+// case. The quality descriptor of an empty string is zero.
+func ParseQuality(s string) (QualityDescriptor, error) {
+	var q QualityDescriptor
+	if strings.TrimSpace(s) == "" {
+		return q, nil
+	}
+	for _, name := range strings.Split(s, "|") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		found := false
+		for _, f := range qualityNames {
+			if f.name == name {
+				q, found = q|f.flag, true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown quality %q", name)
+		}
+	}
+	return q, nil
+}
+
+// snapshotQuality is the quality descriptor of a snapshot, which is encoded in JSON as the names of its flags, while
+// QualityDescriptor itself is encoded as a number.
+type snapshotQuality QualityDescriptor
+
+// MarshalJSON encodes the quality descriptor as the names of its flags, such as ["IV","OV"].
+func (q snapshotQuality) MarshalJSON() ([]byte, error) {
+	names := QualityDescriptor(q).Names()
+	if names == nil {
+		names = []string{}
+	}
+	return json.Marshal(names)
+}
+
+// UnmarshalJSON decodes the names of the flags, or the number of the quality descriptor.
+func (q *snapshotQuality) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		var b uint8
+		if json.Unmarshal(data, &b) != nil {
+			return fmt.Errorf("quality descriptor %s is neither names nor a number", data)
+		}
+		*q = snapshotQuality(b)
+		return nil
+	}
+	parsed, err := ParseQuality(strings.Join(names, "|"))
+	if err != nil {
+		return err
+	}
+	*q = snapshotQuality(parsed)
+	return nil
+}
+
+// SnapshotFormat is the format of a snapshot of points.
+type SnapshotFormat int
+
+const (
+	SnapshotJSON SnapshotFormat = iota
+	SnapshotCSV
+)
+
+// SnapshotFormatOf returns the format of the snapshot file by its extension, .json or .csv.
+func SnapshotFormatOf(name string) (SnapshotFormat, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return SnapshotJSON, nil
+	case ".csv":
+		return SnapshotCSV, nil
+	}
+	return 0, fmt.Errorf("unknown snapshot format of %s, want .json or .csv", name)
+}
+
+/*
+SnapshotPoint is a point of a snapshot of a ProcessImage or a PointDatabase, with the interrogation groups of a point
+of a PointDatabase. A snapshot is a JSON array of objects or a CSV file with a header, whose fields are:
+  - coa, ioa: the common address and the information object address;
+  - type: the name of the type, such as M_ME_NC_1, or its number;
+  - value: the convenience value, see InformationElement.Value, from which Typed is converted by NewTypedValue;
+  - quality: the names of the flags of the quality descriptor, an array in JSON and separated by "|" in CSV;
+  - cot: the cause of transmission of the latest update;
+  - ts, received: the time tag and the time received in RFC 3339, omitted if zero;
+  - groups: the interrogation groups, an array in JSON and separated by "|" in CSV.
+
+Only coa, ioa, type and value are required, so the fixtures of the points can be written by hand:
+
+	coa,ioa,type,value,quality,groups
+	1,100,M_ME_NC_1,12.5,IV|OV,1|2
+*/
+type SnapshotPoint struct {
+	Point
+	Groups []uint8
+}
+
+// snapshotRecord is the encoding of a SnapshotPoint.
+type snapshotRecord struct {
+	COA      COA             `json:"coa"`
+	IOA      IOA             `json:"ioa"`
+	Type     string          `json:"type"`
+	Value    float64         `json:"value"`
+	Quality  snapshotQuality `json:"quality"`
+	COT      COT             `json:"cot,omitempty"`
+	Ts       string          `json:"ts,omitempty"`
+	Received string          `json:"received,omitempty"`
+	Groups   []int           `json:"groups,omitempty"`
+}
+
+// snapshotColumns are the columns of a CSV snapshot.
+var snapshotColumns = []string{"coa", "ioa", "type", "value", "quality", "cot", "ts", "received", "groups"}
+
+func (p SnapshotPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.record())
+}
+
+func (p *SnapshotPoint) UnmarshalJSON(data []byte) error {
+	var r snapshotRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	point, err := r.point()
+	if err != nil {
+		return err
+	}
+	*p = point
+	return nil
+}
+
+func (p SnapshotPoint) record() snapshotRecord {
+	r := snapshotRecord{COA: p.COA, IOA: p.IOA, Type: p.TypeID.Name(), Value: p.Value,
+		Quality: snapshotQuality(p.Quality), COT: p.COT}
+	if !p.Ts.IsZero() {
+		r.Ts = p.Ts.Format(time.RFC3339Nano)
+	}
+	if !p.Received.IsZero() {
+		r.Received = p.Received.Format(time.RFC3339Nano)
+	}
+	for _, g := range p.Groups {
+		r.Groups = append(r.Groups, int(g))
+	}
+	return r
+}
+
+func (r snapshotRecord) point() (SnapshotPoint, error) {
+	typeID, err := ParseTypeID(r.Type)
+	if err != nil {
+		return SnapshotPoint{}, err
+	}
+	typed := NewTypedValue(typeID, r.Value)
+	if _, err := NewInformationElement(typeID, typed, QualityDescriptor(r.Quality), time.Time{}); err != nil {
+		return SnapshotPoint{}, err
+	}
+	p := SnapshotPoint{Point: Point{COA: r.COA, IOA: r.IOA, TypeID: typeID, COT: r.COT, Value: r.Value, Typed: typed,
+		Quality: QualityDescriptor(r.Quality)}}
+	if p.Ts, err = parseSnapshotTime(r.Ts); err != nil {
+		return SnapshotPoint{}, err
+	}
+	if p.Received, err = parseSnapshotTime(r.Received); err != nil {
+		return SnapshotPoint{}, err
+	}
+	for _, g := range r.Groups {
+		if g < 1 || g > 16 {
+			return SnapshotPoint{}, fmt.Errorf("interrogation group %d is out of range 1-16", g)
+		}
+		p.Groups = append(p.Groups, uint8(g))
+	}
+	return p, nil
+}
+
+func parseSnapshotTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// EncodeSnapshot writes the points in the format.
+func EncodeSnapshot(w io.Writer, format SnapshotFormat, points []SnapshotPoint) error {
+	if format == SnapshotJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if points == nil {
+			points = []SnapshotPoint{}
+		}
+		return enc.Encode(points)
+	}
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(snapshotColumns)
+	for _, p := range points {
+		r := p.record()
+		groups := make([]string, len(r.Groups))
+		for i, g := range r.Groups {
+			groups[i] = strconv.Itoa(g)
+		}
+		_ = cw.Write([]string{
+			strconv.FormatUint(uint64(r.COA), 10),
+			strconv.FormatUint(uint64(r.IOA), 10),
+			r.Type,
+			strconv.FormatFloat(r.Value, 'g', -1, 64),
+			strings.Join(QualityDescriptor(r.Quality).Names(), "|"),
+			strconv.Itoa(int(r.COT)),
+			r.Ts,
+			r.Received,
+			strings.Join(groups, "|"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// DecodeSnapshot reads the points in the format, see SnapshotPoint.
+func DecodeSnapshot(r io.Reader, format SnapshotFormat) ([]SnapshotPoint, error) {
+	if format == SnapshotJSON {
+		var points []SnapshotPoint
+		if err := json.NewDecoder(r).Decode(&points); err != nil {
+			return nil, fmt.Errorf("decode snapshot: %w", err)
+		}
+		return points, nil
+	}
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("decode snapshot header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !containsString(snapshotColumns, name) {
+			return nil, fmt.Errorf("unknown snapshot column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range snapshotColumns[:4] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("snapshot without column %q", name)
+		}
+	}
+
+	var points []SnapshotPoint
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode snapshot: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		p, err := decodeSnapshotRecord(columns, fields)
+		if err != nil {
+			return nil, fmt.Errorf("decode snapshot line %d: %w", line, err)
+		}
+		points = append(points, p)
+	}
+}
+
+// decodeSnapshotRecord decodes the fields of a CSV record by the indexes of its columns.
+func decodeSnapshotRecord(columns map[string]int, fields []string) (SnapshotPoint, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+	var r snapshotRecord
+	coa, err := strconv.ParseUint(field("coa"), 10, 16)
+	if err != nil {
+		return SnapshotPoint{}, fmt.Errorf("coa: %w", err)
+	}
+	ioa, err := strconv.ParseUint(field("ioa"), 10, 24)
+	if err != nil {
+		return SnapshotPoint{}, fmt.Errorf("ioa: %w", err)
+	}
+	r.COA, r.IOA, r.Type = COA(coa), IOA(ioa), field("type")
+	if r.Value, err = strconv.ParseFloat(field("value"), 64); err != nil {
+		return SnapshotPoint{}, fmt.Errorf("value: %w", err)
+	}
+	q, err := ParseQuality(field("quality"))
+	if err != nil {
+		return SnapshotPoint{}, err
+	}
+	r.Quality = snapshotQuality(q)
+	if s := field("cot"); s != "" {
+		cot, err := strconv.ParseUint(s, 10, 6)
+		if err != nil {
+			return SnapshotPoint{}, fmt.Errorf("cot: %w", err)
+		}
+		r.COT = COT(cot)
+	}
+	r.Ts, r.Received = field("ts"), field("received")
+	if s := field("groups"); s != "" {
+		for _, g := range strings.Split(s, "|") {
+			group, err := strconv.Atoi(strings.TrimSpace(g))
+			if err != nil {
+				return SnapshotPoint{}, fmt.Errorf("groups: %w", err)
+			}
+			r.Groups = append(r.Groups, group)
+		}
+	}
+	return r.point()
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteSnapshot writes all the points of the process image in the format, sorted like Snapshot.
+func (pi *ProcessImage) WriteSnapshot(w io.Writer, format SnapshotFormat) error {
+	points := pi.Snapshot()
+	snapshot := make([]SnapshotPoint, len(points))
+	for i, p := range points {
+		snapshot[i] = SnapshotPoint{Point: p}
+	}
+	return EncodeSnapshot(w, format, snapshot)
+}
+
+// ReadSnapshot reads the points in the format into the process image, for example, to restore the latest state of the
+// stations before they are interrogated. The points replace those of the same key, and are received now unless their
+// time received is in the snapshot.
+func (pi *ProcessImage) ReadSnapshot(r io.Reader, format SnapshotFormat) error {
+	points, err := DecodeSnapshot(r, format)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+	for _, p := range points {
+		if p.Received.IsZero() {
+			p.Received = now
+		}
+		pi.points[p.Key()] = p.Point
+	}
+	return nil
+}
+
+// WriteSnapshot writes all the points of the database with their interrogation groups in the format, sorted like
+// Points.
+func (db *PointDatabase) WriteSnapshot(w io.Writer, format SnapshotFormat) error {
+	db.mu.RLock()
+	snapshot := make([]SnapshotPoint, 0, len(db.points))
+	for _, p := range db.points {
+		snapshot = append(snapshot, SnapshotPoint{Point: p.Point, Groups: append([]uint8(nil), p.groups...)})
+	}
+	db.mu.RUnlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].COA != snapshot[j].COA {
+			return snapshot[i].COA < snapshot[j].COA
+		}
+		return snapshot[i].IOA < snapshot[j].IOA
+	})
+	return EncodeSnapshot(w, format, snapshot)
+}
+
+// ReadSnapshot reads the points in the format into the database, which are added with their interrogation groups by
+// Add.
+func (db *PointDatabase) ReadSnapshot(r io.Reader, format SnapshotFormat) error {
+	points, err := DecodeSnapshot(r, format)
+	if err != nil {
+		return err
+	}
+	for _, p := range points {
+		db.Add(p.Point, p.Groups...)
+	}
+	return nil
+}
+
+// LoadPointDatabase loads the initial points of a Server from the snapshot file, whose format is given by its
+// extension, see SnapshotFormatOf.
+func LoadPointDatabase(name string) (*PointDatabase, error) {
+	format, err := SnapshotFormatOf(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db := NewPointDatabase()
+	if err := db.ReadSnapshot(f, format); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return db, nil
+}
@@ -0,0 +1,154 @@
+package iec104
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQualityDescriptor_Names(t *testing.T) {
+	tests := []struct {
+		q    QualityDescriptor
+		s    string
+		json string
+	}{
+		{0, "", "[]"},
+		{IV, "IV", `["IV"]`},
+		{IV | NT | SB | BL | OV, "IV|NT|SB|BL|OV", `["IV","NT","SB","BL","OV"]`},
+	}
+	for _, tt := range tests {
+		if s := strings.Join(tt.q.Names(), "|"); s != tt.s {
+			t.Errorf("Names() of %X = %q, want %q", tt.q, s, tt.s)
+		}
+		if q, err := ParseQuality(strings.ToLower(tt.s)); err != nil || q != tt.q {
+			t.Errorf("ParseQuality(%q) = %X, %v, want %X", tt.s, q, err, tt.q)
+		}
+		if data, err := json.Marshal(snapshotQuality(tt.q)); err != nil || string(data) != tt.json {
+			t.Errorf("json.Marshal(%X) = %s, %v, want %s", tt.q, data, err, tt.json)
+		}
+		var q snapshotQuality
+		if err := json.Unmarshal([]byte(tt.json), &q); err != nil || QualityDescriptor(q) != tt.q {
+			t.Errorf("json.Unmarshal(%s) = %X, %v, want %X", tt.json, q, err, tt.q)
+		}
+	}
+	var q snapshotQuality
+	if err := json.Unmarshal([]byte("129"), &q); err != nil || QualityDescriptor(q) != IV|OV {
+		t.Errorf("json.Unmarshal(129) = %X, %v, want the number of the quality descriptor", q, err)
+	}
+	if data, err := json.Marshal(IV | OV); err != nil || string(data) != "129" {
+		t.Errorf("json.Marshal(IV|OV) = %s, %v, want the number outside of snapshots", data, err)
+	}
+	if _, err := ParseQuality("IV|XX"); err == nil {
+		t.Errorf("ParseQuality() of an unknown flag must fail")
+	}
+}
+
+func TestLoadPointDatabase(t *testing.T) {
+	csvDB, err := LoadPointDatabase("testdata/points.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonDB, err := LoadPointDatabase("testdata/points.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(csvDB.Points(), jsonDB.Points()) || len(csvDB.Points()) != 7 {
+		t.Fatalf("the fixtures differ: %+v, %+v", csvDB.Points(), jsonDB.Points())
+	}
+	p, ok := csvDB.Point(1, 101)
+	if !ok || p.TypeID != MMeNc1 || p.Typed != Float(10.5) || p.Quality != IV|OV {
+		t.Errorf("Point(1, 101) = %+v, %v", p, ok)
+	}
+	if p, _ := csvDB.Point(1, 200); p.Typed != (BinaryCounter{Value: 1234}) {
+		t.Errorf("Point(1, 200).Typed = %+v, want the counter of 12.34", p.Typed)
+	}
+	if p := csvDB.points[pointAddress{1, 100}]; !reflect.DeepEqual(p.groups, []uint8{1, 2}) {
+		t.Errorf("groups of IOA 100 = %v, want [1 2]", p.groups)
+	}
+	if _, err := LoadPointDatabase("testdata/points.txt"); err == nil {
+		t.Errorf("LoadPointDatabase() of an unknown format must fail")
+	}
+}
+
+func TestPointDatabase_WriteSnapshot(t *testing.T) {
+	db, err := LoadPointDatabase("testdata/points.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Update(CotSpont, 1, 100, Float(121.5), OV); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []SnapshotFormat{SnapshotJSON, SnapshotCSV} {
+		var buf bytes.Buffer
+		if err := db.WriteSnapshot(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		written := buf.String()
+		restored := NewPointDatabase()
+		if err := restored.ReadSnapshot(&buf, format); err != nil {
+			t.Fatalf("ReadSnapshot(%d) error = %v", format, err)
+		}
+		if err := restored.WriteSnapshot(&buf, format); err != nil || buf.String() != written {
+			t.Errorf("ReadSnapshot(%d) = %s, %v, want %s", format, buf.String(), err, written)
+		}
+	}
+}
+
+func TestProcessImage_WriteSnapshot(t *testing.T) {
+	pi := newProcessImage(0)
+	now := time.Now()
+	ie, err := NewInformationElement(MMeTf1, Float(2.5), SB, now.Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi.update(testParseASDU(t, NewASDU(MMeTf1, CotSpont, 1, NewInformationObject(100, ie))).ASDU, now)
+
+	var buf bytes.Buffer
+	if err := pi.WriteSnapshot(&buf, SnapshotJSON); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"type": "M_ME_TF_1"`, `"value": 2.5`, `"SB"`, `"cot": 3`, `"ts": "`,
+		`"received": "` + now.Format(time.RFC3339Nano) + `"`} {
+		if !strings.Contains(buf.String(), field) {
+			t.Errorf("WriteSnapshot() = %s, want %s", buf.String(), field)
+		}
+	}
+	restored := newProcessImage(0)
+	if err := restored.ReadSnapshot(&buf, SnapshotJSON); err != nil {
+		t.Fatal(err)
+	}
+	got, want := restored.Snapshot(), pi.Snapshot()
+	if len(got) != 1 || !got[0].Ts.Equal(want[0].Ts) || !got[0].Received.Equal(want[0].Received) ||
+		got[0].Typed != want[0].Typed || got[0].Quality != SB || got[0].COT != CotSpont {
+		t.Errorf("ReadSnapshot() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		format SnapshotFormat
+		data   string
+		err    string
+	}{
+		{"unknown column", SnapshotCSV, "coa,ioa,type,value,color\n1,1,M_SP_NA_1,1,red\n", "unknown snapshot column"},
+		{"missing column", SnapshotCSV, "coa,ioa,type\n1,1,M_SP_NA_1\n", `without column "value"`},
+		{"unknown type", SnapshotCSV, "coa,ioa,type,value\n1,1,M_XX_NA_1,1\n", "line 2"},
+		{"command type", SnapshotCSV, "coa,ioa,type,value\n1,1,C_SC_NA_1,1\n", "line 2"},
+		{"unknown quality", SnapshotCSV, "coa,ioa,type,value,quality\n1,1,M_SP_NA_1,1,XX\n", "unknown quality"},
+		{"group", SnapshotCSV, "coa,ioa,type,value,groups\n1,1,M_SP_NA_1,1,17\n", "out of range"},
+		{"time", SnapshotJSON, `[{"coa":1,"ioa":1,"type":"M_SP_TB_1","value":1,"ts":"yesterday"}]`, "yesterday"},
+		{"quality", SnapshotJSON, `[{"coa":1,"ioa":1,"type":"M_SP_NA_1","value":1,"quality":{}}]`, "quality"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeSnapshot(strings.NewReader(tt.data), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("DecodeSnapshot() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
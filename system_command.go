@@ -0,0 +1,131 @@
+package iec104
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ResetQualifier is the qualifier of reset process command (QRP).
+type ResetQualifier uint8
+
+const (
+	ResetGeneral     ResetQualifier = 1 // general reset of process
+	ResetEventBuffer ResetQualifier = 2 // reset of pending information with time tag of the event buffer
+)
+
+// FixedTestBitPattern is the fixed test bit pattern (FBP) of the test command CTsNb1.
+const FixedTestBitPattern uint16 = 0x55aa
+
+// SendResetProcess resets the process of the station, or of all the stations if coa is GlobalCOA, and waits for the
+// confirmation. The station announces the end of its initialization (MEiNa1) after the general reset.
+func (c *Client) SendResetProcess(ctx context.Context, coa COA, qrp ResetQualifier) error {
+	_, err := c.exchange(ctx, NewASDU(CRpNc1, CotAct, coa, NewInformationObject(0, &InformationElement{
+		Format: InformationElementFormat{QRP},
+		Raw:    []byte{byte(qrp)},
+	})))
+	return err
+}
+
+// SendTestCommand sends the test command with time tag (CTsTa1) to the station, which carries the next test sequence
+// counter (TSC) and the current time. It verifies that the station echoes both, and returns the round-trip time.
+func (c *Client) SendTestCommand(ctx context.Context, coa COA) (time.Duration, error) {
+	tsc := uint16(atomic.AddUint32(&c.tsc, 1))
+	raw := append(serializeLittleEndianUint16(tsc), serializeCP56Time2a(time.Now())...)
+	return c.test(ctx, NewASDU(CTsTa1, CotAct, coa, NewInformationObject(0, &InformationElement{
+		Format: InformationElementFormat{TSC, CP56Time2a},
+		Raw:    raw,
+	})))
+}
+
+// SendTestCommandWithoutTime sends the test command (CTsNb1) of IEC 101 with the fixed test bit pattern (FBP) to the
+// station. It verifies that the station echoes the pattern, and returns the round-trip time.
+func (c *Client) SendTestCommandWithoutTime(ctx context.Context, coa COA) (time.Duration, error) {
+	return c.test(ctx, NewASDU(CTsNb1, CotAct, coa, NewInformationObject(0, &InformationElement{
+		Format: InformationElementFormat{FBP},
+		Raw:    serializeLittleEndianUint16(FixedTestBitPattern),
+	})))
+}
+
+// test sends the test command and verifies that its confirmation echoes the information element.
+func (c *Client) test(ctx context.Context, asdu *ASDU) (time.Duration, error) {
+	sent := asdu.ios[0].ies[0].Raw
+	start := time.Now()
+	con, err := c.exchange(ctx, asdu)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	if len(con.Signals) == 0 {
+		return rtt, errors.New("test command confirmed without information object")
+	}
+	if echoed := con.Signals[0].Raw; !bytes.Equal(echoed, sent) {
+		if asdu.typeID == CTsTa1 && len(echoed) >= 2 {
+			return rtt, fmt.Errorf("test command confirmed with TSC[%d], want %d",
+				parseLittleEndianUint16(echoed), parseLittleEndianUint16(sent))
+		}
+		return rtt, fmt.Errorf("test command confirmed with [% X], want [% X]", echoed, sent)
+	}
+	return rtt, nil
+}
+
+// ServeTestCommand is the handler of the test commands CTsNb1 and CTsTa1 of a controlled station. It confirms the
+// test command by echoing its information object, and negatively if the fixed test bit pattern is wrong.
+func ServeTestCommand(c *Client, apdu *APDU) error {
+	if apdu.cot != CotAct {
+		return c.SendIFrame(apdu.Mirror(CotUnknownCause, true))
+	}
+	negative := len(apdu.Signals) == 0
+	if !negative && apdu.typeID == CTsNb1 {
+		negative = uint16(apdu.Signals[0].Value) != FixedTestBitPattern
+	}
+	return c.SendIFrame(apdu.Mirror(CotActCon, negative))
+}
+
+/*
+ResetProcess returns the handler of the reset process command CRpNc1 of a controlled station, which calls reset with
+the common address and the qualifier of the command, and confirms the command negatively if reset fails. The common
+address is GlobalCOA if all the stations are reset. After the reset is confirmed:
+  - the general reset is followed by the end of initialization with CoiRemoteReset of the station, or of the stations
+    set by Server.SetEndOfInitialization for the global address;
+  - the reset of the event buffer drops the events which the controlling stations have not acknowledged.
+*/
+func ResetProcess(reset func(coa COA, qrp ResetQualifier) error) HandlerFunc {
+	return func(c *Client, apdu *APDU) error {
+		if apdu.cot != CotAct {
+			return c.SendIFrame(apdu.Mirror(CotUnknownCause, true))
+		}
+		qrp := ResetGeneral
+		if len(apdu.Signals) > 0 {
+			qrp = ResetQualifier(apdu.Signals[0].Value)
+		}
+		if qrp != ResetGeneral && qrp != ResetEventBuffer {
+			return c.SendIFrame(apdu.Mirror(CotActCon, true))
+		}
+		if err := reset(apdu.coa, qrp); err != nil {
+			_ = c.SendIFrame(apdu.Mirror(CotActCon, true))
+			return err
+		}
+		if err := c.SendIFrame(apdu.Mirror(CotActCon, false)); err != nil {
+			return err
+		}
+
+		switch {
+		case c.srv == nil:
+		case qrp == ResetEventBuffer:
+			for _, g := range c.srv.redundancyGroups() {
+				g.clear()
+			}
+		case apdu.coa != GlobalCOA:
+			c.srv.SendEndOfInitialization(apdu.coa, CoiRemoteReset)
+		default:
+			for _, coa := range c.srv.initializedStations() {
+				c.srv.SendEndOfInitialization(coa, CoiRemoteReset)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package iec104
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_systemCommands(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener.Addr().String(), nil, _lg)
+	resets := make(chan ResetQualifier, 2)
+	mux := NewServeMux().
+		HandleRoute(Route{TypeIDs: []TypeID{CTsTa1}, COAs: []COA{2}}, HandlerFunc(func(c *Client, apdu *APDU) error {
+			con := apdu.Mirror(CotActCon, false)
+			raw := append([]byte{}, apdu.Signals[0].Raw...)
+			raw[0]++ // a wrong test sequence counter
+			con.ios = []*InformationObject{NewInformationObject(0, &InformationElement{Raw: raw})}
+			return c.SendIFrame(con)
+		})).
+		Handle(CTsTa1, ServeTestCommand).
+		Handle(CTsNb1, ServeTestCommand).
+		Handle(CRpNc1, ResetProcess(func(coa COA, qrp ResetQualifier) error {
+			if coa == 3 {
+				return errors.New("reset failed")
+			}
+			resets <- qrp
+			return nil
+		}))
+	go func() { _ = s.Serve(listener, mux) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	option, _ := NewClientOption(listener.Addr().String(), nil, time.Second)
+	c := NewClient(option)
+	events := c.Events()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testEvent(t, events) // connected
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if rtt, err := c.SendTestCommand(ctx, 1); err != nil || rtt <= 0 {
+			t.Errorf("SendTestCommand() = %v, %v", rtt, err)
+		}
+	}
+	if c.tsc != 2 {
+		t.Errorf("test sequence counter is %d after 2 test commands, want 2", c.tsc)
+	}
+	if _, err := c.SendTestCommandWithoutTime(ctx, 1); err != nil {
+		t.Errorf("SendTestCommandWithoutTime() error = %v", err)
+	}
+	if _, err := c.SendTestCommand(ctx, 2); err == nil {
+		t.Errorf("SendTestCommand() must fail if the station echoes another TSC")
+	}
+
+	if err := c.SendResetProcess(ctx, 1, ResetGeneral); err != nil {
+		t.Fatalf("SendResetProcess() error = %v", err)
+	}
+	if qrp := <-resets; qrp != ResetGeneral {
+		t.Errorf("reset with QRP[%d], want %d", qrp, ResetGeneral)
+	}
+	for {
+		if ev, ok := testEvent(t, events).(EndOfInitializationEvent); ok {
+			if ev.COA != 1 || ev.Cause != CoiRemoteReset {
+				t.Errorf("expect the end of initialization after the remote reset, got %+v", ev)
+			}
+			break
+		}
+	}
+	if err := c.SendResetProcess(ctx, 3, ResetGeneral); err == nil {
+		t.Errorf("SendResetProcess() must fail if the reset fails")
+	}
+	if err := c.SendResetProcess(ctx, 1, 9); err == nil {
+		t.Errorf("SendResetProcess() with an unknown qualifier must fail")
+	}
+}
@@ -0,0 +1,265 @@
+package iec104
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+TLSProfile is the mutual TLS profile of IEC 62351-3 for IEC 104 connections.
+
+  - Only TLS 1.2 and later are used, and TLS 1.2 is restricted to the ECDHE cipher suites with AES-GCM.
+  - Both sides are authenticated by certificates issued by CAs: the controlled station requires a client certificate.
+  - The certificates of the peer are checked against the certificate revocation list in CRLFile, which is read again
+    whenever the file changes.
+  - Go doesn't support TLS renegotiation initiated by the server nor sending TLS 1.3 key updates. Instead, if
+    RenegotiationInterval is not zero, the controlled station closes every session once the interval has elapsed, and
+    the controlling station has to connect again, with a full handshake since session resumption is disabled. This
+    interrupts the data transfer: the unacknowledged APDUs are lost and the controlling station has to interrogate the
+    station again. Zero, the default, never closes the sessions.
+  - COAs maps the identity of the controlling station, which is either the common name or a DNS name of its
+    certificate, to the common addresses it may control, which are further restricted to the common addresses of its
+    client policy. Controlling stations whose identity is not in the map, or which may control no common address, are
+    rejected unless the map is empty.
+*/
+type TLSProfile struct {
+	Certificates          []tls.Certificate
+	CAs                   *x509.CertPool
+	CRLFile               string
+	RenegotiationInterval time.Duration
+	COAs                  map[string][]COA
+
+	mu       sync.Mutex
+	crlMod   time.Time
+	crlLists []*x509.RevocationList
+}
+
+// TLSCipherSuites are the cipher suites of TLS 1.2 allowed by the profile.
+var TLSCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+var errCertificateRevoked = errors.New("certificate is revoked")
+
+// ServerConfig returns the TLS configuration of the controlled station.
+func (p *TLSProfile) ServerConfig() (*tls.Config, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	tc := p.config()
+	tc.ClientAuth = tls.RequireAndVerifyClientCert
+	tc.ClientCAs = p.CAs
+	return tc, nil
+}
+
+// ClientConfig returns the TLS configuration of the controlling station connecting to the server name.
+func (p *TLSProfile) ClientConfig(serverName string) (*tls.Config, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	tc := p.config()
+	tc.RootCAs = p.CAs
+	tc.ServerName = serverName
+	return tc, nil
+}
+
+func (p *TLSProfile) check() error {
+	if len(p.Certificates) == 0 {
+		return errors.New("tls profile: certificate is required")
+	}
+	if p.CAs == nil {
+		return errors.New("tls profile: CAs are required")
+	}
+	if p.CRLFile != "" {
+		if _, err := p.revocationLists(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *TLSProfile) config() *tls.Config {
+	return &tls.Config{
+		MinVersion:             tls.VersionTLS12,
+		CipherSuites:           TLSCipherSuites,
+		Certificates:           p.Certificates,
+		SessionTicketsDisabled: true,
+		VerifyPeerCertificate: func(_ [][]byte, chains [][]*x509.Certificate) error {
+			return p.verifyRevocation(chains)
+		},
+	}
+}
+
+// verifyRevocation fails if any certificate of the verified chains is revoked by a CRL signed by its issuer.
+func (p *TLSProfile) verifyRevocation(chains [][]*x509.Certificate) error {
+	if p.CRLFile == "" {
+		return nil
+	}
+	lists, err := p.revocationLists()
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		for i := 0; i+1 < len(chain); i++ {
+			cert, issuer := chain[i], chain[i+1]
+			for _, list := range lists {
+				if list.CheckSignatureFrom(issuer) != nil {
+					continue
+				}
+				if !list.NextUpdate.IsZero() && time.Now().After(list.NextUpdate) {
+					_lg.Warnf("tls profile: CRL of %s has expired", issuer.Subject)
+				}
+				for _, revoked := range list.RevokedCertificates {
+					if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+						return fmt.Errorf("%w: %s", errCertificateRevoked, cert.Subject)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// revocationLists returns the CRLs in CRLFile (PEM or DER), which are read again if the file is modified.
+func (p *TLSProfile) revocationLists() ([]*x509.RevocationList, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.CRLFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls profile: %w", err)
+	}
+	if p.crlLists != nil && info.ModTime().Equal(p.crlMod) {
+		return p.crlLists, nil
+	}
+	data, err := os.ReadFile(p.CRLFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls profile: %w", err)
+	}
+	lists := make([]*x509.RevocationList, 0)
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		list, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("tls profile: parse CRL: %w", err)
+		}
+		lists = append(lists, list)
+	}
+	if len(lists) == 0 {
+		list, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("tls profile: parse CRL: %w", err)
+		}
+		lists = append(lists, list)
+	}
+	p.crlMod, p.crlLists = info.ModTime(), lists
+	return lists, nil
+}
+
+// Identity returns the identities of the certificate: its common name and DNS names.
+func Identity(cert *x509.Certificate) []string {
+	ids := make([]string, 0, 1+len(cert.DNSNames))
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return append(ids, cert.DNSNames...)
+}
+
+// coasOf returns the common addresses which the owner of the certificate may control. ok is false if the owner is not
+// in the map.
+func (p *TLSProfile) coasOf(cert *x509.Certificate) (coas []COA, ok bool) {
+	if len(p.COAs) == 0 {
+		return nil, true
+	}
+	for _, id := range Identity(cert) {
+		if coas, ok := p.COAs[id]; ok {
+			return coas, true
+		}
+	}
+	return nil, false
+}
+
+// SetTLSProfile secures the connections by the TLS profile, the certificate identity of each controlling station
+// restricts the common addresses in its policy.
+func (s *Server) SetTLSProfile(p *TLSProfile) error {
+	tc, err := p.ServerConfig()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tc, s.tlsProfile = tc, p
+	return nil
+}
+
+// SetTLSProfile secures the connection by the TLS profile, serverName is verified against the server certificate.
+func (o *ClientOption) SetTLSProfile(p *TLSProfile, serverName string) error {
+	tc, err := p.ClientConfig(serverName)
+	if err != nil {
+		return err
+	}
+	o.tc = tc
+	o.server.Scheme = "tls"
+	return nil
+}
+
+// handshake completes the TLS handshake of the connection, and applies the certificate identity of the controlling
+// station to the policy.
+func (s *Server) handshake(conn *tls.Conn, policy *ClientPolicy) (*ClientPolicy, error) {
+	_ = conn.SetDeadline(time.Now().Add(DefaultT1))
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	s.mu.Lock()
+	p := s.tlsProfile
+	s.mu.Unlock()
+	if p == nil || len(p.COAs) == 0 {
+		return policy, nil
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no client certificate")
+	}
+	coas, ok := p.coasOf(certs[0])
+	if !ok {
+		return nil, fmt.Errorf("certificate identity %v is not allowed", Identity(certs[0]))
+	}
+	restricted := &ClientPolicy{COAs: coas}
+	if policy != nil {
+		restricted.Commands = policy.Commands
+		if len(policy.COAs) > 0 {
+			restricted.COAs = intersectCOAs(coas, policy.COAs)
+		}
+	}
+	// an empty list allows every common address in a policy, so the identity which may control none is rejected
+	if len(restricted.COAs) == 0 {
+		return nil, fmt.Errorf("certificate identity %v may control no common address", Identity(certs[0]))
+	}
+	return restricted, nil
+}
+
+// intersectCOAs returns the common addresses of a which are also in b.
+func intersectCOAs(a, b []COA) []COA {
+	coas := make([]COA, 0, len(a))
+	for _, coa := range a {
+		if containsCOA(b, coa) {
+			coas = append(coas, coa)
+		}
+	}
+	return coas
+}
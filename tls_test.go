@@ -0,0 +1,214 @@
+package iec104
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testPKI struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return &testPKI{ca: ca, caKey: key, pool: pool, serial: 1}
+}
+
+func (pki *testPKI) issue(t *testing.T, name string) (tls.Certificate, *big.Int) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(pki.serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, pki.ca, &key.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, template.SerialNumber
+}
+
+func (pki *testPKI) writeCRL(t *testing.T, revoked ...*big.Int) string {
+	list := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range revoked {
+		list.RevokedCertificates = append(list.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, list, pki.ca, pki.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "ca.crl")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// testTLSServer serves the controlled station secured by the profile on an ephemeral port, with the client policy of
+// the local controlling stations if any.
+func testTLSServer(t *testing.T, profile *TLSProfile, policy *ClientPolicy) string {
+	s := NewServer("127.0.0.1:0", nil, _lg)
+	if err := s.SetTLSProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	if policy != nil {
+		if err := s.SetClientPolicy("127.0.0.1", policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", s.tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = s.Serve(listener, nil)
+	}()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return listener.Addr().String()
+}
+
+func testTLSDial(t *testing.T, address string, tc *tls.Config) net.Conn {
+	conn, err := tls.Dial("tcp", address, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestTLSProfile(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, _ := pki.issue(t, "outstation")
+	allowedCert, _ := pki.issue(t, "scada-a")
+	unknownCert, _ := pki.issue(t, "scada-b")
+	revokedCert, revokedSerial := pki.issue(t, "scada-a")
+
+	address := testTLSServer(t, &TLSProfile{
+		Certificates:          []tls.Certificate{serverCert},
+		CAs:                   pki.pool,
+		CRLFile:               pki.writeCRL(t, revokedSerial),
+		RenegotiationInterval: 500 * time.Millisecond,
+		COAs:                  map[string][]COA{"scada-a": {1}},
+	}, nil)
+	clientConfig := func(cert tls.Certificate) *tls.Config {
+		tc, err := (&TLSProfile{Certificates: []tls.Certificate{cert}, CAs: pki.pool}).ClientConfig("outstation")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tc
+	}
+
+	t.Run("certificate identity restricts common addresses", func(t *testing.T) {
+		conn := testTLSDial(t, address, clientConfig(allowedCert))
+		command := NewASDU(CScNa1, CotAct, 2, NewInformationObject(5, &InformationElement{Raw: []byte{0x81}}))
+		testWrite(t, conn, append((&IFrame{}).Data(), command.Data()...))
+		if apdu := testReadAPDU(t, conn); apdu.ASDU == nil || apdu.cot != CotActCon || !apdu.pn {
+			t.Fatalf("expect negative activation confirmation for COA 2")
+		}
+		testClosed(t, conn) // the session expires
+	})
+	t.Run("unknown identity", func(t *testing.T) {
+		testClosedTLS(t, testTLSDial(t, address, clientConfig(unknownCert)))
+	})
+	t.Run("revoked certificate", func(t *testing.T) {
+		testClosedTLS(t, testTLSDial(t, address, clientConfig(revokedCert)))
+	})
+	t.Run("client policy restricts common addresses", func(t *testing.T) {
+		cert, _ := pki.issue(t, "scada-c")
+		emptyCert, _ := pki.issue(t, "scada-d")
+		address := testTLSServer(t, &TLSProfile{
+			Certificates: []tls.Certificate{serverCert},
+			CAs:          pki.pool,
+			COAs:         map[string][]COA{"scada-a": {1, 2}, "scada-c": {2}, "scada-d": {}},
+		}, &ClientPolicy{COAs: []COA{1, 3}})
+
+		conn := testTLSDial(t, address, clientConfig(allowedCert))
+		command := NewASDU(CScNa1, CotAct, 2, NewInformationObject(5, &InformationElement{Raw: []byte{0x81}}))
+		testWrite(t, conn, append((&IFrame{}).Data(), command.Data()...))
+		if apdu := testReadAPDU(t, conn); apdu.ASDU == nil || apdu.cot != CotActCon || !apdu.pn {
+			t.Fatalf("expect negative activation confirmation for COA 2 outside the client policy")
+		}
+		testClosedTLS(t, testTLSDial(t, address, clientConfig(cert)))
+		testClosedTLS(t, testTLSDial(t, address, clientConfig(emptyCert)))
+	})
+	t.Run("TLS 1.1", func(t *testing.T) {
+		tc := clientConfig(allowedCert)
+		tc.MinVersion, tc.MaxVersion = tls.VersionTLS11, tls.VersionTLS11
+		if conn, err := tls.Dial("tcp", address, tc); err == nil {
+			_ = conn.Close()
+			t.Fatalf("TLS 1.1 must be rejected")
+		}
+	})
+}
+
+// testClosedTLS checks that the server ended the TLS session, either by an alert or by closing the connection.
+func testClosedTLS(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expect the session to be rejected")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Errorf("expect the session to be rejected, got %v", err)
+	}
+}
+
+func TestTLSProfile_check(t *testing.T) {
+	if _, err := (&TLSProfile{}).ServerConfig(); err == nil {
+		t.Errorf("ServerConfig() without certificate should fail")
+	}
+	pki := newTestPKI(t)
+	cert, _ := pki.issue(t, "outstation")
+	p := &TLSProfile{Certificates: []tls.Certificate{cert}, CAs: pki.pool, CRLFile: "missing.crl"}
+	if _, err := p.ServerConfig(); err == nil {
+		t.Errorf("ServerConfig() with missing CRL file should fail")
+	}
+}
@@ -0,0 +1,251 @@
+package iec104
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+/*
+TypedValue is the value of an information element decoded by its type, it is one of SinglePoint, DoublePoint,
+Normalized, Scaled, Float, BinaryCounter and Command. Float64 converts it to the convenience value of
+InformationElement.Value, except BinaryCounter whose convenience value is scaled by 0.01 and Command whose
+convenience value is the raw command byte.
+*/
+type TypedValue interface {
+	Float64() float64
+}
+
+// SinglePoint is the state of a single point information (SPI): ON (true) or OFF (false).
+type SinglePoint bool
+
+func (sp SinglePoint) Float64() float64 {
+	if sp {
+		return 1
+	}
+	return 0
+}
+
+// DoublePoint is the state of a double point information (DPI).
+type DoublePoint uint8
+
+const (
+	DoublePointIntermediate  DoublePoint = 0 // intermediate state
+	DoublePointOff           DoublePoint = 1 // determined state OFF
+	DoublePointOn            DoublePoint = 2 // determined state ON
+	DoublePointIndeterminate DoublePoint = 3 // indeterminate or faulty state
+)
+
+func (dp DoublePoint) Float64() float64 {
+	return float64(dp)
+}
+
+func (dp DoublePoint) String() string {
+	switch dp {
+	case DoublePointIntermediate:
+		return "intermediate"
+	case DoublePointOff:
+		return "off"
+	case DoublePointOn:
+		return "on"
+	default:
+		return "indeterminate"
+	}
+}
+
+// Normalized is a normalized value (NVA), a fixed point number in the range [-1, 1-2^-15].
+type Normalized int16
+
+func (n Normalized) Float64() float64 {
+	return float64(n) / 32768
+}
+
+// Scaled is a scaled value (SVA), whose decimal point is fixed by the configuration of the system.
+type Scaled int16
+
+func (s Scaled) Float64() float64 {
+	return float64(s)
+}
+
+// Float is a short floating point number (IEEE 754).
+type Float float32
+
+func (f Float) Float64() float64 {
+	return float64(f)
+}
+
+// BinaryCounter is the binary counter reading (BCR) of an integrated total.
+type BinaryCounter struct {
+	Value    int32
+	Seq      uint8 // sequence number, 0-31
+	Carry    bool  // CY: the counter overflowed in the integration period
+	Adjusted bool  // CA: the counter was adjusted in the integration period
+	Invalid  bool  // IV
+}
+
+func (bc BinaryCounter) Float64() float64 {
+	return float64(bc.Value)
+}
+
+// parseBinaryCounter parses the 5-byte binary counter reading.
+func parseBinaryCounter(data []byte) BinaryCounter {
+	return BinaryCounter{
+		Value:    parseLittleEndianInt32(data[0:4]),
+		Seq:      data[4] & 0x1f,
+		Carry:    data[4]&0x20 != 0,
+		Adjusted: data[4]&0x40 != 0,
+		Invalid:  data[4]&0x80 != 0,
+	}
+}
+
+// Command is a single (SCO), double (DCO) or regulating step (RCO) command.
+type Command struct {
+	On        bool  // ON of a single or double command, next step higher of a regulating step command
+	Select    bool  // S/E: select (true) or execute (false)
+	Qualifier uint8 // QU: 0 no additional definition, 1 short pulse, 2 long pulse, 3 persistent output
+}
+
+func (cmd Command) Float64() float64 {
+	if cmd.On {
+		return 1
+	}
+	return 0
+}
+
+// parseCommand parses the qualifier and the S/E bit of a command whose state is on.
+func parseCommand(b byte, on bool) Command {
+	return Command{
+		On:        on,
+		Select:    b&0x80 != 0,
+		Qualifier: (b >> 2) & 0x1f,
+	}
+}
+
+/*
+NewInformationElement encodes the value with the quality descriptor and the time tag as the information element of the
+type in monitor direction, which is put into an information object by NewInformationObject. The value is converted to
+the type if they differ, for example, a Normalized value is sent as a short floating point number by MMeNc1. The time
+tag is only encoded by the types with time tag, the current time is used if ts is zero.
+*/
+func NewInformationElement(typeID TypeID, value TypedValue, quality QualityDescriptor, ts time.Time) (
+	*InformationElement, error) {
+	var raw []byte
+	switch typeID.Family() {
+	case MSpNa1:
+		raw = []byte{byte(quality&(IV|NT|SB|BL)) | byte(toSinglePoint(value).Float64())}
+	case MDpNa1:
+		dp, ok := toDoublePoint(value)
+		if !ok {
+			return nil, fmt.Errorf("can't convert %T to double point information", value)
+		}
+		raw = []byte{byte(quality&(IV|NT|SB|BL)) | byte(dp)}
+	case MMeNa1:
+		raw = serializeLittleEndianUint16(uint16(toNormalized(value)))
+		if typeID != MMeNd1 {
+			raw = append(raw, byte(quality&(IV|NT|SB|BL|OV)))
+		}
+	case MMeNb1:
+		raw = append(serializeLittleEndianUint16(uint16(toScaled(value))), byte(quality&(IV|NT|SB|BL|OV)))
+	case MMeNc1:
+		bits := math.Float32bits(float32(value.Float64()))
+		raw = append(serializeLittleEndianUint32(bits), byte(quality&(IV|NT|SB|BL|OV)))
+	case MItNa1:
+		counter, ok := value.(BinaryCounter)
+		if !ok {
+			return nil, fmt.Errorf("can't convert %T to binary counter reading", value)
+		}
+		counter.Invalid = counter.Invalid || quality&IV != 0
+		raw = serializeBinaryCounter(counter)
+		value = counter
+	default:
+		return nil, fmt.Errorf("TypeID[%X] is not a type of process information in monitor direction", typeID)
+	}
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	switch typeID {
+	case MSpTa1, MDpTa1, MMeTa1, MMeTb1, MMeTc1, MItTa1:
+		raw = append(raw, serializeCP56Time2a(ts)[:3]...) // CP24Time2a is the first 3 bytes of CP56Time2a
+	case MSpTb1, MDpTb1, MMeTd1, MMeTe1, MMeTf1, MItTb1:
+		raw = append(raw, serializeCP56Time2a(ts)...)
+	}
+	ie := &InformationElement{TypeID: typeID, Value: value.Float64(), Typed: value, Quality: quality, Ts: ts, Raw: raw}
+	if counter, ok := value.(BinaryCounter); ok {
+		ie.Value = float64(counter.Value) * 0.01
+	}
+	return ie, nil
+}
+
+// NewTypedValue returns the value of the type family in monitor direction whose convenience value is value, the inverse
+// of InformationElement.Value rather than of TypedValue.Float64: DoublePointOn for 2 of MDpNa1, and the BinaryCounter
+// of 1234 for 12.34 of MItNa1, as the reading of a counter is scaled by 0.01 in InformationElement.Value while its
+// Float64 is the reading itself.
+func NewTypedValue(typeID TypeID, value float64) TypedValue {
+	switch typeID.Family() {
+	case MSpNa1:
+		return SinglePoint(value != 0)
+	case MDpNa1:
+		return DoublePoint(uint8(value) & 0b11)
+	case MMeNa1:
+		return toNormalized(Float(value))
+	case MMeNb1:
+		return toScaled(Float(value))
+	case MItNa1:
+		return BinaryCounter{Value: int32(math.Round(value * 100))}
+	}
+	return Float(value)
+}
+
+func toSinglePoint(value TypedValue) SinglePoint {
+	if dp, ok := value.(DoublePoint); ok {
+		return dp == DoublePointOn
+	}
+	return value.Float64() != 0
+}
+
+func toDoublePoint(value TypedValue) (DoublePoint, bool) {
+	switch v := value.(type) {
+	case DoublePoint:
+		return v, true
+	case SinglePoint:
+		if v {
+			return DoublePointOn, true
+		}
+		return DoublePointOff, true
+	}
+	return 0, false
+}
+
+func toNormalized(value TypedValue) Normalized {
+	if n, ok := value.(Normalized); ok {
+		return n
+	}
+	return Normalized(clampInt16(value.Float64() * 32768))
+}
+
+func toScaled(value TypedValue) Scaled {
+	if s, ok := value.(Scaled); ok {
+		return s
+	}
+	return Scaled(clampInt16(value.Float64()))
+}
+
+func clampInt16(x float64) int16 {
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(x))))
+}
+
+// serializeBinaryCounter serializes the 5-byte binary counter reading, the inverse of parseBinaryCounter.
+func serializeBinaryCounter(bc BinaryCounter) []byte {
+	flags := bc.Seq & 0x1f
+	if bc.Carry {
+		flags |= 0x20
+	}
+	if bc.Adjusted {
+		flags |= 0x40
+	}
+	if bc.Invalid {
+		flags |= 0x80
+	}
+	return append(serializeLittleEndianUint32(uint32(bc.Value)), flags)
+}
@@ -0,0 +1,145 @@
+package iec104
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInformationElement_Typed(t *testing.T) {
+	ie := func(raw ...byte) *InformationElement {
+		return &InformationElement{Raw: raw}
+	}
+	tests := []struct {
+		name      string
+		asdu      *ASDU
+		want      TypedValue
+		wantValue float64
+	}{
+		{"single point", NewASDU(MSpNa1, CotSpont, 1, NewInformationObject(1, ie(0x01))), SinglePoint(true), 1},
+		{"double point", NewASDU(MDpNa1, CotSpont, 1, NewInformationObject(1, ie(0x01))), DoublePointOff, 1},
+		{"normalized", NewASDU(MMeNa1, CotSpont, 1, NewInformationObject(1, ie(0x00, 0xc0, 0x00))), Normalized(-16384), -0.5},
+		{"scaled", NewASDU(MMeNb1, CotSpont, 1, NewInformationObject(1, ie(0xff, 0xff, 0x00))), Scaled(-1), -1},
+		{"float", NewASDU(MMeNc1, CotSpont, 1, NewInformationObject(1, ie(0x00, 0x00, 0x20, 0x40, 0x00))), Float(2.5), 2.5},
+		{
+			"binary counter",
+			NewASDU(MItNa1, CotReqcogen, 1, NewInformationObject(1, ie(0x64, 0x00, 0x00, 0x00, 0x40|0x05))),
+			BinaryCounter{Value: 100, Seq: 5, Adjusted: true},
+			1,
+		},
+		{
+			"negative binary counter",
+			NewASDU(MItNa1, CotReqcogen, 1, NewInformationObject(1, ie(0xff, 0xff, 0xff, 0xff, 0x01))),
+			BinaryCounter{Value: -1, Seq: 1},
+			-0.01,
+		},
+		{
+			"select single command with long pulse",
+			NewASDU(CScNa1, CotAct, 1, NewInformationObject(1, ie(0x80|2<<2|0x01))),
+			Command{On: true, Select: true, Qualifier: 2},
+			0x89,
+		},
+		{"execute double command off", NewASDU(CDcNa1, CotAct, 1, NewInformationObject(1, ie(0x01))), Command{}, 1},
+		{"regulating step higher", NewASDU(CRcNa1, CotAct, 1, NewInformationObject(1, ie(0x02))), Command{On: true}, 2},
+		{
+			"select set-point command",
+			NewASDU(CSeNc1, CotAct, 1, NewInformationObject(1, ie(0x00, 0x00, 0x20, 0x40, 0x80))),
+			Float(2.5),
+			2.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signals := testParseASDU(t, tt.asdu).Signals
+			if len(signals) != 1 {
+				t.Fatalf("got %d signals, want 1", len(signals))
+			}
+			if !reflect.DeepEqual(signals[0].Typed, tt.want) {
+				t.Errorf("Typed = %#v, want %#v", signals[0].Typed, tt.want)
+			}
+			if signals[0].Value != tt.wantValue {
+				t.Errorf("Value = %v, want %v", signals[0].Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func Test_serializeCP56Time2a(t *testing.T) {
+	want := time.Date(2024, time.March, 31, 23, 59, 58, 123*int(time.Millisecond), time.Local)
+	data := serializeCP56Time2a(want)
+	if got := parseCP56Time2a(data); !got.Equal(want) {
+		t.Errorf("parseCP56Time2a() = %v, want %v", got, want)
+	}
+	if weekday := data[4] >> 5; weekday != 7 {
+		t.Errorf("day of week = %d, want 7 (Sunday)", weekday)
+	}
+}
+
+func TestNewInformationElement(t *testing.T) {
+	ts := time.Date(2024, time.May, 1, 8, 30, 15, 250*int(time.Millisecond), time.Local)
+	tests := []struct {
+		name    string
+		typeID  TypeID
+		value   TypedValue
+		quality QualityDescriptor
+		want    TypedValue
+		wantErr bool
+	}{
+		{"single point with quality", MSpTb1, SinglePoint(true), SB, SinglePoint(true), false},
+		{"single point to double point", MDpNa1, SinglePoint(false), 0, DoublePointOff, false},
+		{"normalized to float", MMeTf1, Normalized(-16384), OV, Float(-0.5), false},
+		{"float to normalized", MMeNa1, Float(0.25), 0, Normalized(8192), false},
+		{"float to scaled with overflow", MMeNb1, Float(1e6), 0, Scaled(32767), false},
+		{
+			"invalid counter", MItTb1, BinaryCounter{Value: -3, Seq: 4}, IV,
+			BinaryCounter{Value: -3, Seq: 4, Invalid: true}, false,
+		},
+		{"measured value to double point", MDpNa1, Float(1), 0, nil, true},
+		{"command", CScNa1, SinglePoint(true), 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ie, err := NewInformationElement(tt.typeID, tt.value, tt.quality, ts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewInformationElement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := testParseASDU(t, NewASDU(tt.typeID, CotSpont, 1, NewInformationObject(1, ie))).Signals[0]
+			if !reflect.DeepEqual(got.Typed, tt.want) {
+				t.Errorf("Typed = %#v, want %#v", got.Typed, tt.want)
+			}
+			if counter, ok := ie.Typed.(BinaryCounter); ok && !reflect.DeepEqual(counter, tt.want) {
+				t.Errorf("Typed = %#v before it's sent, want %#v", counter, tt.want)
+			}
+			if tt.typeID != MItTb1 && got.Quality != tt.quality {
+				t.Errorf("Quality = %X, want %X", got.Quality, tt.quality)
+			}
+			if tt.typeID == MSpTb1 && !got.Ts.Equal(ts) {
+				t.Errorf("Ts = %v, want %v", got.Ts, ts)
+			}
+		})
+	}
+}
+
+func TestNewTypedValue(t *testing.T) {
+	tests := []struct {
+		typeID TypeID
+		value  float64
+		want   TypedValue
+	}{
+		{MSpTb1, 1, SinglePoint(true)},
+		{MDpNa1, 2, DoublePointOn},
+		{MMeNa1, -0.5, Normalized(-16384)},
+		{MMeTe1, 1e6, Scaled(32767)},
+		{MMeNc1, 2.5, Float(2.5)},
+		{MItNa1, 12.34, BinaryCounter{Value: 1234}},
+		{MItNa1, -0.01, BinaryCounter{Value: -1}},
+	}
+	for _, tt := range tests {
+		if got := NewTypedValue(tt.typeID, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewTypedValue(%X, %v) = %#v, want %#v", tt.typeID, tt.value, got, tt.want)
+		}
+	}
+}